@@ -20,7 +20,10 @@ import (
 	"github.com/moenet/moenet-agent/internal/httpclient"
 	"github.com/moenet/moenet-agent/internal/loopback"
 	"github.com/moenet/moenet-agent/internal/maintenance"
+	"github.com/moenet/moenet-agent/internal/metrics"
+	"github.com/moenet/moenet-agent/internal/plan"
 	"github.com/moenet/moenet-agent/internal/task"
+	"github.com/moenet/moenet-agent/internal/tunnel"
 	"github.com/moenet/moenet-agent/internal/updater"
 	"github.com/moenet/moenet-agent/internal/wireguard"
 )
@@ -44,13 +47,19 @@ var (
 )
 
 func main() {
+	os.Exit(run())
+}
+
+// run starts the agent and returns the exit code once it has shut down
+func run() int {
 	configFile := flag.String("c", "config.json", "Path to configuration file")
 	showVersion := flag.Bool("v", false, "Show version and exit")
+	planMode := flag.Bool("plan", false, "Print the changes the sync tasks would make and exit")
 	flag.Parse()
 
 	if *showVersion {
 		fmt.Printf("%s %s (commit: %s, built: %s)\n", serverSignature, Version, Commit, BuildTime)
-		os.Exit(0)
+		return 0
 	}
 
 	// Create root context for graceful shutdown
@@ -61,26 +70,57 @@ func main() {
 	var err error
 	cfg, err = config.LoadWithBootstrap(*configFile)
 	if err != nil {
-		log.Fatalf("Failed to load config: %v", err)
+		log.Printf("Failed to load config: %v", err)
+		return 1
+	}
+	if err := cfg.Validate(); err != nil {
+		log.Printf("Invalid config: %v", err)
+		return 1
+	}
+
+	// Plan mode creates nothing and does not connect to BIRD
+	if *planMode {
+		return runPlan(ctx)
 	}
 
 	// Initialize BIRD connection pool
 	birdPool, err = bird.NewPool(cfg.Bird.ControlSocket, cfg.Bird.PoolSize, cfg.Bird.PoolSizeMax)
 	if err != nil {
-		log.Fatalf("Failed to initialize BIRD pool: %v", err)
+		log.Printf("Failed to initialize BIRD pool: %v", err)
+		return 1
 	}
 	defer birdPool.Close()
+	birdPool.SetReconfigureDebounce(time.Duration(cfg.Bird.ReconfigureDebounce) * time.Millisecond)
+	birdPool.SetAcquireTimeout(time.Duration(cfg.Bird.PoolAcquireTimeout) * time.Second)
+	metrics.Get().SetBirdPoolStats(func() metrics.BirdPoolStats {
+		stats := birdPool.Stats()
+		return metrics.BirdPoolStats{Open: stats.Open, Idle: stats.Idle, Waits: stats.Waits, Errors: stats.Errors}
+	})
+
+	if cfg.Bird.SafeApply {
+		birdPool.SetSafeApply(time.Duration(cfg.Bird.SafeApplyTimeout)*time.Second, task.NewApplyHealthCheck(cfg, birdPool))
+		log.Printf("BIRD safe-apply enabled (timeout %ds)", cfg.Bird.SafeApplyTimeout)
+	}
+
+	// Load the BIRD config templates, with the operator overrides
+	birdRenderer, err := bird.NewRenderer(cfg.Bird.TemplateDir)
+	if err != nil {
+		log.Printf("Failed to load BIRD templates: %v", err)
+		return 1
+	}
 
 	// Initialize BIRD config generator
-	birdConfig, err := bird.NewConfigGenerator(cfg.Bird.PeerConfDir)
+	birdConfig, err := bird.NewConfigGenerator(cfg.Bird.PeerConfDir, birdRenderer)
 	if err != nil {
-		log.Fatalf("Failed to initialize BIRD config generator: %v", err)
+		log.Printf("Failed to initialize BIRD config generator: %v", err)
+		return 1
 	}
 
 	// Initialize WireGuard executor
 	wgExecutor, err := wireguard.NewExecutor(cfg.WireGuard.ConfigDir, cfg.WireGuard.PrivateKeyPath)
 	if err != nil {
-		log.Fatalf("Failed to initialize WireGuard executor: %v", err)
+		log.Printf("Failed to initialize WireGuard executor: %v", err)
+		return 1
 	}
 
 	// Initialize loopback executor and setup dummy0 interface
@@ -106,7 +146,7 @@ func main() {
 	apiHandler := api.NewHandler(Version, maintenanceState)
 
 	// Create restart handler
-	restartHandler := api.NewRestartHandler(birdPool, wgExecutor)
+	restartHandler := api.NewRestartHandler(birdPool, birdConfig, wgExecutor)
 
 	// Create tools handler for network diagnostics
 	toolsHandler := api.NewToolsHandler(birdPool, cfg.ControlPlane.Token)
@@ -143,30 +183,60 @@ func main() {
 	fwExecutor := firewall.NewExecutor(slog.Default())
 	log.Println("Firewall executor initialized")
 
-	sessionSync := task.NewSessionSync(cfg, birdPool, birdConfig, wgExecutor, fwExecutor)
-	metricCollector := task.NewMetricCollector(cfg, birdPool)
+	// Initialize GRE tunnel executor for non-WireGuard sessions
+	tnExecutor := tunnel.NewExecutor()
+
+	sessionSync := task.NewSessionSync(cfg, birdPool, birdConfig, wgExecutor, tnExecutor, fwExecutor)
+
+	// Session state endpoints
+	sessionHandler := api.NewSessionHandler(sessionSync)
+	mux.HandleFunc("/sessions/remediation", sessionHandler.HandleRemediation)
+	metricCollector := task.NewMetricCollector(cfg, birdPool, birdConfig)
 	meshSync := task.NewMeshSync(cfg, wgExecutor)
-	ibgpSync, err := task.NewIBGPSync(cfg, birdPool)
+	ibgpSync, err := task.NewIBGPSync(cfg, birdPool, birdRenderer)
 	if err != nil {
-		log.Fatalf("Failed to initialize iBGP sync: %v", err)
+		log.Printf("Failed to initialize iBGP sync: %v", err)
+		return 1
 	}
 	rttMeasurement := task.NewRTTMeasurement(cfg)
+	endpointResolver := task.NewEndpointResolver(cfg, sessionSync, meshSync, wgExecutor, tnExecutor)
 
 	// Initialize HTTP client for BirdConfigSync
 	httpClient := httpclient.New(nil, httpclient.DefaultRetryConfig())
 
 	// Initialize BIRD config sync (connects to iBGP sync)
-	birdConfigSync, err := task.NewBirdConfigSync(cfg, birdPool, httpClient, ibgpSync)
+	birdConfigSync := task.NewBirdConfigSync(cfg, birdPool, httpClient, ibgpSync, birdRenderer)
+
+	// Local AS from the node config, or from the CP policy on bootstrap nodes
+	localAS := task.NewLocalAS(cfg.Node)
+	birdConfigSync.SetLocalAS(localAS)
+	ibgpSync.SetLocalAS(localAS)
+	meshSync.SetLocalAS(localAS)
+
+	// Restore the state of the previous run, then keep it up to date
+	stateStore, err := task.NewStateStore(cfg.State.Path)
 	if err != nil {
-		log.Fatalf("Failed to initialize BIRD config sync: %v", err)
+		log.Printf("Failed to initialize state store: %v", err)
+		return 1
 	}
+	sessionSync.SetStateStore(stateStore)
+	meshSync.SetStateStore(stateStore)
+	ibgpSync.SetStateStore(stateStore)
+	birdConfigSync.SetStateStore(stateStore)
+	stateHandler := api.NewStateHandler(stateStore)
+	mux.HandleFunc("/state", stateHandler.HandleState)
+
+	// Dry run of all sync tasks
+	ibgpSync.SetPeerSource(birdConfigSync.IBGPPeers)
+	planHandler := api.NewPlanHandler(planners(sessionSync, meshSync, ibgpSync, birdConfigSync))
+	mux.HandleFunc("/plan", planHandler.HandlePlan)
 
 	// Connect MeshSync to RTT so RTT can use mesh peer loopback IPs
 	meshSync.SetOnPeersUpdated(rttMeasurement.UpdateMeshPeers)
 
 	// Create WaitGroup for background tasks
 	var wg sync.WaitGroup
-	taskCount := 7 // heartbeat, sessionSync, metricCollector, rttMeasurement, meshSync, ibgpSync, birdConfigSync
+	taskCount := 8 // heartbeat, sessionSync, metricCollector, rttMeasurement, meshSync, ibgpSync, birdConfigSync, endpointResolver
 
 	// Initialize auto-updater if enabled
 	var agentUpdater *updater.Updater
@@ -193,6 +263,7 @@ func main() {
 	go meshSync.Run(ctx, &wg)
 	go ibgpSync.Run(ctx, &wg)
 	go birdConfigSync.Run(ctx, &wg)
+	go endpointResolver.Run(ctx, &wg)
 	if agentUpdater != nil {
 		go agentUpdater.Run(ctx, &wg)
 	}
@@ -244,6 +315,54 @@ func main() {
 	}
 
 	log.Printf("%s stopped\n", serverSignature)
+	return 0
+}
+
+// runPlan prints the changes the sync tasks would make. The tasks are built
+// without creating directories, keys or the state file and without a BIRD
+// connection, since planning only reads the disk and the Control Plane.
+func runPlan(ctx context.Context) int {
+	birdRenderer, err := bird.NewRenderer(cfg.Bird.TemplateDir)
+	if err != nil {
+		log.Printf("Failed to load BIRD templates: %v", err)
+		return 1
+	}
+	birdConfig := bird.OpenConfigGenerator(cfg.Bird.PeerConfDir, birdRenderer)
+	wgExecutor := wireguard.OpenExecutor(cfg.WireGuard.ConfigDir, cfg.WireGuard.PrivateKeyPath)
+
+	sessionSync := task.NewSessionSync(cfg, nil, birdConfig, wgExecutor, tunnel.NewExecutor(), firewall.NewExecutor(slog.Default()))
+	meshSync := task.NewMeshSync(cfg, wgExecutor)
+	ibgpSync := task.OpenIBGPSync(cfg, nil, birdRenderer)
+	birdConfigSync := task.NewBirdConfigSync(cfg, nil, httpclient.New(nil, httpclient.DefaultRetryConfig()), ibgpSync, birdRenderer)
+	ibgpSync.SetPeerSource(birdConfigSync.IBGPPeers)
+
+	localAS := task.NewLocalAS(cfg.Node)
+	birdConfigSync.SetLocalAS(localAS)
+	ibgpSync.SetLocalAS(localAS)
+	meshSync.SetLocalAS(localAS)
+
+	stateStore := task.OpenStateStore(cfg.State.Path)
+	sessionSync.SetStateStore(stateStore)
+	meshSync.SetStateStore(stateStore)
+	ibgpSync.SetStateStore(stateStore)
+	birdConfigSync.SetStateStore(stateStore)
+
+	p := plan.Build(ctx, planners(sessionSync, meshSync, ibgpSync, birdConfigSync))
+	fmt.Print(p.String())
+	if len(p.Errors) > 0 {
+		return 1
+	}
+	return 0
+}
+
+// planners returns the sync tasks that can be planned, keyed by task name
+func planners(sessionSync *task.SessionSync, meshSync *task.MeshSync, ibgpSync *task.IBGPSync, birdConfigSync *task.BirdConfigSync) map[string]plan.Planner {
+	return map[string]plan.Planner{
+		"SessionSync":    sessionSync,
+		"MeshSync":       meshSync,
+		"IBGPSync":       ibgpSync,
+		"BirdConfigSync": birdConfigSync,
+	}
 }
 
 // handleSync handles sync requests (placeholder)
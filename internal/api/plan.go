@@ -0,0 +1,42 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/moenet/moenet-agent/internal/plan"
+)
+
+// PlanHandler reports the changes the sync tasks would make
+type PlanHandler struct {
+	planners map[string]plan.Planner
+}
+
+// NewPlanHandler creates a new plan handler
+func NewPlanHandler(planners map[string]plan.Planner) *PlanHandler {
+	return &PlanHandler{
+		planners: planners,
+	}
+}
+
+// HandlePlan handles GET /plan - dry run of all sync tasks, JSON or ?format=text
+func (h *PlanHandler) HandlePlan(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		json.NewEncoder(w).Encode(ErrorResponse{Error: "Method not allowed"})
+		return
+	}
+
+	p := plan.Build(r.Context(), h.planners)
+
+	if r.URL.Query().Get("format") == "text" {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		fmt.Fprint(w, p.String())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(p)
+}
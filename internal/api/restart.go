@@ -12,20 +12,34 @@ import (
 // RestartHandler handles peer restart operations
 type RestartHandler struct {
 	birdPool   *bird.Pool
+	birdConfig *bird.ConfigGenerator
 	wgExecutor *wireguard.Executor
 }
 
 // NewRestartHandler creates a new restart handler
-func NewRestartHandler(birdPool *bird.Pool, wgExecutor *wireguard.Executor) *RestartHandler {
+func NewRestartHandler(birdPool *bird.Pool, birdConfig *bird.ConfigGenerator, wgExecutor *wireguard.Executor) *RestartHandler {
 	return &RestartHandler{
 		birdPool:   birdPool,
+		birdConfig: birdConfig,
 		wgExecutor: wgExecutor,
 	}
 }
 
+// peerProtocols returns the BIRD protocols of a peer: the protocols declared
+// in its peer file, which include the separate IPv4 protocol of peers without
+// MP-BGP, or just the peer name if there is no such file
+func (h *RestartHandler) peerProtocols(name string) []string {
+	if h.birdConfig != nil {
+		if file, err := h.birdConfig.ReadSession(name); err == nil && len(file.Protocols) > 0 {
+			return file.Protocols
+		}
+	}
+	return []string{name}
+}
+
 // RestartRequest is the request body for /restart
 type RestartRequest struct {
-	PeerName string `json:"peer_name"` // e.g., "dn42_4242420998"
+	PeerName string `json:"peer_name"` // e.g., "dn42_4242420998_1a2b3c4d"
 	WgOnly   bool   `json:"wg_only"`   // Only restart WireGuard, not BGP
 	BgpOnly  bool   `json:"bgp_only"`  // Only restart BGP, not WireGuard
 }
@@ -65,15 +79,19 @@ func (h *RestartHandler) HandleRestart(w http.ResponseWriter, r *http.Request) {
 	var steps []string
 	var lastErr error
 
-	// Step 1: Disable BGP protocol (unless wg_only)
+	protocols := h.peerProtocols(req.PeerName)
+
+	// Step 1: Disable BGP protocols (unless wg_only)
 	if !req.WgOnly {
-		result, err := h.birdPool.Execute("disable " + req.PeerName)
-		if err != nil {
-			log.Printf("[Restart] Failed to disable BGP: %v", err)
-			lastErr = err
-		} else {
-			steps = append(steps, "BGP disabled: "+req.PeerName)
-			log.Printf("[Restart] BGP disabled: %s", result)
+		for _, protocol := range protocols {
+			reply, err := h.birdPool.Command("disable " + protocol)
+			if err != nil {
+				log.Printf("[Restart] Failed to disable BGP: %v", err)
+				lastErr = err
+			} else {
+				steps = append(steps, "BGP disabled: "+protocol)
+				log.Printf("[Restart] BGP disabled: %s", reply)
+			}
 		}
 	}
 
@@ -93,15 +111,17 @@ func (h *RestartHandler) HandleRestart(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	// Step 3: Enable BGP protocol (unless wg_only)
+	// Step 3: Enable BGP protocols (unless wg_only)
 	if !req.WgOnly {
-		result, err := h.birdPool.Execute("enable " + req.PeerName)
-		if err != nil {
-			log.Printf("[Restart] Failed to enable BGP: %v", err)
-			lastErr = err
-		} else {
-			steps = append(steps, "BGP enabled: "+req.PeerName)
-			log.Printf("[Restart] BGP enabled: %s", result)
+		for _, protocol := range protocols {
+			reply, err := h.birdPool.Command("enable " + protocol)
+			if err != nil {
+				log.Printf("[Restart] Failed to enable BGP: %v", err)
+				lastErr = err
+			} else {
+				steps = append(steps, "BGP enabled: "+protocol)
+				log.Printf("[Restart] BGP enabled: %s", reply)
+			}
 		}
 	}
 
@@ -0,0 +1,40 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/moenet/moenet-agent/internal/task"
+)
+
+// SessionHandler exposes local session state
+type SessionHandler struct {
+	sessionSync *task.SessionSync
+}
+
+// NewSessionHandler creates a new session handler
+func NewSessionHandler(sessionSync *task.SessionSync) *SessionHandler {
+	return &SessionHandler{
+		sessionSync: sessionSync,
+	}
+}
+
+// RemediationResponse is the response for /sessions/remediation
+type RemediationResponse struct {
+	Sessions []task.RemediationState `json:"sessions"`
+}
+
+// HandleRemediation handles GET /sessions/remediation - remediation attempts and history
+func (h *SessionHandler) HandleRemediation(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		json.NewEncoder(w).Encode(ErrorResponse{Error: "Method not allowed"})
+		return
+	}
+
+	json.NewEncoder(w).Encode(RemediationResponse{
+		Sessions: h.sessionSync.GetRemediationStates(),
+	})
+}
@@ -0,0 +1,33 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/moenet/moenet-agent/internal/task"
+)
+
+// StateHandler exposes the persisted agent state
+type StateHandler struct {
+	store *task.StateStore
+}
+
+// NewStateHandler creates a new state handler
+func NewStateHandler(store *task.StateStore) *StateHandler {
+	return &StateHandler{
+		store: store,
+	}
+}
+
+// HandleState handles GET /state - last applied desired state, credentials redacted
+func (h *StateHandler) HandleState(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		json.NewEncoder(w).Encode(ErrorResponse{Error: "Method not allowed"})
+		return
+	}
+
+	json.NewEncoder(w).Encode(h.store.Get().Redacted())
+}
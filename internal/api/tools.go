@@ -113,25 +113,37 @@ func (h *ToolsHandler) HandleRoute(w http.ResponseWriter, r *http.Request) {
 // HandlePath handles POST /path - AS path lookup
 func (h *ToolsHandler) HandlePath(w http.ResponseWriter, r *http.Request) {
 	h.handleTool(w, r, func(target string) (string, error) {
-		// Use Pool.Execute which handles connection pool internally
-		result, err := h.birdPool.Execute(fmt.Sprintf("show route for %s all", target))
+		routes, err := h.birdPool.ShowRoute(target)
 		if err != nil {
 			return "", fmt.Errorf("BIRD query failed: %w", err)
 		}
+		if len(routes) == 0 {
+			return "Network not found", nil
+		}
+		return formatRoutePaths(routes), nil
+	})
+}
 
-		// Filter for AS path info
-		lines := strings.Split(result, "\n")
-		var filtered []string
-		for _, line := range lines {
-			if strings.Contains(line, "BGP.as_path") || strings.Contains(line, "via") || strings.Contains(line, "unicast") {
-				filtered = append(filtered, line)
-			}
+// formatRoutePaths renders the next hop and AS path of each route
+func formatRoutePaths(routes []bird.Route) string {
+	var b strings.Builder
+	for _, route := range routes {
+		fmt.Fprintf(&b, "%s %s [%s]", route.Network, route.Type, route.Protocol)
+		if route.Primary {
+			b.WriteString(" *")
 		}
-		if len(filtered) == 0 {
-			return result, nil
+		if route.NextHop != "" {
+			fmt.Fprintf(&b, " via %s", route.NextHop)
 		}
-		return strings.Join(filtered, "\n"), nil
-	})
+		if route.Interface != "" {
+			fmt.Fprintf(&b, " on %s", route.Interface)
+		}
+		b.WriteString("\n")
+		if path, ok := route.Attributes["BGP.as_path"]; ok {
+			fmt.Fprintf(&b, "\tBGP.as_path: %s\n", path)
+		}
+	}
+	return strings.TrimSuffix(b.String(), "\n")
 }
 
 // handleTool is a helper that handles common tool request/response logic.
@@ -4,10 +4,10 @@ package bird
 import (
 	"bytes"
 	"fmt"
+	"net"
 	"os"
 	"path/filepath"
 	"strings"
-	"text/template"
 )
 
 // SessionConfig represents the configuration for a BGP session.
@@ -20,76 +20,177 @@ type SessionConfig struct {
 	IPv6            string   // Remote IPv6 address (for neighbor)
 	IPv6LinkLocal   string   // Link-local IPv6 address
 	Extensions      []string // BGP extensions: mp-bgp, extended-nexthop
-	Policy          string   // Policy: normal, direct, transit
+	Policy          string   // Policy: normal (default), direct, transit
 	IsMultiprotocol bool     // MP-BGP enabled
 	IsExtNH         bool     // Extended Next-Hop enabled
+	Teardown        bool     // Tag all exports with GRACEFUL_SHUTDOWN (RFC 8326)
+	// Transport security
+	Password       string // TCP authentication secret, empty for none
+	Authentication string // md5 (default) or ao (TCP-AO, BIRD 3)
+	TTLSecurity    bool   // GTSM (RFC 5082)
+	Multihop       int    // eBGP multihop TTL, 0 for directly connected
+	SourceAddress  string // Local address of the session
+}
+
+// IPv4ProtocolSuffix is appended to the session name for the separate IPv4
+// protocol of peers without MP-BGP.
+const IPv4ProtocolSuffix = "_v4"
+
+// TCP authentication methods.
+const (
+	AuthMD5 = "md5"
+	AuthAO  = "ao"
+)
+
+// Session policies, selecting the import and export filters of a session.
+const (
+	PolicyNormal  = "normal"  // Full table both ways (DN42 default)
+	PolicyDirect  = "direct"  // Export only our own and customer routes
+	PolicyTransit = "transit" // Peer is a customer: export the full table, tag its routes
+)
+
+// policyFilters holds the filters.conf symbols used by a policy.
+type policyFilters struct {
+	importFilter string // Named import filter
+	exportFilter string // Named export filter
+	exportFunc   string // Export decision, used by the inline teardown filter
+}
+
+// sessionPolicies maps each policy to its filters.
+var sessionPolicies = map[string]policyFilters{
+	PolicyNormal:  {"dn42_import_filter", "dn42_export_filter", "dn42_export"},
+	PolicyDirect:  {"dn42_import_filter", "dn42_export_filter_direct", "dn42_export_direct"},
+	PolicyTransit: {"dn42_import_filter_transit", "dn42_export_filter", "dn42_export"},
 }
 
 // ConfigGenerator generates BIRD configuration files.
 type ConfigGenerator struct {
-	configDir    string
-	sessionDir   string
-	templateIPv6 *template.Template
+	configDir  string
+	sessionDir string
+	renderer   *Renderer
 }
 
-// NewConfigGenerator creates a new BIRD config generator.
-func NewConfigGenerator(configDir string) (*ConfigGenerator, error) {
-	sessionDir := configDir // configDir is already the peers directory (e.g. /etc/bird/peers)
+// NewConfigGenerator creates a new BIRD config generator rendering sessions
+// with the session template of renderer.
+func NewConfigGenerator(configDir string, renderer *Renderer) (*ConfigGenerator, error) {
+	g := OpenConfigGenerator(configDir, renderer)
 
 	// Ensure session directory exists
-	if err := os.MkdirAll(sessionDir, 0755); err != nil {
+	if err := os.MkdirAll(g.sessionDir, 0755); err != nil {
 		return nil, fmt.Errorf("failed to create session dir: %w", err)
 	}
 
-	tmpl, err := template.New("bgp6").Parse(bgpTemplateIPv6)
-	if err != nil {
-		return nil, fmt.Errorf("failed to parse template: %w", err)
-	}
+	return g, nil
+}
 
+// OpenConfigGenerator creates a BIRD config generator without creating the
+// session directory, for rendering and reading configs only (dry runs).
+func OpenConfigGenerator(configDir string, renderer *Renderer) *ConfigGenerator {
 	return &ConfigGenerator{
-		configDir:    configDir,
-		sessionDir:   sessionDir,
-		templateIPv6: tmpl,
-	}, nil
+		configDir:  configDir,
+		sessionDir: configDir, // configDir is already the peers directory (e.g. /etc/bird/peers)
+		renderer:   renderer,
+	}
 }
 
 // GenerateSession generates BIRD configuration for a session.
 func (g *ConfigGenerator) GenerateSession(cfg *SessionConfig) error {
+	content, err := g.RenderSession(cfg)
+	if err != nil {
+		return err
+	}
+
+	// Write to file
+	if err := os.WriteFile(g.SessionPath(cfg.Name), content, 0644); err != nil {
+		return fmt.Errorf("failed to write config: %w", err)
+	}
+
+	return nil
+}
+
+// RenderSession renders the BIRD configuration of a session without writing it.
+func (g *ConfigGenerator) RenderSession(cfg *SessionConfig) ([]byte, error) {
 	// Check extensions
 	cfg.IsMultiprotocol = containsExtension(cfg.Extensions, "mp-bgp")
 	cfg.IsExtNH = containsExtension(cfg.Extensions, "extended-nexthop")
 
-	// Determine neighbor address (prefer link-local for IPv6)
+	// An empty policy keeps the historical behaviour
+	policy := strings.ToLower(cfg.Policy)
+	if policy == "" {
+		policy = PolicyNormal
+	}
+	filters, ok := sessionPolicies[policy]
+	if !ok {
+		return nil, fmt.Errorf("unknown policy %q", cfg.Policy)
+	}
+
+	auth, err := validateTransport(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	// Determine neighbor address (prefer link-local for IPv6). Multihop
+	// sessions cannot use link-local addresses or bind to the interface.
 	neighborAddr := cfg.IPv6LinkLocal
-	if neighborAddr == "" {
+	if neighborAddr == "" || cfg.Multihop > 0 {
 		neighborAddr = cfg.IPv6
 	}
+	// Peers without MP-BGP only exchange IPv4 routes over an IPv4 session,
+	// so they get a second protocol neighboring the IPv4 tunnel address
+	ipv4Protocol := ""
+	if neighborAddr == "" {
+		neighborAddr = cfg.IPv4
+	} else if !cfg.IsMultiprotocol && cfg.IPv4 != "" {
+		ipv4Protocol = cfg.Name + IPv4ProtocolSuffix
+	}
+	iface := cfg.Interface
+	if cfg.Multihop > 0 || net.ParseIP(neighborAddr).To4() != nil {
+		iface = ""
+	}
+
+	// The source address only applies to the protocol of the same family
+	sourceAddress, ipv4SourceAddress := "", ""
+	if cfg.SourceAddress != "" {
+		if isIPv4(cfg.SourceAddress) == isIPv4(neighborAddr) {
+			sourceAddress = cfg.SourceAddress
+		}
+		if isIPv4(cfg.SourceAddress) {
+			ipv4SourceAddress = cfg.SourceAddress
+		}
+	}
 
 	// Generate IPv6 session (standard for DN42)
-	var buf bytes.Buffer
 	data := map[string]interface{}{
 		"Name":            cfg.Name,
 		"Description":     cfg.Description,
-		"LocalASN":        4242420216, // Local ASN (hardcoded for now)
 		"RemoteASN":       cfg.ASN,
 		"NeighborAddr":    neighborAddr,
-		"Interface":       cfg.Interface,
+		"Interface":       iface,
 		"IsMultiprotocol": cfg.IsMultiprotocol,
 		"IsExtNH":         cfg.IsExtNH,
-		"Policy":          cfg.Policy,
+		"Policy":          policy,
+		"Teardown":        cfg.Teardown,
+		"ImportFilter":    "filter " + filters.importFilter,
+		"ExportFilter":    exportFilter(filters, cfg.Teardown),
+		// The ipv4 channel inherited from dn42_peer uses the normal filters
+		"OverrideIPv4":   cfg.Teardown || policy != PolicyNormal,
+		"Password":       cfg.Password,
+		"Authentication": auth,
+		"TTLSecurity":    cfg.TTLSecurity,
+		"Multihop":       cfg.Multihop,
+		"SourceAddress":  sourceAddress,
+		// Separate IPv4 session of peers without MP-BGP
+		"IPv4Protocol":      ipv4Protocol,
+		"IPv4":              cfg.IPv4,
+		"IPv4SourceAddress": ipv4SourceAddress,
 	}
 
-	if err := g.templateIPv6.Execute(&buf, data); err != nil {
-		return fmt.Errorf("template execution failed: %w", err)
-	}
-
-	// Write to file
-	filename := filepath.Join(g.sessionDir, fmt.Sprintf("%s.conf", cfg.Name))
-	if err := os.WriteFile(filename, buf.Bytes(), 0644); err != nil {
-		return fmt.Errorf("failed to write config: %w", err)
-	}
+	return g.renderer.Render(TemplateSession, data)
+}
 
-	return nil
+// SessionPath returns the path of a session config file.
+func (g *ConfigGenerator) SessionPath(name string) string {
+	return filepath.Join(g.sessionDir, fmt.Sprintf("%s.conf", name))
 }
 
 // RemoveSession removes the BIRD configuration for a session.
@@ -101,6 +202,142 @@ func (g *ConfigGenerator) RemoveSession(name string) error {
 	return nil
 }
 
+// LoadSession returns the raw content of a session config, so it can be
+// restored after a failed update.
+func (g *ConfigGenerator) LoadSession(name string) ([]byte, error) {
+	return os.ReadFile(filepath.Join(g.sessionDir, fmt.Sprintf("%s.conf", name)))
+}
+
+// RestoreSession writes back content returned by LoadSession. A nil content
+// removes the config.
+func (g *ConfigGenerator) RestoreSession(name string, content []byte) error {
+	if content == nil {
+		return g.RemoveSession(name)
+	}
+	filename := filepath.Join(g.sessionDir, fmt.Sprintf("%s.conf", name))
+	if err := os.WriteFile(filename, content, 0644); err != nil {
+		return fmt.Errorf("failed to restore config: %w", err)
+	}
+	return nil
+}
+
+// ListSessions returns the names (without .conf) of all session configs
+// generated by the agent. Files without the auto-generated marker are left alone so that
+// hand-written peer configs are never treated as orphans.
+func (g *ConfigGenerator) ListSessions() ([]string, error) {
+	entries, err := os.ReadDir(g.sessionDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read session dir: %w", err)
+	}
+
+	var names []string
+	for _, entry := range entries {
+		filename := entry.Name()
+		if entry.IsDir() || !strings.HasPrefix(filename, "dn42_") || !strings.HasSuffix(filename, ".conf") {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(g.sessionDir, filename))
+		if err != nil || !bytes.Contains(data, []byte(generatedMarker)) {
+			continue
+		}
+		names = append(names, strings.TrimSuffix(filename, ".conf"))
+	}
+	return names, nil
+}
+
+// SessionFile describes a session config generated by the agent.
+type SessionFile struct {
+	Name      string   // File name without the .conf suffix
+	Protocol  string   // First BIRD protocol name declared in the file
+	Protocols []string // All BIRD protocols declared in the file
+	Interface string   // Interface of the neighbor statement
+}
+
+// ReadSession parses the protocol names and interface of a generated session config.
+func (g *ConfigGenerator) ReadSession(name string) (*SessionFile, error) {
+	data, err := os.ReadFile(filepath.Join(g.sessionDir, fmt.Sprintf("%s.conf", name)))
+	if err != nil {
+		return nil, err
+	}
+	return parseSessionFile(name, string(data)), nil
+}
+
+// RenameSession renames a session config file without touching its content.
+// The protocol declared inside keeps its name, so BIRD does not restart it
+// on the next reconfigure.
+func (g *ConfigGenerator) RenameSession(oldName, newName string) error {
+	oldFile := filepath.Join(g.sessionDir, fmt.Sprintf("%s.conf", oldName))
+	newFile := filepath.Join(g.sessionDir, fmt.Sprintf("%s.conf", newName))
+
+	if _, err := os.Stat(newFile); err == nil {
+		return fmt.Errorf("config %s already exists", newName)
+	}
+	if err := os.Rename(oldFile, newFile); err != nil {
+		return fmt.Errorf("failed to rename config: %w", err)
+	}
+	return nil
+}
+
+// parseSessionFile extracts the protocols and interface from a session config.
+func parseSessionFile(name, content string) *SessionFile {
+	file := &SessionFile{Name: name}
+	for _, line := range strings.Split(content, "\n") {
+		fields := strings.Fields(line)
+		switch {
+		case len(fields) >= 3 && fields[0] == "protocol" && fields[1] == "bgp":
+			if file.Protocol == "" {
+				file.Protocol = fields[2]
+			}
+			file.Protocols = append(file.Protocols, fields[2])
+		case len(fields) >= 4 && fields[0] == "neighbor" && fields[2] == "%" && file.Interface == "":
+			file.Interface = strings.Trim(fields[3], "'\"")
+		}
+	}
+	return file
+}
+
+// validateTransport checks the transport security options of a session and
+// returns the authentication method to render. Values end up verbatim in the
+// BIRD config, so anything that could break out of the statement is rejected.
+func validateTransport(cfg *SessionConfig) (string, error) {
+	auth := ""
+	if cfg.Password != "" {
+		if strings.ContainsAny(cfg.Password, "\"\\\n\r") {
+			return "", fmt.Errorf("password contains unsupported characters")
+		}
+		auth = strings.ToLower(cfg.Authentication)
+		if auth == "" {
+			auth = AuthMD5
+		}
+		if auth != AuthMD5 && auth != AuthAO {
+			return "", fmt.Errorf("unknown authentication %q", cfg.Authentication)
+		}
+	}
+	if cfg.Multihop < 0 || cfg.Multihop > 255 {
+		return "", fmt.Errorf("multihop %d out of range 0-255", cfg.Multihop)
+	}
+	if cfg.SourceAddress != "" && net.ParseIP(cfg.SourceAddress) == nil {
+		return "", fmt.Errorf("invalid source address %q", cfg.SourceAddress)
+	}
+	return auth, nil
+}
+
+// exportFilter returns the export filter of a session. During teardown the
+// export decision of the policy is kept, but every route is tagged with
+// GRACEFUL_SHUTDOWN so the peer moves its traffic away before we disconnect.
+func exportFilter(filters policyFilters, teardown bool) string {
+	if teardown {
+		return fmt.Sprintf("filter { if !%s() then reject; bgp_community.add(GRACEFUL_SHUTDOWN); accept; }", filters.exportFunc)
+	}
+	return "filter " + filters.exportFilter
+}
+
+// isIPv4 reports whether addr is an IPv4 address.
+func isIPv4(addr string) bool {
+	ip := net.ParseIP(addr)
+	return ip != nil && ip.To4() != nil
+}
+
 // containsExtension checks if an extension is in the list.
 func containsExtension(extensions []string, ext string) bool {
 	for _, e := range extensions {
@@ -111,27 +348,5 @@ func containsExtension(extensions []string, ext string) bool {
 	return false
 }
 
-// bgpTemplateIPv6 is the BIRD 3 template for IPv6 BGP sessions.
-const bgpTemplateIPv6 = `# {{.Description}}
-# Auto-generated by moenet-agent
-
-protocol bgp {{.Name}} from dn42_peer {
-    neighbor {{.NeighborAddr}} % '{{.Interface}}' as {{.RemoteASN}};
-    description "{{.Description}}";
-    {{- if .IsMultiprotocol}}
-    
-    ipv4 {
-        import filter dn42_import_filter;
-        export filter dn42_export_filter;
-        {{- if .IsExtNH}}
-        extended next hop on;
-        {{- end}}
-    };
-    {{- end}}
-    
-    ipv6 {
-        import filter dn42_import_filter;
-        export filter dn42_export_filter;
-    };
-}
-`
+// generatedMarker identifies config files written by the agent.
+const generatedMarker = "Auto-generated by moenet-agent"
@@ -0,0 +1,368 @@
+package bird
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestListSessions(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	g, err := NewConfigGenerator(tmpDir, testRenderer(t))
+	if err != nil {
+		t.Fatalf("Failed to create generator: %v", err)
+	}
+
+	for _, cfg := range []*SessionConfig{
+		{Name: "dn42_4242420919", ASN: 4242420919, Interface: "dn42_0919"},
+		{Name: "dn42_4242421080", ASN: 4242421080, Interface: "dn42_1080"},
+	} {
+		if err := g.GenerateSession(cfg); err != nil {
+			t.Fatalf("Failed to generate session: %v", err)
+		}
+	}
+
+	// Hand-written and unrelated files must not be listed
+	if err := os.WriteFile(filepath.Join(tmpDir, "dn42_manual.conf"), []byte("protocol bgp dn42_manual {}"), 0644); err != nil {
+		t.Fatalf("Failed to write manual config: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(tmpDir, "README"), []byte("Auto-generated by moenet-agent"), 0644); err != nil {
+		t.Fatalf("Failed to write readme: %v", err)
+	}
+
+	names, err := g.ListSessions()
+	if err != nil {
+		t.Fatalf("ListSessions failed: %v", err)
+	}
+	sort.Strings(names)
+
+	expected := []string{"dn42_4242420919", "dn42_4242421080"}
+	if len(names) != len(expected) {
+		t.Fatalf("Expected %v, got %v", expected, names)
+	}
+	for i := range expected {
+		if names[i] != expected[i] {
+			t.Errorf("Expected %s at index %d, got %s", expected[i], i, names[i])
+		}
+	}
+}
+
+func TestRemoveSessionNonexistent(t *testing.T) {
+	g, err := NewConfigGenerator(t.TempDir(), testRenderer(t))
+	if err != nil {
+		t.Fatalf("Failed to create generator: %v", err)
+	}
+	if err := g.RemoveSession("dn42_9999999"); err != nil {
+		t.Errorf("Should not error on nonexistent file: %v", err)
+	}
+}
+
+func TestRenameSessionKeepsProtocol(t *testing.T) {
+	g, err := NewConfigGenerator(t.TempDir(), testRenderer(t))
+	if err != nil {
+		t.Fatalf("Failed to create generator: %v", err)
+	}
+
+	cfg := &SessionConfig{Name: "dn42_4242421080", ASN: 4242421080, Interface: "dn42_1080", IPv6LinkLocal: "fe80::1080"}
+	if err := g.GenerateSession(cfg); err != nil {
+		t.Fatalf("Failed to generate session: %v", err)
+	}
+
+	if err := g.RenameSession("dn42_4242421080", "dn42_4242421080_1a2b3c4d"); err != nil {
+		t.Fatalf("RenameSession failed: %v", err)
+	}
+
+	file, err := g.ReadSession("dn42_4242421080_1a2b3c4d")
+	if err != nil {
+		t.Fatalf("ReadSession failed: %v", err)
+	}
+	if file.Protocol != "dn42_4242421080" {
+		t.Errorf("Expected protocol dn42_4242421080, got %s", file.Protocol)
+	}
+	if file.Interface != "dn42_1080" {
+		t.Errorf("Expected interface dn42_1080, got %s", file.Interface)
+	}
+
+	if _, err := g.ReadSession("dn42_4242421080"); !os.IsNotExist(err) {
+		t.Errorf("Expected legacy config to be gone, got %v", err)
+	}
+
+	// Renaming onto an existing config must fail
+	if err := g.GenerateSession(cfg); err != nil {
+		t.Fatalf("Failed to generate session: %v", err)
+	}
+	if err := g.RenameSession("dn42_4242421080", "dn42_4242421080_1a2b3c4d"); err == nil {
+		t.Error("Expected error when target config exists")
+	}
+}
+
+func TestRenderSessionTeardown(t *testing.T) {
+	g, err := NewConfigGenerator(t.TempDir(), testRenderer(t))
+	if err != nil {
+		t.Fatalf("Failed to create generator: %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		teardown   bool
+		ipv4       bool
+		exportLine string
+	}{
+		{"normal", false, false, "export filter dn42_export_filter;"},
+		{"teardown", true, true, "bgp_community.add(GRACEFUL_SHUTDOWN)"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			content, err := g.RenderSession(&SessionConfig{
+				Name:      "dn42_4242421080_1a2b3c4d",
+				ASN:       4242421080,
+				Interface: "dn42_1080",
+				Teardown:  tt.teardown,
+			})
+			if err != nil {
+				t.Fatalf("RenderSession failed: %v", err)
+			}
+			text := string(content)
+			if !strings.Contains(text, tt.exportLine) {
+				t.Errorf("Expected %q in config, got:\n%s", tt.exportLine, text)
+			}
+			// The ipv4 channel is inherited from dn42_peer and must be overridden too
+			if hasIPv4 := strings.Contains(text, "ipv4 {"); hasIPv4 != tt.ipv4 {
+				t.Errorf("Expected ipv4 channel %v, got %v", tt.ipv4, hasIPv4)
+			}
+		})
+	}
+}
+
+func TestRenderSessionPolicy(t *testing.T) {
+	g, err := NewConfigGenerator(t.TempDir(), testRenderer(t))
+	if err != nil {
+		t.Fatalf("Failed to create generator: %v", err)
+	}
+
+	tests := []struct {
+		policy     string
+		importLine string
+		exportLine string
+		wantErr    bool
+	}{
+		{"", "import filter dn42_import_filter;", "export filter dn42_export_filter;", false},
+		{"normal", "import filter dn42_import_filter;", "export filter dn42_export_filter;", false},
+		{"direct", "import filter dn42_import_filter;", "export filter dn42_export_filter_direct;", false},
+		{"Transit", "import filter dn42_import_filter_transit;", "export filter dn42_export_filter;", false},
+		{"bogus", "", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.policy, func(t *testing.T) {
+			content, err := g.RenderSession(&SessionConfig{
+				Name:      "dn42_4242421080_1a2b3c4d",
+				ASN:       4242421080,
+				Interface: "dn42_1080",
+				Policy:    tt.policy,
+			})
+			if tt.wantErr {
+				if err == nil {
+					t.Error("Expected error for unknown policy")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("RenderSession failed: %v", err)
+			}
+			text := string(content)
+			for _, line := range []string{tt.importLine, tt.exportLine} {
+				if !strings.Contains(text, line) {
+					t.Errorf("Expected %q in config, got:\n%s", line, text)
+				}
+			}
+		})
+	}
+}
+
+func TestRenderSessionTransport(t *testing.T) {
+	g, err := NewConfigGenerator(t.TempDir(), testRenderer(t))
+	if err != nil {
+		t.Fatalf("Failed to create generator: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		cfg      SessionConfig
+		contains []string
+		absent   []string
+		wantErr  bool
+	}{
+		{
+			name:     "plain",
+			cfg:      SessionConfig{IPv6LinkLocal: "fe80::1"},
+			contains: []string{"neighbor fe80::1 % 'dn42_1080' as 4242421080;"},
+			absent:   []string{"password", "multihop", "ttl security", "source address"},
+		},
+		{
+			name: "md5 and gtsm",
+			cfg:  SessionConfig{IPv6LinkLocal: "fe80::1", Password: "s3cret", TTLSecurity: true},
+			contains: []string{
+				`password "s3cret";`,
+				"ttl security on;",
+			},
+			absent: []string{"authentication ao"},
+		},
+		{
+			name: "tcp-ao",
+			cfg:  SessionConfig{IPv6LinkLocal: "fe80::1", Password: "s3cret", Authentication: "AO"},
+			contains: []string{
+				"authentication ao;",
+				`secret "s3cret";`,
+			},
+			absent: []string{"password"},
+		},
+		{
+			name: "multihop uses global address without interface",
+			cfg:  SessionConfig{IPv6LinkLocal: "fe80::1", IPv6: "fd00::1", Multihop: 2, SourceAddress: "fd00::2"},
+			contains: []string{
+				"neighbor fd00::1 as 4242421080;",
+				"multihop 2;",
+				"source address fd00::2;",
+			},
+		},
+		{name: "quote in password", cfg: SessionConfig{Password: `a"b`}, wantErr: true},
+		{name: "unknown authentication", cfg: SessionConfig{Password: "x", Authentication: "sha"}, wantErr: true},
+		{name: "multihop out of range", cfg: SessionConfig{Multihop: 256}, wantErr: true},
+		{name: "invalid source address", cfg: SessionConfig{SourceAddress: "fd00::/64"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := tt.cfg
+			cfg.Name = "dn42_4242421080_1a2b3c4d"
+			cfg.ASN = 4242421080
+			cfg.Interface = "dn42_1080"
+
+			content, err := g.RenderSession(&cfg)
+			if tt.wantErr {
+				if err == nil {
+					t.Error("Expected error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("RenderSession failed: %v", err)
+			}
+			text := string(content)
+			for _, s := range tt.contains {
+				if !strings.Contains(text, s) {
+					t.Errorf("Expected %q in config, got:\n%s", s, text)
+				}
+			}
+			for _, s := range tt.absent {
+				if strings.Contains(text, s) {
+					t.Errorf("Expected no %q in config, got:\n%s", s, text)
+				}
+			}
+		})
+	}
+}
+
+func TestRenderSessionSplitIPv4(t *testing.T) {
+	g, err := NewConfigGenerator(t.TempDir(), testRenderer(t))
+	if err != nil {
+		t.Fatalf("Failed to create generator: %v", err)
+	}
+
+	tests := []struct {
+		name      string
+		cfg       SessionConfig
+		protocols []string
+		contains  []string
+	}{
+		{
+			name:      "without mp-bgp",
+			cfg:       SessionConfig{IPv4: "172.20.0.1", IPv6LinkLocal: "fe80::1"},
+			protocols: []string{"dn42_4242421080_1a2b3c4d", "dn42_4242421080_1a2b3c4d_v4"},
+			contains: []string{
+				"protocol bgp dn42_4242421080_1a2b3c4d_v4 from dn42_peer_v4 {",
+				"neighbor 172.20.0.1 as 4242421080;",
+			},
+		},
+		{
+			name:      "with mp-bgp",
+			cfg:       SessionConfig{IPv4: "172.20.0.1", IPv6LinkLocal: "fe80::1", Extensions: []string{"mp-bgp"}},
+			protocols: []string{"dn42_4242421080_1a2b3c4d"},
+		},
+		{
+			name:      "ipv4 only",
+			cfg:       SessionConfig{IPv4: "172.20.0.1"},
+			protocols: []string{"dn42_4242421080_1a2b3c4d"},
+			contains:  []string{"neighbor 172.20.0.1 as 4242421080;"},
+		},
+		{
+			name:      "source address per family",
+			cfg:       SessionConfig{IPv4: "172.20.0.1", IPv6LinkLocal: "fe80::1", SourceAddress: "172.20.0.2"},
+			protocols: []string{"dn42_4242421080_1a2b3c4d", "dn42_4242421080_1a2b3c4d_v4"},
+			contains:  []string{"neighbor 172.20.0.1 as 4242421080;\n    description \"AS4242421080 (IPv4)\";\n    source address 172.20.0.2;"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := tt.cfg
+			cfg.Name = "dn42_4242421080_1a2b3c4d"
+			cfg.Description = "AS4242421080"
+			cfg.ASN = 4242421080
+			cfg.Interface = "dn42_1080"
+
+			content, err := g.RenderSession(&cfg)
+			if err != nil {
+				t.Fatalf("RenderSession failed: %v", err)
+			}
+			text := string(content)
+			for _, s := range tt.contains {
+				if !strings.Contains(text, s) {
+					t.Errorf("Expected %q in config, got:\n%s", s, text)
+				}
+			}
+			if strings.Count(text, "source address") > 1 {
+				t.Errorf("Expected source address on one protocol only, got:\n%s", text)
+			}
+
+			file := parseSessionFile(cfg.Name, text)
+			if strings.Join(file.Protocols, ",") != strings.Join(tt.protocols, ",") {
+				t.Errorf("Expected protocols %v, got %v", tt.protocols, file.Protocols)
+			}
+			if file.Protocol != cfg.Name {
+				t.Errorf("Expected main protocol %s, got %s", cfg.Name, file.Protocol)
+			}
+		})
+	}
+}
+
+func TestRenderSessionDescriptionQuoted(t *testing.T) {
+	g, err := NewConfigGenerator(t.TempDir(), testRenderer(t))
+	if err != nil {
+		t.Fatalf("Failed to create generator: %v", err)
+	}
+
+	content, err := g.RenderSession(&SessionConfig{
+		Name:        "dn42_4242421080_1a2b3c4d",
+		ASN:         4242421080,
+		Interface:   "dn42_1080",
+		Description: "Peer \"x\";\nprotocol bgp evil {",
+	})
+	if err != nil {
+		t.Fatalf("RenderSession failed: %v", err)
+	}
+	text := string(content)
+	for _, line := range []string{
+		"# Peer \"x\"; protocol bgp evil {\n",
+		`description "Peer \"x\"; protocol bgp evil {";`,
+	} {
+		if !strings.Contains(text, line) {
+			t.Errorf("Expected %q in config, got:\n%s", line, text)
+		}
+	}
+}
@@ -2,53 +2,135 @@ package bird
 
 import (
 	"bufio"
+	"context"
+	"errors"
 	"fmt"
 	"log"
 	"net"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
-// Pool manages a pool of BIRD control socket connections
+// DefaultAcquireTimeout is how long a command waits for a free connection
+// when the pool is at its maximum size.
+const DefaultAcquireTimeout = 10 * time.Second
+
+const (
+	// Idle connections unused for longer are checked before they are reused
+	idleCheckAfter = 10 * time.Second
+	// Bounds of the delay between dial attempts while BIRD is unreachable
+	minDialBackoff = time.Second
+	maxDialBackoff = 30 * time.Second
+	// How long a new connection may take to send the welcome line
+	welcomeTimeout = 5 * time.Second
+	// How long BIRD may take to answer a command
+	commandTimeout = 60 * time.Second
+)
+
+// ErrPoolClosed is returned by commands run after the pool was closed
+var ErrPoolClosed = errors.New("BIRD connection pool closed")
+
+// Pool manages a pool of BIRD control socket connections. Connections are
+// dialed on demand, so the agent starts and keeps running while BIRD is
+// down. Idle connections are checked before reuse, and all of them are
+// dropped as soon as one turns out dead, since a BIRD restart closes every
+// connection.
 type Pool struct {
-	socket      string
-	poolSize    int
-	maxSize     int
-	connections chan *Conn
-	mu          sync.Mutex
-	closed      bool
+	socket   string
+	poolSize int
+	maxSize  int
+
+	slots chan struct{} // One token per connection in use
+
+	mu             sync.Mutex
+	idle           []*Conn
+	open           int // Connections idle or in use
+	closed         bool
+	acquireTimeout time.Duration
+	minBackoff     time.Duration
+	maxBackoff     time.Duration
+	commandTimeout time.Duration
+	backoff        time.Duration // Current dial backoff, 0 while BIRD is reachable
+	nextDial       time.Time     // Earliest time of the next dial attempt
+
+	waits  atomic.Uint64
+	errors atomic.Uint64
+
+	reconfigurer *Reconfigurer
+
+	safeApplyTimeout time.Duration
+	safeApplyCheck   ApplyCheck // nil unless safe-apply mode is enabled
 }
 
 // Conn represents a single BIRD control socket connection
 type Conn struct {
-	conn   net.Conn
-	reader *bufio.Reader
+	conn     net.Conn
+	reader   *bufio.Reader
+	lastUsed time.Time
+}
+
+// PoolStats describes the state of the connection pool
+type PoolStats struct {
+	Open   int    // Connections idle or in use
+	Idle   int    // Connections waiting to be reused
+	Waits  uint64 // Commands that had to wait for a free connection
+	Errors uint64 // Failed dials and dead connections
 }
 
-// NewPool creates a new BIRD connection pool
+// NewPool creates a new BIRD connection pool and opens up to poolSize
+// connections. BIRD being unreachable is not an error: connections are
+// dialed once it is up.
 func NewPool(socket string, poolSize, maxSize int) (*Pool, error) {
+	if maxSize < 1 || poolSize < 0 || poolSize > maxSize {
+		return nil, fmt.Errorf("invalid pool size %d (max %d)", poolSize, maxSize)
+	}
+
 	p := &Pool{
-		socket:      socket,
-		poolSize:    poolSize,
-		maxSize:     maxSize,
-		connections: make(chan *Conn, maxSize),
+		socket:         socket,
+		poolSize:       poolSize,
+		maxSize:        maxSize,
+		slots:          make(chan struct{}, maxSize),
+		acquireTimeout: DefaultAcquireTimeout,
+		minBackoff:     minDialBackoff,
+		maxBackoff:     maxDialBackoff,
+		commandTimeout: commandTimeout,
 	}
+	p.reconfigurer = NewReconfigurer(p, DefaultReconfigureDebounce)
 
 	// Pre-populate pool with initial connections
 	for i := 0; i < poolSize; i++ {
-		conn, err := p.newConn()
+		conn, err := p.dial()
 		if err != nil {
-			// Close any already-created connections
-			p.Close()
-			return nil, fmt.Errorf("failed to create initial connection: %w", err)
+			log.Printf("[BIRD] Warning: %v, connecting on demand", err)
+			break
 		}
-		p.connections <- conn
+		p.idle = append(p.idle, conn)
 	}
 
 	return p, nil
 }
 
+// SetAcquireTimeout sets how long a command waits for a free connection
+func (p *Pool) SetAcquireTimeout(timeout time.Duration) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.acquireTimeout = timeout
+}
+
+// Stats returns the current connection counts of the pool
+func (p *Pool) Stats() PoolStats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return PoolStats{
+		Open:   p.open,
+		Idle:   len(p.idle),
+		Waits:  p.waits.Load(),
+		Errors: p.errors.Load(),
+	}
+}
+
 // newConn creates a new connection to the BIRD socket
 func (p *Pool) newConn() (*Conn, error) {
 	conn, err := net.DialTimeout("unix", p.socket, 5*time.Second)
@@ -62,83 +144,205 @@ func (p *Pool) newConn() (*Conn, error) {
 	}
 
 	// Read the welcome message
+	conn.SetReadDeadline(time.Now().Add(welcomeTimeout))
 	if _, err := c.readResponse(); err != nil {
 		conn.Close()
 		return nil, fmt.Errorf("failed to read welcome: %w", err)
 	}
+	conn.SetReadDeadline(time.Time{})
 
 	return c, nil
 }
 
-// acquire gets a connection from the pool
-func (p *Pool) acquire() (*Conn, error) {
+// dial opens a new connection unless a previous failure set a backoff that
+// has not expired yet. Failures double the backoff, a success resets it.
+func (p *Pool) dial() (*Conn, error) {
+	p.mu.Lock()
+	if wait := time.Until(p.nextDial); wait > 0 {
+		p.mu.Unlock()
+		return nil, fmt.Errorf("BIRD socket %s unreachable, next attempt in %v", p.socket, wait.Round(time.Millisecond))
+	}
+	p.mu.Unlock()
+
+	conn, err := p.newConn()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if err != nil {
+		p.errors.Add(1)
+		p.backoff = min(max(2*p.backoff, p.minBackoff), p.maxBackoff)
+		p.nextDial = time.Now().Add(p.backoff)
+		return nil, fmt.Errorf("BIRD socket %s unreachable: %w", p.socket, err)
+	}
+	if p.backoff > 0 {
+		log.Printf("[BIRD] Reconnected to %s", p.socket)
+	}
+	p.backoff = 0
+	p.nextDial = time.Time{}
+	if p.closed {
+		conn.conn.Close()
+		return nil, ErrPoolClosed
+	}
+	p.open++
+	return conn, nil
+}
+
+// acquire gets a connection from the pool, waiting for a free one until ctx
+// is done if the pool is at its maximum size
+func (p *Pool) acquire(ctx context.Context) (*Conn, error) {
 	select {
-	case conn := <-p.connections:
-		return conn, nil
+	case p.slots <- struct{}{}:
 	default:
-		// Pool empty, try to create new connection
+		p.waits.Add(1)
+		select {
+		case p.slots <- struct{}{}:
+		case <-ctx.Done():
+			return nil, fmt.Errorf("no free BIRD connection: %w", ctx.Err())
+		}
+	}
+
+	conn, err := p.take()
+	if err != nil {
+		<-p.slots
+		return nil, err
+	}
+	return conn, nil
+}
+
+// take returns a live idle connection, or dials a new one if there is none.
+// The caller holds a slot.
+func (p *Pool) take() (*Conn, error) {
+	for {
 		p.mu.Lock()
-		if len(p.connections) < p.maxSize {
+		if p.closed {
 			p.mu.Unlock()
-			return p.newConn()
+			return nil, ErrPoolClosed
 		}
+		n := len(p.idle)
+		if n == 0 {
+			p.mu.Unlock()
+			return p.dial()
+		}
+		conn := p.idle[n-1]
+		p.idle = p.idle[:n-1]
 		p.mu.Unlock()
-		// Wait for a connection
-		return <-p.connections, nil
+
+		if time.Since(conn.lastUsed) < idleCheckAfter || conn.alive() {
+			return conn, nil
+		}
+		p.errors.Add(1)
+		p.close(conn)
+		p.flushIdle()
 	}
 }
 
 // release returns a connection to the pool
 func (p *Pool) release(conn *Conn) {
-	if conn == nil {
-		return
-	}
+	conn.lastUsed = time.Now()
 	p.mu.Lock()
-	defer p.mu.Unlock()
 	if p.closed {
-		conn.conn.Close()
-		return
+		p.mu.Unlock()
+		p.close(conn)
+	} else {
+		p.idle = append(p.idle, conn)
+		p.mu.Unlock()
 	}
-	select {
-	case p.connections <- conn:
-	default:
-		// Pool full, close excess connection
+	<-p.slots
+}
+
+// discard closes a broken connection without returning it to the pool. The
+// idle connections are dropped too, as BIRD has most likely restarted.
+func (p *Pool) discard(conn *Conn) {
+	p.errors.Add(1)
+	p.close(conn)
+	p.flushIdle()
+	<-p.slots
+}
+
+// close closes a connection and forgets it
+func (p *Pool) close(conn *Conn) {
+	conn.conn.Close()
+	p.mu.Lock()
+	p.open--
+	p.mu.Unlock()
+}
+
+// flushIdle closes all idle connections
+func (p *Pool) flushIdle() {
+	p.mu.Lock()
+	idle := p.idle
+	p.idle = nil
+	p.open -= len(idle)
+	p.mu.Unlock()
+
+	for _, conn := range idle {
 		conn.conn.Close()
 	}
+	if len(idle) > 0 {
+		log.Printf("[BIRD] Connection lost, dropped %d idle connections", len(idle))
+	}
 }
 
-// Close closes all connections in the pool
+// Close closes all connections in the pool. Connections in use are closed
+// when they are released.
 func (p *Pool) Close() {
 	p.mu.Lock()
 	p.closed = true
+	idle := p.idle
+	p.idle = nil
+	p.open -= len(idle)
 	p.mu.Unlock()
 
-	close(p.connections)
-	for conn := range p.connections {
+	for _, conn := range idle {
 		conn.conn.Close()
 	}
 }
 
+// alive reports whether an idle connection is still open. BIRD sends
+// nothing between replies, so any outcome but a read timeout means the
+// connection is closed or out of sync.
+func (c *Conn) alive() bool {
+	c.conn.SetReadDeadline(time.Now().Add(time.Millisecond))
+	defer c.conn.SetReadDeadline(time.Time{})
+
+	_, err := c.reader.Peek(1)
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
 // Execute runs a BIRD command and returns the response
 // It will retry once with a new connection if the first attempt fails (e.g., broken pipe)
 func (p *Pool) Execute(cmd string) (string, error) {
-	return p.executeWithRetry(cmd, 1)
+	p.mu.Lock()
+	timeout := p.acquireTimeout
+	p.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return p.executeWithRetry(ctx, cmd, 1)
 }
 
 // executeWithRetry attempts to execute a command with retry support
-func (p *Pool) executeWithRetry(cmd string, retries int) (string, error) {
-	conn, err := p.acquire()
+func (p *Pool) executeWithRetry(ctx context.Context, cmd string, retries int) (string, error) {
+	conn, err := p.acquire(ctx)
 	if err != nil {
 		return "", fmt.Errorf("failed to acquire connection: %w", err)
 	}
 
+	// A hung BIRD must not block the command, and the task waiting for it,
+	// forever
+	p.mu.Lock()
+	timeout := p.commandTimeout
+	p.mu.Unlock()
+	conn.conn.SetDeadline(time.Now().Add(timeout))
+
 	// Send command
 	if _, err := fmt.Fprintf(conn.conn, "%s\n", cmd); err != nil {
 		// Connection broken, discard and retry
 		p.discard(conn)
 		if retries > 0 {
 			log.Printf("[BIRD] Connection error, retrying: %v", err)
-			return p.executeWithRetry(cmd, retries-1)
+			return p.executeWithRetry(ctx, cmd, retries-1)
 		}
 		return "", fmt.Errorf("failed to send command: %w", err)
 	}
@@ -146,59 +350,116 @@ func (p *Pool) executeWithRetry(cmd string, retries int) (string, error) {
 	// Read response
 	result, err := conn.readResponse()
 	if err != nil {
-		// Connection broken, discard and retry
+		// Connection broken or out of sync with the replies, discard it
 		p.discard(conn)
+		var netErr net.Error
+		if errors.As(err, &netErr) && netErr.Timeout() {
+			// Not retried: BIRD may still run the command, and would most
+			// likely not answer the retry either
+			return "", fmt.Errorf("no response from BIRD within %v", timeout)
+		}
 		if retries > 0 {
 			log.Printf("[BIRD] Read error, retrying: %v", err)
-			return p.executeWithRetry(cmd, retries-1)
+			return p.executeWithRetry(ctx, cmd, retries-1)
 		}
 		return "", fmt.Errorf("failed to read response: %w", err)
 	}
 
 	// Success - return connection to pool
+	conn.conn.SetDeadline(time.Time{})
 	p.release(conn)
 	return result, nil
 }
 
-// discard closes a broken connection without returning it to the pool
-func (p *Pool) discard(conn *Conn) {
-	if conn != nil && conn.conn != nil {
-		conn.conn.Close()
+// Command runs a BIRD command and parses the reply. Errors reported by BIRD
+// are returned as *ReplyError, along with the reply.
+func (p *Pool) Command(cmd string) (*Reply, error) {
+	raw, err := p.Execute(cmd)
+	if err != nil {
+		return nil, err
 	}
+	reply := ParseReply(raw)
+	return reply, reply.Err()
 }
 
 // Configure triggers BIRD to reload configuration
 func (p *Pool) Configure() error {
-	result, err := p.Execute("configure")
+	if _, err := p.Command("configure"); err != nil {
+		return fmt.Errorf("configure failed: %w", err)
+	}
+	return nil
+}
+
+// CheckConfig parses a config file without applying it. Errors in the file
+// are returned as *ReplyError.
+func (p *Pool) CheckConfig(path string) error {
+	_, err := p.Command(fmt.Sprintf("configure check \"%s\"", path))
+	return err
+}
+
+// Reconfigure marks the BIRD config dirty and waits for the coalesced
+// configure that applies it. Tasks use this instead of Configure, so a burst
+// of config changes reloads BIRD once.
+func (p *Pool) Reconfigure(ctx context.Context) error {
+	return p.reconfigurer.Request(ctx)
+}
+
+// SetReconfigureDebounce sets how long Reconfigure waits for further
+// requests before BIRD is reconfigured
+func (p *Pool) SetReconfigureDebounce(debounce time.Duration) {
+	p.reconfigurer.SetDebounce(debounce)
+}
+
+// ShowProtocols returns all protocols of 'show protocols'
+func (p *Pool) ShowProtocols() ([]Protocol, error) {
+	reply, err := p.Command("show protocols")
+	if err != nil {
+		return nil, err
+	}
+	return parseProtocols(reply), nil
+}
+
+// ShowProtocolDetail returns the details of a protocol, including the route
+// counts of its channels. ErrProtocolNotFound is returned if BIRD has no
+// protocol of that name.
+func (p *Pool) ShowProtocolDetail(name string) (*ProtocolDetail, error) {
+	reply, err := p.Command("show protocols all " + name)
+	var replyErr *ReplyError
+	if errors.As(err, &replyErr) && replyErr.Code == codeNoProtocols {
+		return nil, ErrProtocolNotFound
+	}
 	if err != nil {
-		return err
-	}
-	// BIRD 3.x responses may include multiple lines from connection pool reuse.
-	// Check for explicit error codes (8xxx = runtime error, 9xxx = parse error)
-	// Success codes: 0002 (info), 0003 (success), 0018 (restart)
-	if strings.Contains(result, "Reconfigured") ||
-		strings.Contains(result, "Reconfiguration in progress") ||
-		strings.Contains(result, "0003 ") ||
-		strings.Contains(result, "0018 ") ||
-		strings.Contains(result, "0002-") {
-		return nil
-	}
-	// Only fail on explicit error codes
-	if strings.Contains(result, "8") || strings.Contains(result, "9") {
-		for _, line := range strings.Split(result, "\n") {
-			if len(line) >= 4 && (line[0] == '8' || line[0] == '9') {
-				return fmt.Errorf("configure failed: %s", line)
-			}
+		return nil, err
+	}
+	for _, detail := range parseProtocolDetails(reply) {
+		if detail.Name == name {
+			return &detail, nil
 		}
 	}
-	// Log and accept if we don't see explicit errors
-	log.Printf("[BIRD] Configure response (assumed success): %s", strings.TrimSpace(result))
-	return nil
+	return nil, ErrProtocolNotFound
+}
+
+// ShowRoute returns all routes for a prefix or address, with their
+// attributes. A network BIRD has no route for yields no routes.
+func (p *Pool) ShowRoute(prefix string) ([]Route, error) {
+	reply, err := p.Command(fmt.Sprintf("show route for %s all", prefix))
+	var replyErr *ReplyError
+	if errors.As(err, &replyErr) && replyErr.Code == codeNetworkNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return parseRoutes(reply), nil
 }
 
-// ShowProtocols returns the output of 'show protocols'
-func (p *Pool) ShowProtocols() (string, error) {
-	return p.Execute("show protocols")
+// ShowBabelNeighbors returns the neighbours of all Babel protocols
+func (p *Pool) ShowBabelNeighbors() ([]BabelNeighbor, error) {
+	reply, err := p.Command("show babel neighbors")
+	if err != nil {
+		return nil, err
+	}
+	return parseBabelNeighbors(reply), nil
 }
 
 // readResponse reads a complete BIRD response
@@ -212,8 +473,9 @@ func (c *Conn) readResponse() (string, error) {
 		result.WriteString(line)
 
 		// BIRD responses end with a line starting with 4 digits and a space
-		// (e.g., "0001 BIRD 3.0.0 ready.\n")
-		if len(line) >= 5 && line[4] == ' ' {
+		// (e.g., "0001 BIRD 3.0.0 ready.\n"). Continuation lines start with
+		// a space and may be indented deep enough to put a space at [4].
+		if len(line) >= 5 && isReplyCode(line[:4]) && line[4] == ' ' {
 			break
 		}
 	}
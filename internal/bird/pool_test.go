@@ -0,0 +1,304 @@
+package bird
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeBird serves the BIRD control protocol on a unix socket
+type fakeBird struct {
+	listener net.Listener
+
+	mu       sync.Mutex
+	conns    []net.Conn
+	commands []string
+}
+
+func startFakeBird(t *testing.T, path string) *fakeBird {
+	t.Helper()
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatalf("Failed to listen on %s: %v", path, err)
+	}
+	f := &fakeBird{listener: listener}
+	go f.serve()
+	t.Cleanup(f.stop)
+	return f
+}
+
+func (f *fakeBird) serve() {
+	for {
+		conn, err := f.listener.Accept()
+		if err != nil {
+			return
+		}
+		f.mu.Lock()
+		f.conns = append(f.conns, conn)
+		f.mu.Unlock()
+		go f.handle(conn)
+	}
+}
+
+func (f *fakeBird) handle(conn net.Conn) {
+	defer conn.Close()
+	conn.Write([]byte("0001 BIRD 3.0.0 ready.\n"))
+	reader := bufio.NewReader(conn)
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return
+		}
+		cmd := strings.TrimSpace(line)
+		f.mu.Lock()
+		f.commands = append(f.commands, cmd)
+		f.mu.Unlock()
+		switch {
+		case cmd == "configure", strings.HasPrefix(cmd, "configure timeout "):
+			conn.Write([]byte("0002-Reading configuration from /etc/bird/bird.conf\n0003 Reconfigured\n"))
+		case cmd == "configure confirm":
+			conn.Write([]byte("0018 Reconfiguration confirmed\n"))
+		case cmd == "configure undo":
+			conn.Write([]byte("0021 Undo requested\n"))
+		case cmd == "show protocols all dn42_4242420919_1a2b3c4d":
+			conn.Write([]byte(showProtocolsAllReply))
+		case cmd == "hang":
+			// BIRD stuck in a long operation, no reply
+		case cmd == "show status":
+			conn.Write([]byte("1000-BIRD 3.0.0\n0013 Daemon is up and running\n"))
+		default:
+			conn.Write([]byte("9001 syntax error\n"))
+		}
+	}
+}
+
+// configures returns the configure commands received so far
+func (f *fakeBird) configures() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var cmds []string
+	for _, cmd := range f.commands {
+		if strings.HasPrefix(cmd, "configure") {
+			cmds = append(cmds, cmd)
+		}
+	}
+	return cmds
+}
+
+// stop closes the socket and all connections, like a BIRD shutdown
+func (f *fakeBird) stop() {
+	f.listener.Close()
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, conn := range f.conns {
+		conn.Close()
+	}
+	f.conns = nil
+}
+
+func TestPoolExecute(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bird.ctl")
+	startFakeBird(t, path)
+
+	p, err := NewPool(path, 2, 4)
+	if err != nil {
+		t.Fatalf("NewPool failed: %v", err)
+	}
+	defer p.Close()
+
+	if stats := p.Stats(); stats.Open != 2 || stats.Idle != 2 {
+		t.Errorf("Expected 2 open and idle connections, got %+v", stats)
+	}
+	if err := p.Configure(); err != nil {
+		t.Errorf("Expected configure to succeed, got %v", err)
+	}
+	if _, err := p.Command("bogus"); err == nil {
+		t.Error("Expected BIRD error for unknown command")
+	}
+	if stats := p.Stats(); stats.Open != 2 || stats.Errors != 0 {
+		t.Errorf("Expected connections to be reused, got %+v", stats)
+	}
+}
+
+func TestPoolReadsMultilineReply(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bird.ctl")
+	startFakeBird(t, path)
+
+	// A single connection, so the second command reuses the first one
+	p, err := NewPool(path, 1, 1)
+	if err != nil {
+		t.Fatalf("NewPool failed: %v", err)
+	}
+	defer p.Close()
+
+	detail, err := p.ShowProtocolDetail("dn42_4242420919_1a2b3c4d")
+	if err != nil {
+		t.Fatalf("ShowProtocolDetail failed: %v", err)
+	}
+	if len(detail.Channels) != 2 || detail.Channels[1].Routes.Imported != 1024 {
+		t.Errorf("Expected the full reply with route stats, got %+v", detail.Channels)
+	}
+
+	reply, err := p.Command("show status")
+	if err != nil {
+		t.Fatalf("Command failed: %v", err)
+	}
+	if last := reply.Lines[len(reply.Lines)-1]; last.Code != 13 {
+		t.Errorf("Expected the reply of show status, got %+v", reply.Lines)
+	}
+}
+
+func TestPoolStartsWithoutBird(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bird.ctl")
+
+	p, err := NewPool(path, 2, 4)
+	if err != nil {
+		t.Fatalf("Expected pool without BIRD, got %v", err)
+	}
+	defer p.Close()
+	p.mu.Lock()
+	p.minBackoff = 100 * time.Millisecond
+	p.backoff, p.nextDial = 0, time.Time{}
+	p.mu.Unlock()
+
+	if _, err := p.Execute("show status"); err == nil {
+		t.Error("Expected error while BIRD is down")
+	}
+	if stats := p.Stats(); stats.Open != 0 || stats.Errors == 0 {
+		t.Errorf("Expected no connections and dial errors, got %+v", stats)
+	}
+
+	// Dials are held back until the backoff expires
+	startFakeBird(t, path)
+	if _, err := p.Execute("show status"); err == nil || !strings.Contains(err.Error(), "next attempt") {
+		t.Errorf("Expected backoff error, got %v", err)
+	}
+
+	time.Sleep(150 * time.Millisecond)
+	if _, err := p.Execute("show status"); err != nil {
+		t.Errorf("Expected command to succeed once BIRD is up, got %v", err)
+	}
+	if stats := p.Stats(); stats.Open != 1 || stats.Idle != 1 {
+		t.Errorf("Expected 1 open connection, got %+v", stats)
+	}
+}
+
+func TestPoolReconnectsAfterRestart(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bird.ctl")
+	bird := startFakeBird(t, path)
+
+	p, err := NewPool(path, 3, 4)
+	if err != nil {
+		t.Fatalf("NewPool failed: %v", err)
+	}
+	defer p.Close()
+
+	bird.stop()
+	startFakeBird(t, path)
+
+	// The first stale connection fails, the others are dropped with it
+	if _, err := p.Execute("show status"); err != nil {
+		t.Errorf("Expected command to succeed after restart, got %v", err)
+	}
+	if stats := p.Stats(); stats.Open != 1 || stats.Errors != 1 {
+		t.Errorf("Expected 1 open connection and 1 error, got %+v", stats)
+	}
+}
+
+func TestPoolEvictsDeadIdleConnections(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bird.ctl")
+	bird := startFakeBird(t, path)
+
+	p, err := NewPool(path, 2, 4)
+	if err != nil {
+		t.Fatalf("NewPool failed: %v", err)
+	}
+	defer p.Close()
+
+	bird.stop()
+	startFakeBird(t, path)
+	for _, conn := range p.idle {
+		conn.lastUsed = time.Now().Add(-2 * idleCheckAfter)
+	}
+
+	conn, err := p.acquire(context.Background())
+	if err != nil {
+		t.Fatalf("Expected a new connection, got %v", err)
+	}
+	if !conn.alive() {
+		t.Error("Expected a live connection")
+	}
+	p.release(conn)
+
+	if stats := p.Stats(); stats.Open != 1 || stats.Errors != 1 {
+		t.Errorf("Expected dead connections to be evicted, got %+v", stats)
+	}
+}
+
+func TestPoolAcquireTimeout(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bird.ctl")
+	startFakeBird(t, path)
+
+	p, err := NewPool(path, 1, 1)
+	if err != nil {
+		t.Fatalf("NewPool failed: %v", err)
+	}
+	defer p.Close()
+	p.SetAcquireTimeout(20 * time.Millisecond)
+
+	conn, err := p.acquire(context.Background())
+	if err != nil {
+		t.Fatalf("Failed to acquire connection: %v", err)
+	}
+	if _, err := p.Execute("show status"); err == nil {
+		t.Error("Expected timeout while the only connection is in use")
+	}
+	p.release(conn)
+
+	if _, err := p.Execute("show status"); err != nil {
+		t.Errorf("Expected command to succeed after release, got %v", err)
+	}
+	if stats := p.Stats(); stats.Waits != 1 {
+		t.Errorf("Expected 1 wait, got %d", stats.Waits)
+	}
+}
+
+func TestPoolCommandTimeout(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bird.ctl")
+	startFakeBird(t, path)
+
+	p, err := NewPool(path, 1, 1)
+	if err != nil {
+		t.Fatalf("NewPool failed: %v", err)
+	}
+	defer p.Close()
+	p.mu.Lock()
+	p.commandTimeout = 50 * time.Millisecond
+	p.mu.Unlock()
+
+	if _, err := p.Execute("hang"); err == nil || !strings.Contains(err.Error(), "no response") {
+		t.Errorf("Expected timeout error, got %v", err)
+	}
+	if stats := p.Stats(); stats.Open != 0 || stats.Errors != 1 {
+		t.Errorf("Expected the timed out connection to be discarded, got %+v", stats)
+	}
+
+	// The next command gets a fresh connection in sync with BIRD
+	if _, err := p.Execute("show status"); err != nil {
+		t.Errorf("Expected command to succeed after the timeout, got %v", err)
+	}
+}
+
+func TestNewPoolInvalidSize(t *testing.T) {
+	if _, err := NewPool("/nonexistent", 5, 2); err == nil {
+		t.Error("Expected error for pool size above maximum")
+	}
+	if _, err := NewPool("/nonexistent", 0, 0); err == nil {
+		t.Error("Expected error for zero maximum")
+	}
+}
@@ -0,0 +1,94 @@
+package bird
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+)
+
+// DefaultReconfigureDebounce is how long a reconfigure request waits for
+// further requests before BIRD is reconfigured.
+const DefaultReconfigureDebounce = 500 * time.Millisecond
+
+// Reconfigurer coalesces BIRD reconfigures. Callers mark the config dirty
+// with Request after writing their files; all requests that arrive within
+// the debounce window are served by a single configure, and every caller
+// receives its outcome. Configures never run concurrently: requests made
+// while BIRD is being reconfigured wait for the next round, so files written
+// after a configure started are always picked up.
+type Reconfigurer struct {
+	configure func() error
+	debounce  time.Duration
+
+	mu      sync.Mutex
+	waiters []chan error // Callers of the next configure
+	timer   *time.Timer  // Pending debounce, nil if none
+	running bool         // A configure is in progress
+}
+
+// NewReconfigurer creates a reconfigure coordinator for a BIRD pool.
+func NewReconfigurer(pool *Pool, debounce time.Duration) *Reconfigurer {
+	return &Reconfigurer{
+		configure: pool.apply,
+		debounce:  debounce,
+	}
+}
+
+// SetDebounce changes the debounce window of later requests.
+func (r *Reconfigurer) SetDebounce(debounce time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.debounce = debounce
+}
+
+// Request marks the BIRD config dirty and waits for the configure that
+// applies it. If ctx ends first, ctx.Err() is returned; the configure still
+// runs for the other callers.
+func (r *Reconfigurer) Request(ctx context.Context) error {
+	done := make(chan error, 1)
+
+	r.mu.Lock()
+	r.waiters = append(r.waiters, done)
+	r.schedule()
+	r.mu.Unlock()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// schedule starts the debounce timer unless one is pending or a configure
+// is running, which schedules the next round itself. Must hold mu.
+func (r *Reconfigurer) schedule() {
+	if r.timer != nil || r.running || len(r.waiters) == 0 {
+		return
+	}
+	r.timer = time.AfterFunc(r.debounce, r.run)
+}
+
+// run performs one configure for all callers collected so far.
+func (r *Reconfigurer) run() {
+	r.mu.Lock()
+	waiters := r.waiters
+	r.waiters = nil
+	r.timer = nil
+	r.running = true
+	r.mu.Unlock()
+
+	err := r.configure()
+	if len(waiters) > 1 {
+		log.Printf("[BIRD] Coalesced %d reconfigure requests", len(waiters))
+	}
+	for _, done := range waiters {
+		done <- err
+	}
+
+	r.mu.Lock()
+	r.running = false
+	r.schedule()
+	r.mu.Unlock()
+}
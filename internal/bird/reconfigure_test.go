@@ -0,0 +1,107 @@
+package bird
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestReconfigurerCoalesces(t *testing.T) {
+	var calls atomic.Int32
+	r := &Reconfigurer{
+		configure: func() error {
+			calls.Add(1)
+			return nil
+		},
+		debounce: 20 * time.Millisecond,
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 30)
+	for i := 0; i < 30; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- r.Request(context.Background())
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			t.Errorf("Expected no error, got %v", err)
+		}
+	}
+	if n := calls.Load(); n != 1 {
+		t.Errorf("Expected 1 configure, got %d", n)
+	}
+}
+
+func TestReconfigurerReportsError(t *testing.T) {
+	want := errors.New("configure failed")
+	r := &Reconfigurer{
+		configure: func() error { return want },
+		debounce:  time.Millisecond,
+	}
+
+	if err := r.Request(context.Background()); !errors.Is(err, want) {
+		t.Errorf("Expected %v, got %v", want, err)
+	}
+}
+
+func TestReconfigurerRequestDuringConfigure(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	var calls, running atomic.Int32
+	r := &Reconfigurer{
+		configure: func() error {
+			if running.Add(1) > 1 {
+				t.Error("Expected configures not to overlap")
+			}
+			defer running.Add(-1)
+			if calls.Add(1) == 1 {
+				close(started)
+				<-release
+			}
+			return nil
+		},
+		debounce: time.Millisecond,
+	}
+
+	first := make(chan error, 1)
+	go func() { first <- r.Request(context.Background()) }()
+	<-started
+
+	// Files written now are not covered by the running configure
+	second := make(chan error, 1)
+	go func() { second <- r.Request(context.Background()) }()
+	time.Sleep(10 * time.Millisecond)
+	close(release)
+
+	if err := <-first; err != nil {
+		t.Errorf("Expected no error, got %v", err)
+	}
+	if err := <-second; err != nil {
+		t.Errorf("Expected no error, got %v", err)
+	}
+	if n := calls.Load(); n != 2 {
+		t.Errorf("Expected 2 configures, got %d", n)
+	}
+}
+
+func TestReconfigurerContextCancel(t *testing.T) {
+	r := &Reconfigurer{
+		configure: func() error { return nil },
+		debounce:  time.Hour,
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := r.Request(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+}
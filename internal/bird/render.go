@@ -0,0 +1,133 @@
+package bird
+
+import (
+	"bytes"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+)
+
+// Templates of the rendered BIRD config files. The defaults are embedded in
+// the binary; a file of the same name in the override directory replaces one.
+const (
+	TemplateSession     = "session.conf.tmpl"            // peers/<session>.conf
+	TemplateIBGPPeer    = "ibgp_peer.conf.tmpl"          // ibgp.d/ibgp_<node>.conf
+	TemplateBirdConf    = "bird.conf.tmpl"               // bird.conf
+	TemplateFilters     = "filters.conf.tmpl"            // filters.conf
+	TemplateCommunities = "moenet_communities.conf.tmpl" // moenet_communities.conf
+	TemplateBabel       = "babel.conf.tmpl"              // babel.conf
+	TemplateColdPotato  = "cold_potato.conf.tmpl"        // cold_potato.conf
+)
+
+//go:embed templates/*.tmpl
+var defaultTemplates embed.FS
+
+// templateFuncs are the helpers available to all templates.
+var templateFuncs = template.FuncMap{
+	"birdString": birdString,
+	"comment":    comment,
+}
+
+// Renderer renders the BIRD config files from the embedded templates and
+// the operator overrides.
+type Renderer struct {
+	templates map[string]*template.Template
+	overrides []string // Names of the overridden templates
+}
+
+// NewRenderer parses the embedded templates and the overrides in
+// overrideDir. An empty or missing overrideDir uses the embedded templates
+// only. An override that fails to parse is an error, so a broken template
+// is caught at startup rather than on the first render.
+func NewRenderer(overrideDir string) (*Renderer, error) {
+	names, err := fs.Glob(defaultTemplates, "templates/*.tmpl")
+	if err != nil {
+		return nil, err
+	}
+
+	r := &Renderer{templates: make(map[string]*template.Template, len(names))}
+	for _, path := range names {
+		name := filepath.Base(path)
+		content, err := defaultTemplates.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+
+		if overrideDir != "" {
+			override, err := os.ReadFile(filepath.Join(overrideDir, name))
+			switch {
+			case err == nil:
+				content = override
+				r.overrides = append(r.overrides, name)
+			case !errors.Is(err, fs.ErrNotExist):
+				return nil, fmt.Errorf("failed to read template override %s: %w", name, err)
+			}
+		}
+
+		tmpl, err := template.New(name).Funcs(templateFuncs).Parse(string(content))
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse template %s: %w", name, err)
+		}
+		r.templates[name] = tmpl
+	}
+
+	if overrideDir != "" {
+		r.warnUnknownOverrides(overrideDir)
+	}
+	for _, name := range r.overrides {
+		log.Printf("[BIRD] Using template override %s", filepath.Join(overrideDir, name))
+	}
+	return r, nil
+}
+
+// warnUnknownOverrides logs template files in overrideDir that do not
+// replace any template, which usually are misspelt names.
+func (r *Renderer) warnUnknownOverrides(overrideDir string) {
+	entries, err := os.ReadDir(overrideDir)
+	if err != nil {
+		return
+	}
+	for _, entry := range entries {
+		name := entry.Name()
+		if strings.HasSuffix(name, ".tmpl") && r.templates[name] == nil {
+			log.Printf("[BIRD] Warning: unknown template override %s ignored", filepath.Join(overrideDir, name))
+		}
+	}
+}
+
+// Overrides returns the names of the templates replaced by overrides.
+func (r *Renderer) Overrides() []string {
+	return append([]string(nil), r.overrides...)
+}
+
+// Render executes a template.
+func (r *Renderer) Render(name string, data any) ([]byte, error) {
+	tmpl := r.templates[name]
+	if tmpl == nil {
+		return nil, fmt.Errorf("unknown template %s", name)
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return nil, fmt.Errorf("failed to render %s: %w", name, err)
+	}
+	return buf.Bytes(), nil
+}
+
+// birdString quotes a string for use in a BIRD config.
+func birdString(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, `"`, `\"`)
+	return `"` + comment(s) + `"`
+}
+
+// comment makes a string safe for a single config line, such as a comment.
+func comment(s string) string {
+	return strings.NewReplacer("\r", " ", "\n", " ").Replace(s)
+}
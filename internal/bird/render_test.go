@@ -0,0 +1,109 @@
+package bird
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// testRenderer returns a renderer with the embedded templates
+func testRenderer(t *testing.T) *Renderer {
+	t.Helper()
+	r, err := NewRenderer("")
+	if err != nil {
+		t.Fatalf("NewRenderer failed: %v", err)
+	}
+	return r
+}
+
+func TestNewRendererEmbedded(t *testing.T) {
+	r := testRenderer(t)
+
+	for _, name := range []string{
+		TemplateSession, TemplateIBGPPeer, TemplateBirdConf, TemplateFilters,
+		TemplateCommunities, TemplateBabel, TemplateColdPotato,
+	} {
+		if r.templates[name] == nil {
+			t.Errorf("Expected embedded template %s", name)
+		}
+	}
+	if len(r.Overrides()) != 0 {
+		t.Errorf("Expected no overrides, got %v", r.Overrides())
+	}
+	if _, err := r.Render("missing.conf.tmpl", nil); err == nil {
+		t.Error("Expected error for unknown template")
+	}
+}
+
+func TestNewRendererOverrides(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, TemplateBabel), []byte("# custom babel for {{.Name}}\n"), 0644)
+	os.WriteFile(filepath.Join(dir, "babel.tmpl"), []byte("misspelt"), 0644)
+
+	r, err := NewRenderer(dir)
+	if err != nil {
+		t.Fatalf("NewRenderer failed: %v", err)
+	}
+	if got := r.Overrides(); !reflect.DeepEqual(got, []string{TemplateBabel}) {
+		t.Errorf("Expected babel override, got %v", got)
+	}
+
+	content, err := r.Render(TemplateBabel, map[string]string{"Name": "node1"})
+	if err != nil {
+		t.Fatalf("Render failed: %v", err)
+	}
+	if string(content) != "# custom babel for node1\n" {
+		t.Errorf("Expected override content, got %q", content)
+	}
+
+	// Templates without override keep the embedded default
+	content, err = r.Render(TemplateSession, sessionTestData)
+	if err != nil {
+		t.Fatalf("Render failed: %v", err)
+	}
+	if !strings.Contains(string(content), generatedMarker) {
+		t.Errorf("Expected embedded session template, got %q", content)
+	}
+}
+
+func TestNewRendererInvalidOverride(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, TemplateFilters), []byte("{{if .Node}}"), 0644)
+
+	if _, err := NewRenderer(dir); err == nil {
+		t.Error("Expected error for unparsable override")
+	}
+}
+
+func TestNewRendererMissingOverrideDir(t *testing.T) {
+	if _, err := NewRenderer(filepath.Join(t.TempDir(), "missing")); err != nil {
+		t.Errorf("Expected missing override directory to be ignored, got %v", err)
+	}
+}
+
+func TestBirdString(t *testing.T) {
+	tests := []struct {
+		in       string
+		expected string
+	}{
+		{"AS4242420919 peer", `"AS4242420919 peer"`},
+		{`say "hi"`, `"say \"hi\""`},
+		{`back\slash`, `"back\\slash"`},
+		{"two\nlines", `"two lines"`},
+	}
+
+	for _, tt := range tests {
+		if got := birdString(tt.in); got != tt.expected {
+			t.Errorf("Expected %s, got %s", tt.expected, got)
+		}
+	}
+}
+
+// sessionTestData is the data of a session rendered by RenderSession
+var sessionTestData = map[string]any{
+	"Name": "dn42_4242420919", "Description": "test", "RemoteASN": 4242420919,
+	"NeighborAddr": "fe80::919", "Interface": "dn42_0919", "Authentication": "",
+	"ImportFilter": "filter dn42_import_filter", "ExportFilter": "filter dn42_export_filter",
+}
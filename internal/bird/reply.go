@@ -0,0 +1,476 @@
+package bird
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// BIRD reply codes used by the typed accessors. Codes 8000-8999 are runtime
+// errors and 9000-9999 parse errors.
+const (
+	codeProtocolList    = 1002
+	codeProtocolDetail  = 1006
+	codeRoute           = 1007
+	codeRouteType       = 1008
+	codeRouteAttributes = 1012
+	codeBabelNeighbors  = 1024
+	codeNetworkNotFound = 8001
+	codeNoProtocols     = 8003
+	codeFirstError      = 8000
+)
+
+// ErrProtocolNotFound is returned when no BIRD protocol matches a name
+var ErrProtocolNotFound = errors.New("protocol not found")
+
+// ReplyLine is one line of a BIRD reply with the reply code it belongs to.
+type ReplyLine struct {
+	Code int
+	Text string
+}
+
+// Reply is a parsed BIRD control-socket reply.
+type Reply struct {
+	Lines []ReplyLine
+}
+
+// ReplyError is an error reported by BIRD (reply codes 8xxx and 9xxx).
+type ReplyError struct {
+	Code    int
+	Message string
+}
+
+func (e *ReplyError) Error() string {
+	return fmt.Sprintf("BIRD error %04d: %s", e.Code, e.Message)
+}
+
+// ParseReply splits a raw BIRD reply into lines with their reply codes.
+// BIRD starts a line with "CCCC-" (more lines follow) or "CCCC " (last line)
+// when the code changes, and with a single space when it continues the
+// previous code. Asynchronous messages ('+') are dropped.
+func ParseReply(raw string) *Reply {
+	reply := &Reply{}
+	code := 0
+	for _, line := range strings.Split(raw, "\n") {
+		line = strings.TrimRight(line, "\r")
+		switch {
+		case line == "", line[0] == '+':
+			continue
+		case len(line) >= 5 && isReplyCode(line[:4]) && (line[4] == '-' || line[4] == ' '):
+			code, _ = strconv.Atoi(line[:4])
+			line = line[5:]
+		case line[0] == ' ':
+			line = line[1:]
+		}
+		reply.Lines = append(reply.Lines, ReplyLine{Code: code, Text: line})
+	}
+	return reply
+}
+
+// isReplyCode reports whether s is a four digit reply code
+func isReplyCode(s string) bool {
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return len(s) == 4
+}
+
+// Err returns the first error BIRD reported in the reply, or nil.
+func (r *Reply) Err() error {
+	for _, line := range r.Lines {
+		if line.Code >= codeFirstError {
+			return &ReplyError{Code: line.Code, Message: strings.TrimSpace(line.Text)}
+		}
+	}
+	return nil
+}
+
+// String returns the text of the reply without reply codes.
+func (r *Reply) String() string {
+	texts := make([]string, 0, len(r.Lines))
+	for _, line := range r.Lines {
+		if text := strings.TrimSpace(line.Text); text != "" {
+			texts = append(texts, text)
+		}
+	}
+	return strings.Join(texts, "\n")
+}
+
+// Protocol is a line of 'show protocols'.
+type Protocol struct {
+	Name  string
+	Proto string // BGP, Static, Device, ...
+	Table string
+	State string // up, start, down
+	Since string
+	Info  string // Established, Active, ...
+}
+
+// ProtocolDetail is the output of 'show protocols all' for one protocol.
+type ProtocolDetail struct {
+	Protocol
+	Description     string
+	BGPState        string
+	NeighborAddress string
+	NeighborAS      uint32
+	LocalAS         uint32
+	NeighborID      string
+	LastError       string
+	Channels        []Channel
+}
+
+// Channel is a channel section of 'show protocols all'.
+type Channel struct {
+	Name         string // ipv4, ipv6
+	State        string
+	Table        string
+	ImportFilter string
+	ExportFilter string
+	Routes       RouteStats
+}
+
+// RouteStats are the route counts of a channel.
+type RouteStats struct {
+	Imported  int
+	Filtered  int
+	Exported  int
+	Preferred int
+}
+
+// Routes returns the route counts summed over all channels.
+func (d *ProtocolDetail) Routes() RouteStats {
+	var total RouteStats
+	for _, ch := range d.Channels {
+		total.Imported += ch.Routes.Imported
+		total.Filtered += ch.Routes.Filtered
+		total.Exported += ch.Routes.Exported
+		total.Preferred += ch.Routes.Preferred
+	}
+	return total
+}
+
+// timeOfDay matches the time part of a 'since' column in iso long format
+var timeOfDay = regexp.MustCompile(`^\d{2}:\d{2}:\d{2}(\.\d+)?$`)
+
+// parseProtocolLine parses a 'show protocols' line:
+// Name Proto Table State Since Info. Since is one or two fields, depending
+// on the configured time format.
+func parseProtocolLine(text string) (Protocol, bool) {
+	fields := strings.Fields(text)
+	if len(fields) < 5 {
+		return Protocol{}, false
+	}
+	p := Protocol{Name: fields[0], Proto: fields[1], Table: fields[2], State: fields[3], Since: fields[4]}
+	rest := fields[5:]
+	if len(rest) > 0 && timeOfDay.MatchString(rest[0]) {
+		p.Since += " " + rest[0]
+		rest = rest[1:]
+	}
+	p.Info = strings.Join(rest, " ")
+	return p, true
+}
+
+// parseProtocols extracts the protocols of a 'show protocols' reply.
+func parseProtocols(reply *Reply) []Protocol {
+	var protocols []Protocol
+	for _, line := range reply.Lines {
+		if line.Code != codeProtocolList {
+			continue
+		}
+		if p, ok := parseProtocolLine(line.Text); ok {
+			protocols = append(protocols, p)
+		}
+	}
+	return protocols
+}
+
+// parseProtocolDetails extracts the protocols of a 'show protocols all' reply.
+func parseProtocolDetails(reply *Reply) []ProtocolDetail {
+	var details []ProtocolDetail
+	var current *ProtocolDetail
+	var channel *Channel
+
+	for _, line := range reply.Lines {
+		switch line.Code {
+		case codeProtocolList:
+			p, ok := parseProtocolLine(line.Text)
+			if !ok {
+				continue
+			}
+			details = append(details, ProtocolDetail{Protocol: p})
+			current = &details[len(details)-1]
+			channel = nil
+		case codeProtocolDetail:
+			if current == nil {
+				continue
+			}
+			text := strings.TrimSpace(line.Text)
+			if name, ok := strings.CutPrefix(text, "Channel "); ok {
+				current.Channels = append(current.Channels, Channel{Name: strings.TrimSpace(name)})
+				channel = &current.Channels[len(current.Channels)-1]
+				continue
+			}
+			key, value, ok := strings.Cut(text, ":")
+			if !ok {
+				continue
+			}
+			value = strings.TrimSpace(value)
+			if channel != nil {
+				channel.set(key, value)
+			} else {
+				current.set(key, value)
+			}
+		}
+	}
+	return details
+}
+
+// set stores a "key: value" line of the protocol section
+func (d *ProtocolDetail) set(key, value string) {
+	switch key {
+	case "Description":
+		d.Description = value
+	case "BGP state":
+		d.BGPState = value
+	case "Neighbor address":
+		d.NeighborAddress = value
+	case "Neighbor AS":
+		d.NeighborAS = parseASN(value)
+	case "Local AS":
+		d.LocalAS = parseASN(value)
+	case "Neighbor ID":
+		d.NeighborID = value
+	case "Last error":
+		d.LastError = value
+	}
+}
+
+// set stores a "key: value" line of a channel section
+func (c *Channel) set(key, value string) {
+	switch key {
+	case "State":
+		c.State = value
+	case "Table":
+		c.Table = value
+	case "Input filter":
+		c.ImportFilter = value
+	case "Output filter":
+		c.ExportFilter = value
+	case "Routes":
+		c.Routes = parseRouteStats(value)
+	}
+}
+
+// parseRouteStats parses "512 imported, 10 filtered, 480 exported, 300 preferred"
+func parseRouteStats(value string) RouteStats {
+	var stats RouteStats
+	for _, part := range strings.Split(value, ",") {
+		fields := strings.Fields(part)
+		if len(fields) != 2 {
+			continue
+		}
+		n, err := strconv.Atoi(fields[0])
+		if err != nil {
+			continue
+		}
+		switch fields[1] {
+		case "imported":
+			stats.Imported = n
+		case "filtered":
+			stats.Filtered = n
+		case "exported":
+			stats.Exported = n
+		case "preferred":
+			stats.Preferred = n
+		}
+	}
+	return stats
+}
+
+// parseASN parses an AS number, returning 0 if it is invalid
+func parseASN(value string) uint32 {
+	asn, err := strconv.ParseUint(strings.TrimPrefix(value, "AS"), 10, 32)
+	if err != nil {
+		return 0
+	}
+	return uint32(asn)
+}
+
+// Route is a route of 'show route all'.
+type Route struct {
+	Network    string
+	Table      string
+	Type       string // unicast, blackhole, unreachable, ...
+	Protocol   string
+	Since      string
+	From       string // Neighbor the route was learned from, if shown
+	Primary    bool   // Selected as best route
+	Preference int
+	NextHop    string
+	Interface  string
+	Source     string            // Route source, e.g. "BGP univ"
+	Attributes map[string]string // BGP.origin, BGP.as_path, ...
+}
+
+// ASPath returns the AS numbers of the BGP.as_path attribute. AS sets are
+// skipped.
+func (r *Route) ASPath() []uint32 {
+	var path []uint32
+	for _, field := range strings.Fields(r.Attributes["BGP.as_path"]) {
+		if asn, err := strconv.ParseUint(field, 10, 32); err == nil {
+			path = append(path, uint32(asn))
+		}
+	}
+	return path
+}
+
+// parseRoutes extracts the routes of a 'show route ... all' reply.
+func parseRoutes(reply *Reply) []Route {
+	var routes []Route
+	var current *Route
+	table, network := "", ""
+
+	for _, line := range reply.Lines {
+		text := strings.TrimSpace(line.Text)
+		if text == "" {
+			continue
+		}
+		switch line.Code {
+		case codeRoute:
+			switch {
+			case strings.HasPrefix(text, "Table ") && strings.HasSuffix(text, ":"):
+				table = strings.TrimSuffix(strings.TrimPrefix(text, "Table "), ":")
+			case strings.HasPrefix(text, "via "), strings.HasPrefix(text, "dev "):
+				if current != nil && current.NextHop == "" && current.Interface == "" {
+					current.NextHop, current.Interface = parseNextHop(text)
+				}
+			default:
+				route := Route{Table: table, Attributes: make(map[string]string)}
+				if !parseRouteHead(text, &route, network) {
+					continue
+				}
+				network = route.Network
+				routes = append(routes, route)
+				current = &routes[len(routes)-1]
+			}
+		case codeRouteType:
+			if current != nil {
+				if value, ok := strings.CutPrefix(text, "Type:"); ok {
+					current.Source = strings.TrimSpace(value)
+				}
+			}
+		case codeRouteAttributes:
+			if current != nil {
+				if key, value, ok := strings.Cut(text, ":"); ok {
+					current.Attributes[key] = strings.TrimSpace(value)
+				}
+			}
+		}
+	}
+	return routes
+}
+
+// parseRouteHead parses the first line of a route:
+// [network] type [protocol since [from addr]] [*] (preference[/metric]) [...]
+// Alternative routes omit the network, which is then taken from the route
+// before.
+func parseRouteHead(text string, route *Route, network string) bool {
+	open := strings.Index(text, "[")
+	if open < 0 {
+		return false
+	}
+	closing := strings.Index(text[open:], "]")
+	if closing < 0 {
+		return false
+	}
+	head := strings.Fields(text[:open])
+	inside := strings.Fields(text[open+1 : open+closing])
+	rest := strings.Fields(text[open+closing+1:])
+
+	switch len(head) {
+	case 1:
+		route.Network, route.Type = network, head[0]
+	case 2:
+		route.Network, route.Type = head[0], head[1]
+	default:
+		return false
+	}
+	if route.Network == "" || len(inside) == 0 {
+		return false
+	}
+
+	route.Protocol = inside[0]
+	var since []string
+	for i := 1; i < len(inside); i++ {
+		if inside[i] == "from" && i+1 < len(inside) {
+			route.From = inside[i+1]
+			break
+		}
+		since = append(since, inside[i])
+	}
+	route.Since = strings.Join(since, " ")
+
+	for _, field := range rest {
+		switch {
+		case field == "*":
+			route.Primary = true
+		case strings.HasPrefix(field, "(") && strings.HasSuffix(field, ")"):
+			pref, _, _ := strings.Cut(strings.Trim(field, "()"), "/")
+			route.Preference, _ = strconv.Atoi(pref)
+		}
+	}
+	return true
+}
+
+// parseNextHop parses "via <addr> on <iface>" or "dev <iface>"
+func parseNextHop(text string) (nextHop, iface string) {
+	fields := strings.Fields(text)
+	for i := 0; i+1 < len(fields); i++ {
+		switch fields[i] {
+		case "via":
+			nextHop = fields[i+1]
+		case "on", "dev":
+			iface = fields[i+1]
+		}
+	}
+	return nextHop, iface
+}
+
+// BabelNeighbor is a line of 'show babel neighbors'.
+type BabelNeighbor struct {
+	Protocol  string
+	Address   string
+	Interface string
+	Metric    int
+	Routes    int
+}
+
+// parseBabelNeighbors extracts the neighbours of a 'show babel neighbors'
+// reply. Each Babel protocol starts with a "<name>:" line and a header.
+func parseBabelNeighbors(reply *Reply) []BabelNeighbor {
+	var neighbors []BabelNeighbor
+	var protocol string
+	for _, line := range reply.Lines {
+		if line.Code != codeBabelNeighbors {
+			continue
+		}
+		fields := strings.Fields(line.Text)
+		if len(fields) == 1 && strings.HasSuffix(fields[0], ":") {
+			protocol = strings.TrimSuffix(fields[0], ":")
+			continue
+		}
+		if len(fields) < 4 || net.ParseIP(fields[0]) == nil {
+			continue // Header
+		}
+		n := BabelNeighbor{Protocol: protocol, Address: fields[0], Interface: fields[1]}
+		n.Metric, _ = strconv.Atoi(fields[2])
+		n.Routes, _ = strconv.Atoi(fields[3])
+		neighbors = append(neighbors, n)
+	}
+	return neighbors
+}
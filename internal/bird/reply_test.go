@@ -0,0 +1,302 @@
+package bird
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// Replies captured from BIRD 3.0
+const (
+	showProtocolsReply = "2002-Name       Proto      Table      State  Since         Info\n" +
+		"1002-device1    Device     ---        up     2024-05-01 10:00:00  \n" +
+		" dn42_4242420919_1a2b3c4d BGP        ---        up     2024-05-01 10:00:05  Established   \n" +
+		" dn42_4242421080_5e6f7a8b BGP        ---        start  2024-05-01 10:00:05  Active        Socket: Connection refused\n" +
+		" static_roa  Static     dn42_roa6  up     10:00:00.123  \n" +
+		"0000 \n"
+
+	showProtocolsAllReply = "2002-Name       Proto      Table      State  Since         Info\n" +
+		"1002-dn42_4242420919_1a2b3c4d BGP        ---        up     2024-05-01 10:00:05  Established   \n" +
+		"1006-  Description:    AS4242420919 peer\n" +
+		"   BGP state:          Established\n" +
+		"     Neighbor address: fe80::919%dn42_0919\n" +
+		"     Neighbor AS:      4242420919\n" +
+		"     Local AS:         4242420998\n" +
+		"     Neighbor ID:      172.20.0.1\n" +
+		"     Local capabilities\n" +
+		"       Multiprotocol\n" +
+		"         AF announced: ipv4 ipv6\n" +
+		"     Session:          external AS4\n" +
+		"     Hold timer:       148.213/240\n" +
+		"   Channel ipv4\n" +
+		"     State:          UP\n" +
+		"     Table:          master4\n" +
+		"     Preference:     100\n" +
+		"     Input filter:   dn42_import_filter_v4\n" +
+		"     Output filter:  dn42_export_filter_v4\n" +
+		"     Import limit:   9000\n" +
+		"       Action:       block\n" +
+		"     Routes:         512 imported, 3 filtered, 480 exported, 300 preferred\n" +
+		"     Route change stats:     received   rejected   filtered    ignored   accepted\n" +
+		"       Import updates:            600          0          3          0        597\n" +
+		"   Channel ipv6\n" +
+		"     State:          UP\n" +
+		"     Table:          master6\n" +
+		"     Preference:     100\n" +
+		"     Input filter:   dn42_import_filter_v6\n" +
+		"     Output filter:  dn42_export_filter_v6\n" +
+		"     Routes:         1024 imported, 0 filtered, 900 exported, 700 preferred\n" +
+		"\n" +
+		"0000 \n"
+
+	showProtocolsAllDownReply = "2002-Name       Proto      Table      State  Since         Info\n" +
+		"1002-dn42_4242421080_5e6f7a8b BGP        ---        start  2024-05-01 10:00:05  Active        Socket: Connection refused\n" +
+		"1006-  BGP state:          Active\n" +
+		"     Neighbor address: fe80::1080%dn42_1080\n" +
+		"     Neighbor AS:      4242421080\n" +
+		"     Local AS:         4242420998\n" +
+		"     Connect delay:    2.613/5\n" +
+		"     Last error:       Socket: Connection refused\n" +
+		"   Channel ipv6\n" +
+		"     State:          DOWN\n" +
+		"     Table:          master6\n" +
+		"     Preference:     100\n" +
+		"     Input filter:   dn42_import_filter_v6\n" +
+		"     Output filter:  dn42_export_filter_v6\n" +
+		"\n" +
+		"0000 \n"
+
+	showRouteReply = "1007-Table master6:\n" +
+		" fd42:d42:d42::/48    unicast [dn42_4242420919_1a2b3c4d 2024-05-01 10:00:06] * (100) [AS4242423914i]\n" +
+		" \tvia fe80::919 on dn42_0919\n" +
+		"1008-\tType: BGP univ\n" +
+		"1012-\tBGP.origin: IGP\n" +
+		" \tBGP.as_path: 4242420919 4242423914\n" +
+		" \tBGP.next_hop: fd42:d42:d42::1 fe80::919\n" +
+		" \tBGP.local_pref: 100\n" +
+		" \tBGP.community: (64511,3) (64511,24) (64511,34)\n" +
+		" \tBGP.large_community: (4242420998, 1, 41)\n" +
+		"1007-                     unicast [ibgp_node2 2024-05-01 10:00:09 from fd42:4242:998::2] (100/20) [AS4242423914i]\n" +
+		" \tvia fe80::2 on dn42-wg-igp-2\n" +
+		"1008-\tType: BGP univ\n" +
+		"1012-\tBGP.origin: IGP\n" +
+		" \tBGP.as_path: 4242421080 {4242421081 4242421082} 4242423914\n" +
+		" \tBGP.local_pref: 100\n" +
+		"0000 \n"
+)
+
+func TestParseReply(t *testing.T) {
+	reply := ParseReply("0002-Reading configuration from /etc/bird/bird.conf\n" +
+		"+Asynchronous log message\n" +
+		"8002 /etc/bird/peers/dn42_1080.conf:12:3 syntax error, unexpected '}'\n")
+
+	expected := []ReplyLine{
+		{Code: 2, Text: "Reading configuration from /etc/bird/bird.conf"},
+		{Code: 8002, Text: "/etc/bird/peers/dn42_1080.conf:12:3 syntax error, unexpected '}'"},
+	}
+	if !reflect.DeepEqual(reply.Lines, expected) {
+		t.Errorf("Expected %+v, got %+v", expected, reply.Lines)
+	}
+
+	var replyErr *ReplyError
+	if err := reply.Err(); !errors.As(err, &replyErr) || replyErr.Code != 8002 {
+		t.Errorf("Expected error 8002, got %v", err)
+	}
+}
+
+func TestReplyErr(t *testing.T) {
+	tests := []struct {
+		name    string
+		raw     string
+		wantErr bool
+	}{
+		{"reconfigured", "0002-Reading configuration from /etc/bird/bird.conf\n0003 Reconfigured\n", false},
+		{"in progress", "0004 Reconfiguration in progress\n", false},
+		{"runtime error", "8003 No protocols match\n", true},
+		{"parse error", "9001 syntax error, unexpected CF_SYM_UNDEFINED\n", true},
+		{"continuation mentioning 8", " 8 routes\n0000 \n", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ParseReply(tt.raw).Err()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Expected error %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestParseProtocols(t *testing.T) {
+	expected := []Protocol{
+		{Name: "device1", Proto: "Device", Table: "---", State: "up", Since: "2024-05-01 10:00:00"},
+		{Name: "dn42_4242420919_1a2b3c4d", Proto: "BGP", Table: "---", State: "up", Since: "2024-05-01 10:00:05", Info: "Established"},
+		{Name: "dn42_4242421080_5e6f7a8b", Proto: "BGP", Table: "---", State: "start", Since: "2024-05-01 10:00:05", Info: "Active Socket: Connection refused"},
+		{Name: "static_roa", Proto: "Static", Table: "dn42_roa6", State: "up", Since: "10:00:00.123"},
+	}
+
+	got := parseProtocols(ParseReply(showProtocolsReply))
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected %+v, got %+v", expected, got)
+	}
+}
+
+func TestParseProtocolDetails(t *testing.T) {
+	tests := []struct {
+		name     string
+		raw      string
+		expected []ProtocolDetail
+	}{
+		{
+			name: "established",
+			raw:  showProtocolsAllReply,
+			expected: []ProtocolDetail{{
+				Protocol: Protocol{
+					Name: "dn42_4242420919_1a2b3c4d", Proto: "BGP", Table: "---", State: "up",
+					Since: "2024-05-01 10:00:05", Info: "Established",
+				},
+				Description:     "AS4242420919 peer",
+				BGPState:        "Established",
+				NeighborAddress: "fe80::919%dn42_0919",
+				NeighborAS:      4242420919,
+				LocalAS:         4242420998,
+				NeighborID:      "172.20.0.1",
+				Channels: []Channel{
+					{
+						Name: "ipv4", State: "UP", Table: "master4",
+						ImportFilter: "dn42_import_filter_v4", ExportFilter: "dn42_export_filter_v4",
+						Routes: RouteStats{Imported: 512, Filtered: 3, Exported: 480, Preferred: 300},
+					},
+					{
+						Name: "ipv6", State: "UP", Table: "master6",
+						ImportFilter: "dn42_import_filter_v6", ExportFilter: "dn42_export_filter_v6",
+						Routes: RouteStats{Imported: 1024, Exported: 900, Preferred: 700},
+					},
+				},
+			}},
+		},
+		{
+			name: "active with error",
+			raw:  showProtocolsAllDownReply,
+			expected: []ProtocolDetail{{
+				Protocol: Protocol{
+					Name: "dn42_4242421080_5e6f7a8b", Proto: "BGP", Table: "---", State: "start",
+					Since: "2024-05-01 10:00:05", Info: "Active Socket: Connection refused",
+				},
+				BGPState:        "Active",
+				NeighborAddress: "fe80::1080%dn42_1080",
+				NeighborAS:      4242421080,
+				LocalAS:         4242420998,
+				LastError:       "Socket: Connection refused",
+				Channels: []Channel{{
+					Name: "ipv6", State: "DOWN", Table: "master6",
+					ImportFilter: "dn42_import_filter_v6", ExportFilter: "dn42_export_filter_v6",
+				}},
+			}},
+		},
+		{
+			name:     "not found",
+			raw:      "8003 No protocols match\n",
+			expected: nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := parseProtocolDetails(ParseReply(tt.raw))
+			if !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("Expected %+v, got %+v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestProtocolDetailRoutes(t *testing.T) {
+	details := parseProtocolDetails(ParseReply(showProtocolsAllReply))
+	if len(details) != 1 {
+		t.Fatalf("Expected 1 protocol, got %d", len(details))
+	}
+
+	expected := RouteStats{Imported: 1536, Filtered: 3, Exported: 1380, Preferred: 1000}
+	if got := details[0].Routes(); got != expected {
+		t.Errorf("Expected %+v, got %+v", expected, got)
+	}
+}
+
+func TestParseRoutes(t *testing.T) {
+	routes := parseRoutes(ParseReply(showRouteReply))
+	if len(routes) != 2 {
+		t.Fatalf("Expected 2 routes, got %d", len(routes))
+	}
+
+	tests := []struct {
+		name     string
+		route    Route
+		expected Route
+		asPath   []uint32
+	}{
+		{
+			name:  "best route",
+			route: routes[0],
+			expected: Route{
+				Network: "fd42:d42:d42::/48", Table: "master6", Type: "unicast",
+				Protocol: "dn42_4242420919_1a2b3c4d", Since: "2024-05-01 10:00:06",
+				Primary: true, Preference: 100, NextHop: "fe80::919", Interface: "dn42_0919",
+				Source: "BGP univ",
+				Attributes: map[string]string{
+					"BGP.origin":          "IGP",
+					"BGP.as_path":         "4242420919 4242423914",
+					"BGP.next_hop":        "fd42:d42:d42::1 fe80::919",
+					"BGP.local_pref":      "100",
+					"BGP.community":       "(64511,3) (64511,24) (64511,34)",
+					"BGP.large_community": "(4242420998, 1, 41)",
+				},
+			},
+			asPath: []uint32{4242420919, 4242423914},
+		},
+		{
+			name:  "alternative route",
+			route: routes[1],
+			expected: Route{
+				Network: "fd42:d42:d42::/48", Table: "master6", Type: "unicast",
+				Protocol: "ibgp_node2", Since: "2024-05-01 10:00:09", From: "fd42:4242:998::2",
+				Preference: 100, NextHop: "fe80::2", Interface: "dn42-wg-igp-2",
+				Source: "BGP univ",
+				Attributes: map[string]string{
+					"BGP.origin":     "IGP",
+					"BGP.as_path":    "4242421080 {4242421081 4242421082} 4242423914",
+					"BGP.local_pref": "100",
+				},
+			},
+			asPath: []uint32{4242421080, 4242423914},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if !reflect.DeepEqual(tt.route, tt.expected) {
+				t.Errorf("Expected %+v, got %+v", tt.expected, tt.route)
+			}
+			if got := tt.route.ASPath(); !reflect.DeepEqual(got, tt.asPath) {
+				t.Errorf("Expected AS path %v, got %v", tt.asPath, got)
+			}
+		})
+	}
+}
+
+func TestParseBabelNeighbors(t *testing.T) {
+	raw := "1024-babel_igp:\n" +
+		" IP address                Interface        Metric Routes Hellos Expires Auth\n" +
+		" fe80::2                   dn42-wg-igp-2        96     12     16   4.531 No\n" +
+		" fe80::3                   dn42-wg-igp-3       160      8     15  11.062 No\n" +
+		"0000 \n"
+
+	expected := []BabelNeighbor{
+		{Protocol: "babel_igp", Address: "fe80::2", Interface: "dn42-wg-igp-2", Metric: 96, Routes: 12},
+		{Protocol: "babel_igp", Address: "fe80::3", Interface: "dn42-wg-igp-3", Metric: 160, Routes: 8},
+	}
+	got := parseBabelNeighbors(ParseReply(raw))
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected %+v, got %+v", expected, got)
+	}
+}
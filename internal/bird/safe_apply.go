@@ -0,0 +1,119 @@
+package bird
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+)
+
+// Safe-apply outcomes
+const (
+	SafeApplyConfirmed = "confirmed" // Checks passed, the config was confirmed
+	SafeApplyReverted  = "reverted"  // Checks failed, BIRD went back to the old config
+	SafeApplyFailed    = "failed"    // BIRD refused the configure or the confirm
+)
+
+const (
+	// Time left to confirm before BIRD reverts on its own
+	safeApplyConfirmMargin = 5 * time.Second
+	// Shortest usable safe-apply timeout
+	minSafeApplyTimeout = 2 * safeApplyConfirmMargin
+	// Delay between health checks while waiting to confirm
+	safeApplyPollInterval = 3 * time.Second
+)
+
+// ErrConfigReverted is returned when a configure made in safe-apply mode
+// failed its health checks and BIRD went back to the previous config
+var ErrConfigReverted = errors.New("health check failed, configuration reverted")
+
+// ApplyCheck decides whether a configure made in safe-apply mode is kept.
+// Baseline is called before the configure, Verify after it until it passes
+// or the confirm deadline is reached, and Record with the outcome.
+type ApplyCheck interface {
+	Baseline(ctx context.Context) error
+	Verify(ctx context.Context) error
+	Record(result SafeApplyResult)
+}
+
+// SafeApplyResult is the outcome of a configure in safe-apply mode.
+type SafeApplyResult struct {
+	Time    time.Time
+	Outcome string // SafeApplyConfirmed, SafeApplyReverted or SafeApplyFailed
+	Error   string
+}
+
+// SetSafeApply enables safe-apply mode: BIRD is reconfigured with
+// 'configure timeout', and the new config is only confirmed once check
+// passes. Otherwise it is undone, and if the agent cannot reach BIRD any
+// more, BIRD reverts on its own after timeout. A nil check disables the mode.
+func (p *Pool) SetSafeApply(timeout time.Duration, check ApplyCheck) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.safeApplyTimeout = max(timeout, minSafeApplyTimeout)
+	p.safeApplyCheck = check
+}
+
+// apply reconfigures BIRD, in safe-apply mode if it is enabled
+func (p *Pool) apply() error {
+	p.mu.Lock()
+	check, timeout := p.safeApplyCheck, p.safeApplyTimeout
+	p.mu.Unlock()
+
+	if check == nil {
+		return p.Configure()
+	}
+	return p.safeConfigure(check, timeout)
+}
+
+// safeConfigure reconfigures BIRD with a revert timeout and confirms the
+// new config once the health checks pass
+func (p *Pool) safeConfigure(check ApplyCheck, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout-safeApplyConfirmMargin)
+	defer cancel()
+
+	if err := check.Baseline(ctx); err != nil {
+		log.Printf("[BIRD] Warning: safe-apply baseline incomplete: %v", err)
+	}
+
+	cmd := fmt.Sprintf("configure timeout %d", int(timeout.Seconds()))
+	if _, err := p.Command(cmd); err != nil {
+		check.Record(SafeApplyResult{Time: time.Now(), Outcome: SafeApplyFailed, Error: err.Error()})
+		return fmt.Errorf("configure failed: %w", err)
+	}
+
+	if err := verifyUntil(ctx, check); err != nil {
+		if _, undoErr := p.Command("configure undo"); undoErr != nil {
+			log.Printf("[BIRD] Warning: configure undo failed, BIRD reverts after %v: %v", timeout, undoErr)
+		}
+		check.Record(SafeApplyResult{Time: time.Now(), Outcome: SafeApplyReverted, Error: err.Error()})
+		return fmt.Errorf("%w: %w", ErrConfigReverted, err)
+	}
+
+	if _, err := p.Command("configure confirm"); err != nil {
+		check.Record(SafeApplyResult{Time: time.Now(), Outcome: SafeApplyFailed, Error: err.Error()})
+		return fmt.Errorf("configure confirm failed: %w", err)
+	}
+	check.Record(SafeApplyResult{Time: time.Now(), Outcome: SafeApplyConfirmed})
+	return nil
+}
+
+// verifyUntil runs check.Verify until it passes or ctx is done, returning
+// the last check error in that case
+func verifyUntil(ctx context.Context, check ApplyCheck) error {
+	ticker := time.NewTicker(safeApplyPollInterval)
+	defer ticker.Stop()
+
+	for {
+		err := check.Verify(ctx)
+		if err == nil {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return err
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package bird
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// stubCheck is an ApplyCheck with a fixed Verify result
+type stubCheck struct {
+	verifyErr error
+	baselines int
+	results   []SafeApplyResult
+}
+
+func (c *stubCheck) Baseline(ctx context.Context) error {
+	c.baselines++
+	return nil
+}
+
+func (c *stubCheck) Verify(ctx context.Context) error {
+	return c.verifyErr
+}
+
+func (c *stubCheck) Record(result SafeApplyResult) {
+	c.results = append(c.results, result)
+}
+
+func TestSafeConfigure(t *testing.T) {
+	tests := []struct {
+		name      string
+		verifyErr error
+		wantErr   error
+		outcome   string
+		commands  []string
+	}{
+		{
+			name:     "confirmed",
+			outcome:  SafeApplyConfirmed,
+			commands: []string{"configure timeout 5", "configure confirm"},
+		},
+		{
+			name:      "reverted",
+			verifyErr: errors.New("iBGP sessions not established: ibgp_2"),
+			wantErr:   ErrConfigReverted,
+			outcome:   SafeApplyReverted,
+			commands:  []string{"configure timeout 5", "configure undo"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "bird.ctl")
+			bird := startFakeBird(t, path)
+
+			p, err := NewPool(path, 1, 2)
+			if err != nil {
+				t.Fatalf("NewPool failed: %v", err)
+			}
+			defer p.Close()
+
+			// Leaves 100ms for the checks before the confirm deadline
+			check := &stubCheck{verifyErr: tt.verifyErr}
+			err = p.safeConfigure(check, safeApplyConfirmMargin+100*time.Millisecond)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("Expected error %v, got %v", tt.wantErr, err)
+			}
+			if check.baselines != 1 {
+				t.Errorf("Expected 1 baseline, got %d", check.baselines)
+			}
+			if len(check.results) != 1 || check.results[0].Outcome != tt.outcome {
+				t.Errorf("Expected outcome %s, got %+v", tt.outcome, check.results)
+			}
+			if got := bird.configures(); !reflect.DeepEqual(got, tt.commands) {
+				t.Errorf("Expected commands %v, got %v", tt.commands, got)
+			}
+		})
+	}
+}
+
+func TestReconfigureUsesSafeApply(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bird.ctl")
+	bird := startFakeBird(t, path)
+
+	p, err := NewPool(path, 1, 2)
+	if err != nil {
+		t.Fatalf("NewPool failed: %v", err)
+	}
+	defer p.Close()
+	p.SetReconfigureDebounce(0)
+
+	check := &stubCheck{}
+	p.SetSafeApply(time.Second, check)
+	if err := p.Reconfigure(context.Background()); err != nil {
+		t.Fatalf("Expected reconfigure to succeed, got %v", err)
+	}
+
+	// Timeouts below the minimum are raised
+	expected := []string{"configure timeout 10", "configure confirm"}
+	if got := bird.configures(); !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected commands %v, got %v", expected, got)
+	}
+
+	p.SetSafeApply(0, nil)
+	if err := p.Reconfigure(context.Background()); err != nil {
+		t.Fatalf("Expected reconfigure to succeed, got %v", err)
+	}
+	if got := bird.configures(); got[len(got)-1] != "configure" {
+		t.Errorf("Expected plain configure once safe-apply is disabled, got %v", got)
+	}
+}
@@ -113,6 +113,7 @@ type RemoteConfig struct {
 	Bird       BirdConfig       `json:"bird"`
 	WireGuard  WireGuardConfig  `json:"wireguard"`
 	Metric     MetricConfig     `json:"metric"`
+	Session    SessionConfig    `json:"session"`
 	AutoUpdate AutoUpdateConfig `json:"autoUpdate"`
 }
 
@@ -124,6 +125,7 @@ func mergeConfig(bootstrap BootstrapConfig, remote *RemoteConfig) *Config {
 		Bird:       remote.Bird,
 		WireGuard:  remote.WireGuard,
 		Metric:     remote.Metric,
+		Session:    remote.Session,
 		AutoUpdate: remote.AutoUpdate,
 		ControlPlane: ControlPlaneConfig{
 			URL:   bootstrap.Bootstrap.APIURL,
@@ -162,6 +164,20 @@ func mergeConfig(bootstrap BootstrapConfig, remote *RemoteConfig) *Config {
 	if cfg.ControlPlane.RetryInitialDelay == 0 {
 		cfg.ControlPlane.RetryInitialDelay = 1000
 	}
+	if cfg.Bird.ReconfigureDebounce == 0 {
+		cfg.Bird.ReconfigureDebounce = 500
+	}
+	if cfg.Bird.PoolAcquireTimeout == 0 {
+		cfg.Bird.PoolAcquireTimeout = 10
+	}
+	if cfg.Bird.SafeApplyTimeout == 0 {
+		cfg.Bird.SafeApplyTimeout = 60
+	}
+	if cfg.WireGuard.EndpointResolveInterval == 0 {
+		cfg.WireGuard.EndpointResolveInterval = 300
+	}
+	setSessionDefaults(&cfg.Session)
+	setStateDefaults(&cfg.State)
 
 	return cfg
 }
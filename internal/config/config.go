@@ -3,6 +3,7 @@ package config
 import (
 	"encoding/json"
 	"fmt"
+	"net/netip"
 	"os"
 )
 
@@ -14,6 +15,8 @@ type Config struct {
 	Bird         BirdConfig         `json:"bird"`
 	WireGuard    WireGuardConfig    `json:"wireguard"`
 	Metric       MetricConfig       `json:"metric"`
+	Session      SessionConfig      `json:"session"`
+	State        StateConfig        `json:"state"`
 	AutoUpdate   AutoUpdateConfig   `json:"autoUpdate"`
 }
 
@@ -32,6 +35,16 @@ type NodeConfig struct {
 	Region   string `json:"region"`
 	Location string `json:"location"`
 	Provider string `json:"provider"`
+	// Public addresses used as local endpoint of GRE tunnels
+	// (detected from the routing table when empty)
+	PublicIPv4 string `json:"publicIpv4"`
+	PublicIPv6 string `json:"publicIpv6"`
+	// Local AS and its aggregate prefixes, which also hold the loopbacks
+	ASN        uint32 `json:"asn"`
+	IPv4Prefix string `json:"ipv4Prefix"`
+	IPv6Prefix string `json:"ipv6Prefix"`
+	// Let the CP policy supply the local AS and prefixes left unset above
+	LocalASFromPolicy bool `json:"localAsFromPolicy"`
 }
 
 // ControlPlaneConfig contains CP communication settings
@@ -49,12 +62,20 @@ type ControlPlaneConfig struct {
 
 // BirdConfig contains BIRD integration settings
 type BirdConfig struct {
-	ControlSocket        string `json:"controlSocket"`
-	PoolSize             int    `json:"poolSize"`
-	PoolSizeMax          int    `json:"poolSizeMax"`
-	PeerConfDir          string `json:"peerConfDir"`
-	EbgpConfTemplateFile string `json:"ebgpConfTemplateFile"`
-	IBGPConfDir          string `json:"ibgpConfDir"`
+	ControlSocket       string `json:"controlSocket"`
+	PoolSize            int    `json:"poolSize"`
+	PoolSizeMax         int    `json:"poolSizeMax"`
+	PeerConfDir         string `json:"peerConfDir"`
+	IBGPConfDir         string `json:"ibgpConfDir"`
+	ReconfigureDebounce int    `json:"reconfigureDebounce"` // milliseconds reconfigure requests are collected before BIRD is reconfigured
+	PoolAcquireTimeout  int    `json:"poolAcquireTimeout"`  // seconds a command waits for a free connection
+	// Directory with template overrides, replacing the embedded template of
+	// the same name (e.g. bird.conf.tmpl); empty for the embedded ones only
+	TemplateDir string `json:"templateDir"`
+	// Safe-apply: reconfigure with a revert timeout and confirm only after
+	// post-apply health checks pass
+	SafeApply        bool `json:"safeApply"`
+	SafeApplyTimeout int  `json:"safeApplyTimeout"` // seconds before BIRD reverts an unconfirmed config
 }
 
 // WireGuardConfig contains WireGuard settings
@@ -66,6 +87,8 @@ type WireGuardConfig struct {
 	DN42IPv4                    string `json:"dn42Ipv4"`
 	DN42IPv6                    string `json:"dn42Ipv6"`
 	DN42IPv6LinkLocal           string `json:"dn42Ipv6LinkLocal"`
+	// Seconds between re-resolutions of hostname endpoints
+	EndpointResolveInterval int `json:"endpointResolveInterval"`
 }
 
 // MetricConfig contains metric collection settings
@@ -75,6 +98,25 @@ type MetricConfig struct {
 	PingWorkers int `json:"pingWorkers"`
 }
 
+// SessionConfig contains eBGP session management settings
+type SessionConfig struct {
+	HealthGracePeriod int `json:"healthGracePeriod"` // seconds a session may be broken before it is reported
+	HandshakeTimeout  int `json:"handshakeTimeout"`  // seconds after which a WireGuard handshake is stale
+	// Remediation of StatusProblem sessions
+	RemediationBackoff    int `json:"remediationBackoff"`    // seconds before the first retry, doubled per attempt
+	RemediationMaxBackoff int `json:"remediationMaxBackoff"` // upper bound of the retry delay in seconds
+	// Graceful shutdown of StatusTeardown sessions
+	TeardownDrainPeriod    int `json:"teardownDrainPeriod"`    // seconds routes are announced with GRACEFUL_SHUTDOWN before the protocol is disabled
+	TeardownDrainThreshold int `json:"teardownDrainThreshold"` // bytes per second on the interface below which the drain ends early
+	// Number of sessions processed in parallel per sync
+	SyncConcurrency int `json:"syncConcurrency"`
+}
+
+// StateConfig contains local state persistence settings
+type StateConfig struct {
+	Path string `json:"path"` // JSON file with the last applied desired state
+}
+
 // AutoUpdateConfig contains self-update settings
 type AutoUpdateConfig struct {
 	Enabled       bool   `json:"enabled"`
@@ -138,6 +180,18 @@ func Load(path string) (*Config, error) {
 	if cfg.Bird.PeerConfDir == "" {
 		cfg.Bird.PeerConfDir = "/etc/bird/peers"
 	}
+	if cfg.Bird.ReconfigureDebounce == 0 {
+		cfg.Bird.ReconfigureDebounce = 500
+	}
+	if cfg.Bird.PoolAcquireTimeout == 0 {
+		cfg.Bird.PoolAcquireTimeout = 10
+	}
+	if cfg.Bird.SafeApplyTimeout == 0 {
+		cfg.Bird.SafeApplyTimeout = 60
+	}
+	if cfg.WireGuard.EndpointResolveInterval == 0 {
+		cfg.WireGuard.EndpointResolveInterval = 300
+	}
 	if cfg.Metric.PingTimeout == 0 {
 		cfg.Metric.PingTimeout = 5
 	}
@@ -148,6 +202,9 @@ func Load(path string) (*Config, error) {
 		cfg.Metric.PingWorkers = 32
 	}
 
+	setSessionDefaults(&cfg.Session)
+	setStateDefaults(&cfg.State)
+
 	// AutoUpdate defaults
 	if cfg.AutoUpdate.CheckInterval == 0 {
 		cfg.AutoUpdate.CheckInterval = 60 // 1 hour
@@ -161,3 +218,75 @@ func Load(path string) (*Config, error) {
 
 	return &cfg, nil
 }
+
+// Validate checks the settings the agent cannot run without. The local AS
+// and aggregate prefixes are required unless node.localAsFromPolicy lets the
+// CP policy supply them; values that are set are checked either way.
+func (c *Config) Validate() error {
+	fromPolicy := c.Node.LocalASFromPolicy
+	if c.Node.ASN == 0 && !fromPolicy {
+		return fmt.Errorf("node.asn is required (or set node.localAsFromPolicy)")
+	}
+	if c.Node.IPv4Prefix != "" || !fromPolicy {
+		if err := ValidatePrefix("node.ipv4Prefix", c.Node.IPv4Prefix, true); err != nil {
+			return err
+		}
+	}
+	if c.Node.IPv6Prefix != "" || !fromPolicy {
+		if err := ValidatePrefix("node.ipv6Prefix", c.Node.IPv6Prefix, false); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ValidatePrefix checks that a prefix is set, of the expected family and
+// without host bits
+func ValidatePrefix(field, prefix string, ipv4 bool) error {
+	if prefix == "" {
+		return fmt.Errorf("%s is required", field)
+	}
+	p, err := netip.ParsePrefix(prefix)
+	if err != nil {
+		return fmt.Errorf("invalid %s: %w", field, err)
+	}
+	if p.Addr().Is4() != ipv4 {
+		return fmt.Errorf("invalid %s: %s is of the wrong address family", field, prefix)
+	}
+	if p.Masked() != p {
+		return fmt.Errorf("invalid %s: %s has host bits set", field, prefix)
+	}
+	return nil
+}
+
+// setStateDefaults fills in the default state file location
+func setStateDefaults(s *StateConfig) {
+	if s.Path == "" {
+		s.Path = "/var/lib/moenet-agent/state.json"
+	}
+}
+
+// setSessionDefaults fills in default session management settings
+func setSessionDefaults(s *SessionConfig) {
+	if s.HealthGracePeriod == 0 {
+		s.HealthGracePeriod = 300 // 5 minutes
+	}
+	if s.HandshakeTimeout == 0 {
+		s.HandshakeTimeout = 180 // WireGuard rekeys every 2 minutes
+	}
+	if s.RemediationBackoff == 0 {
+		s.RemediationBackoff = 60
+	}
+	if s.RemediationMaxBackoff == 0 {
+		s.RemediationMaxBackoff = 3600 // 1 hour
+	}
+	if s.TeardownDrainPeriod == 0 {
+		s.TeardownDrainPeriod = 300 // 5 minutes
+	}
+	if s.TeardownDrainThreshold == 0 {
+		s.TeardownDrainThreshold = 1024 // Keepalives only
+	}
+	if s.SyncConcurrency == 0 {
+		s.SyncConcurrency = 8
+	}
+}
@@ -36,7 +36,7 @@ func TestLoad(t *testing.T) {
 			"poolSize": 3,
 			"poolSizeMax": 10,
 			"peerConfDir": "/tmp/peers",
-			"ebgpConfTemplateFile": "/tmp/ebgp.tmpl",
+			"templateDir": "/tmp/templates",
 			"ibgpConfDir": "/tmp/ibgp"
 		},
 		"wireguard": {
@@ -124,3 +124,37 @@ func TestLoadInvalidJSON(t *testing.T) {
 		t.Error("Expected error for invalid JSON")
 	}
 }
+
+func TestValidate(t *testing.T) {
+	valid := NodeConfig{ASN: 4242420998, IPv4Prefix: "172.22.188.0/26", IPv6Prefix: "fd00:4242:7777::/48"}
+
+	tests := []struct {
+		name    string
+		modify  func(n *NodeConfig)
+		wantErr bool
+	}{
+		{"valid", func(n *NodeConfig) {}, false},
+		{"missing asn", func(n *NodeConfig) { n.ASN = 0 }, true},
+		{"missing ipv4 prefix", func(n *NodeConfig) { n.IPv4Prefix = "" }, true},
+		{"missing ipv6 prefix", func(n *NodeConfig) { n.IPv6Prefix = "" }, true},
+		{"unset asn and prefixes", func(n *NodeConfig) { *n = NodeConfig{} }, true},
+		// Bootstrap nodes may take them from the CP policy
+		{"unset from policy", func(n *NodeConfig) { *n = NodeConfig{LocalASFromPolicy: true} }, false},
+		{"prefix unset from policy", func(n *NodeConfig) { n.IPv6Prefix = ""; n.LocalASFromPolicy = true }, false},
+		{"invalid prefix from policy", func(n *NodeConfig) { n.IPv4Prefix = "fd00::/8"; n.LocalASFromPolicy = true }, true},
+		{"ipv6 as ipv4 prefix", func(n *NodeConfig) { n.IPv4Prefix = "fd00::/8" }, true},
+		{"address instead of prefix", func(n *NodeConfig) { n.IPv6Prefix = "fd00:4242:7777::1" }, true},
+		{"host bits set", func(n *NodeConfig) { n.IPv4Prefix = "172.22.188.1/26" }, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &Config{Node: valid}
+			tt.modify(&cfg.Node)
+			err := cfg.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Expected error %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
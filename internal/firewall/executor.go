@@ -9,13 +9,19 @@ import (
 	"regexp"
 	"strconv"
 	"strings"
+	"sync"
 )
 
-// Executor manages iptables rules for DN42 WireGuard ports.
+// Executor manages iptables rules for DN42 WireGuard ports. It is safe for
+// concurrent use: rule changes are serialized, so the check before adding a
+// rule and the save of the rule set do not race.
 type Executor struct {
 	chain         string
 	commentPrefix string
+	rulesDir      string // Where the rule sets are saved
 	logger        *slog.Logger
+
+	mu sync.Mutex
 }
 
 // NewExecutor creates a new firewall executor.
@@ -23,12 +29,20 @@ func NewExecutor(logger *slog.Logger) *Executor {
 	return &Executor{
 		chain:         "INPUT",
 		commentPrefix: "moenet-dn42",
+		rulesDir:      "/etc/iptables",
 		logger:        logger,
 	}
 }
 
 // AllowPort opens a UDP port in iptables for WireGuard traffic.
 func (e *Executor) AllowPort(port int) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.allowPort(port)
+}
+
+// allowPort opens a port. Must hold mu.
+func (e *Executor) allowPort(port int) error {
 	if e.portExists(port) {
 		e.logger.Debug("port already open", "port", port)
 		return nil
@@ -58,6 +72,13 @@ func (e *Executor) AllowPort(port int) error {
 
 // RemovePort removes a UDP port rule from iptables.
 func (e *Executor) RemovePort(port int) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.removePort(port)
+}
+
+// removePort removes a port rule. Must hold mu.
+func (e *Executor) removePort(port int) error {
 	comment := fmt.Sprintf("%s-%d", e.commentPrefix, port)
 
 	// Remove IPv4 rule (ignore errors if not exists)
@@ -106,6 +127,9 @@ func (e *Executor) GetOpenPorts() ([]int, error) {
 // SyncPorts ensures only expected ports are open.
 // Returns the number of ports added and removed.
 func (e *Executor) SyncPorts(expectedPorts []int) (added, removed int, err error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
 	current, err := e.GetOpenPorts()
 	if err != nil {
 		return 0, 0, err
@@ -124,7 +148,7 @@ func (e *Executor) SyncPorts(expectedPorts []int) (added, removed int, err error
 	// Add missing ports
 	for port := range expectedSet {
 		if _, exists := currentSet[port]; !exists {
-			if err := e.AllowPort(port); err != nil {
+			if err := e.allowPort(port); err != nil {
 				e.logger.Error("failed to add port", "port", port, "error", err)
 			} else {
 				added++
@@ -135,7 +159,7 @@ func (e *Executor) SyncPorts(expectedPorts []int) (added, removed int, err error
 	// Remove extra ports
 	for port := range currentSet {
 		if _, exists := expectedSet[port]; !exists {
-			if err := e.RemovePort(port); err != nil {
+			if err := e.removePort(port); err != nil {
 				e.logger.Error("failed to remove port", "port", port, "error", err)
 			} else {
 				removed++
@@ -149,6 +173,14 @@ func (e *Executor) SyncPorts(expectedPorts []int) (added, removed int, err error
 	return added, removed, nil
 }
 
+// HasPort reports whether a port is currently open. It waits for rule
+// changes in progress, so the answer does not reflect a half-added rule.
+func (e *Executor) HasPort(port int) bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.portExists(port)
+}
+
 // portExists checks if a port rule already exists.
 func (e *Executor) portExists(port int) bool {
 	cmd := exec.Command("iptables", "-C", e.chain, "-p", "udp", "--dport", strconv.Itoa(port), "-j", "ACCEPT")
@@ -169,6 +201,6 @@ func (e *Executor) runIPTables(cmd string, args ...string) error {
 // saveRules persists iptables rules to disk.
 func (e *Executor) saveRules() {
 	// Try common save locations
-	_ = exec.Command("sh", "-c", "iptables-save > /etc/iptables/rules.v4 2>/dev/null || true").Run()
-	_ = exec.Command("sh", "-c", "ip6tables-save > /etc/iptables/rules.v6 2>/dev/null || true").Run()
+	_ = exec.Command("sh", "-c", `iptables-save > "$1/rules.v4" 2>/dev/null || true`, "sh", e.rulesDir).Run()
+	_ = exec.Command("sh", "-c", `ip6tables-save > "$1/rules.v6" 2>/dev/null || true`, "sh", e.rulesDir).Run()
 }
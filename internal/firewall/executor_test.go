@@ -3,6 +3,8 @@ package firewall
 import (
 	"log/slog"
 	"os"
+	"path/filepath"
+	"sync"
 	"testing"
 )
 
@@ -18,5 +20,53 @@ func TestNewExecutor(t *testing.T) {
 	}
 }
 
+// fakeIPTables is an iptables stand-in that records calls overlapping with
+// another call in the "overlaps" file. No rule exists, so every check fails.
+const fakeIPTables = `#!/bin/sh
+mkdir "$FAKE_IPTABLES_DIR/lock" 2>/dev/null || echo "$*" >> "$FAKE_IPTABLES_DIR/overlaps"
+sleep 0.01
+rmdir "$FAKE_IPTABLES_DIR/lock" 2>/dev/null
+[ "$1" = "-C" ] && exit 1
+exit 0
+`
+
+func TestConcurrentPortChecks(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"iptables", "ip6tables", "iptables-save", "ip6tables-save"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(fakeIPTables), 0755); err != nil {
+			t.Fatalf("Failed to write fake %s: %v", name, err)
+		}
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	t.Setenv("FAKE_IPTABLES_DIR", dir)
+
+	e := NewExecutor(slog.New(slog.NewTextHandler(os.Stderr, nil)))
+	e.rulesDir = dir
+
+	// Session setups check a port while other setups add and remove rules
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(port int) {
+			defer wg.Done()
+			switch port % 3 {
+			case 0:
+				e.HasPort(port)
+			case 1:
+				if err := e.AllowPort(port); err != nil {
+					t.Errorf("AllowPort(%d) failed: %v", port, err)
+				}
+			default:
+				e.RemovePort(port)
+			}
+		}(24000 + i)
+	}
+	wg.Wait()
+
+	if overlaps, err := os.ReadFile(filepath.Join(dir, "overlaps")); err == nil {
+		t.Errorf("Expected iptables calls to be serialized, overlapping calls:\n%s", overlaps)
+	}
+}
+
 // Note: Full integration tests require root privileges and iptables.
 // These tests verify the structure and basic logic only.
@@ -4,6 +4,8 @@
 package maintenance
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log"
 	"os"
@@ -83,7 +85,7 @@ func (s *State) Enter() error {
 	}
 
 	// Reconfigure BIRD to apply the change
-	if err := s.birdPool.Configure(); err != nil {
+	if err := s.birdPool.Reconfigure(context.Background()); err != nil {
 		// Rollback
 		os.WriteFile(maintenanceConfPath, []byte("define MAINTENANCE_MODE = false;\n"), 0644)
 		return fmt.Errorf("failed to reconfigure BIRD: %w", err)
@@ -115,7 +117,12 @@ func (s *State) Exit() error {
 	}
 
 	// Reconfigure BIRD to apply the change
-	if err := s.birdPool.Configure(); err != nil {
+	if err := s.birdPool.Reconfigure(context.Background()); err != nil {
+		if errors.Is(err, bird.ErrConfigReverted) {
+			// BIRD runs the maintenance config again; keep the file in line
+			os.WriteFile(maintenanceConfPath, []byte("define MAINTENANCE_MODE = true;\n"), 0644)
+			return fmt.Errorf("failed to reconfigure BIRD: %w", err)
+		}
 		log.Printf("[Maintenance] Warning: BIRD reconfigure failed: %v", err)
 		// Don't rollback - file is already written
 	}
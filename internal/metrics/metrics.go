@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"net/http"
 	"runtime"
+	"sort"
 	"sync"
 	"time"
 )
@@ -33,6 +34,28 @@ type Metrics struct {
 	// HTTP client
 	httpRetryTotal   int64
 	httpRetrySuccess int64
+
+	// WireGuard drift corrections by field
+	wgDriftCorrections map[string]int64
+
+	// Endpoint address changes found by re-resolving hostnames, by kind
+	endpointChanges map[string]int64
+
+	// BIRD control-socket pool
+	birdPoolStats func() BirdPoolStats
+
+	// Safe-apply reconfigures by outcome, and the time of the last one
+	safeApplies     map[string]int64
+	lastSafeApply   time.Time
+	lastSafeOutcome string
+}
+
+// BirdPoolStats are the connection counts of the BIRD control-socket pool
+type BirdPoolStats struct {
+	Open   int
+	Idle   int
+	Waits  uint64
+	Errors uint64
 }
 
 var (
@@ -46,6 +69,9 @@ func Get() *Metrics {
 		instance = &Metrics{
 			startTime:             time.Now(),
 			cpCircuitBreakerState: "closed",
+			wgDriftCorrections:    make(map[string]int64),
+			endpointChanges:       make(map[string]int64),
+			safeApplies:           make(map[string]int64),
 		}
 	})
 	return instance
@@ -110,6 +136,38 @@ func (m *Metrics) RecordHTTPRetry(success bool) {
 	}
 }
 
+// RecordDriftCorrection records a repaired WireGuard configuration drift
+func (m *Metrics) RecordDriftCorrection(field string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.wgDriftCorrections[field]++
+}
+
+// RecordEndpointChange records a tunnel endpoint updated after its hostname
+// resolved to a new address
+func (m *Metrics) RecordEndpointChange(kind string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.endpointChanges[kind]++
+}
+
+// SetBirdPoolStats sets the function that reports the BIRD pool state
+func (m *Metrics) SetBirdPoolStats(fn func() BirdPoolStats) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.birdPoolStats = fn
+}
+
+// RecordSafeApply records the outcome of a BIRD reconfigure in safe-apply
+// mode
+func (m *Metrics) RecordSafeApply(outcome string, at time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.safeApplies[outcome]++
+	m.lastSafeApply = at
+	m.lastSafeOutcome = outcome
+}
+
 // Handler returns an HTTP handler for Prometheus metrics
 func (m *Metrics) Handler() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
@@ -171,6 +229,62 @@ func (m *Metrics) Handler() http.HandlerFunc {
 		fmt.Fprintf(w, "moenet_http_retries_total{result=\"success\"} %d\n", m.httpRetrySuccess)
 		fmt.Fprintf(w, "moenet_http_retries_total{result=\"exhausted\"} %d\n", m.httpRetryTotal-m.httpRetrySuccess)
 
+		// WireGuard drift corrections
+		fmt.Fprintf(w, "# HELP moenet_wireguard_drift_corrections_total WireGuard fields reset to the desired state\n")
+		fmt.Fprintf(w, "# TYPE moenet_wireguard_drift_corrections_total counter\n")
+		fields := make([]string, 0, len(m.wgDriftCorrections))
+		for field := range m.wgDriftCorrections {
+			fields = append(fields, field)
+		}
+		sort.Strings(fields)
+		for _, field := range fields {
+			fmt.Fprintf(w, "moenet_wireguard_drift_corrections_total{field=%q} %d\n", field, m.wgDriftCorrections[field])
+		}
+
+		// Endpoint re-resolution
+		fmt.Fprintf(w, "# HELP moenet_endpoint_changes_total Tunnel endpoints updated after their hostname resolved to a new address\n")
+		fmt.Fprintf(w, "# TYPE moenet_endpoint_changes_total counter\n")
+		kinds := make([]string, 0, len(m.endpointChanges))
+		for kind := range m.endpointChanges {
+			kinds = append(kinds, kind)
+		}
+		sort.Strings(kinds)
+		for _, kind := range kinds {
+			fmt.Fprintf(w, "moenet_endpoint_changes_total{kind=%q} %d\n", kind, m.endpointChanges[kind])
+		}
+
+		// BIRD connection pool
+		if m.birdPoolStats != nil {
+			pool := m.birdPoolStats()
+			fmt.Fprintf(w, "# HELP moenet_bird_pool_connections BIRD control-socket connections\n")
+			fmt.Fprintf(w, "# TYPE moenet_bird_pool_connections gauge\n")
+			fmt.Fprintf(w, "moenet_bird_pool_connections{state=\"open\"} %d\n", pool.Open)
+			fmt.Fprintf(w, "moenet_bird_pool_connections{state=\"idle\"} %d\n", pool.Idle)
+			fmt.Fprintf(w, "# HELP moenet_bird_pool_waits_total BIRD commands that waited for a free connection\n")
+			fmt.Fprintf(w, "# TYPE moenet_bird_pool_waits_total counter\n")
+			fmt.Fprintf(w, "moenet_bird_pool_waits_total %d\n", pool.Waits)
+			fmt.Fprintf(w, "# HELP moenet_bird_pool_errors_total Failed BIRD dials and dead connections\n")
+			fmt.Fprintf(w, "# TYPE moenet_bird_pool_errors_total counter\n")
+			fmt.Fprintf(w, "moenet_bird_pool_errors_total %d\n", pool.Errors)
+		}
+
+		// BIRD safe-apply
+		if len(m.safeApplies) > 0 {
+			fmt.Fprintf(w, "# HELP moenet_bird_safe_apply_total BIRD reconfigures in safe-apply mode by outcome\n")
+			fmt.Fprintf(w, "# TYPE moenet_bird_safe_apply_total counter\n")
+			outcomes := make([]string, 0, len(m.safeApplies))
+			for outcome := range m.safeApplies {
+				outcomes = append(outcomes, outcome)
+			}
+			sort.Strings(outcomes)
+			for _, outcome := range outcomes {
+				fmt.Fprintf(w, "moenet_bird_safe_apply_total{outcome=%q} %d\n", outcome, m.safeApplies[outcome])
+			}
+			fmt.Fprintf(w, "# HELP moenet_bird_safe_apply_last_timestamp Time of the last safe-apply reconfigure\n")
+			fmt.Fprintf(w, "# TYPE moenet_bird_safe_apply_last_timestamp gauge\n")
+			fmt.Fprintf(w, "moenet_bird_safe_apply_last_timestamp{outcome=%q} %d\n", m.lastSafeOutcome, m.lastSafeApply.Unix())
+		}
+
 		// Go runtime stats
 		var memStats runtime.MemStats
 		runtime.ReadMemStats(&memStats)
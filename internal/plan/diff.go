@@ -0,0 +1,124 @@
+package plan
+
+import (
+	"fmt"
+	"strings"
+)
+
+// contextLines is the number of unchanged lines shown around each change
+const contextLines = 3
+
+// edit is a single line of a line-based diff
+type edit struct {
+	op   byte // ' ' unchanged, '-' removed, '+' added
+	line string
+}
+
+// Unified returns a unified diff turning oldText into newText, or an empty
+// string if both are equal
+func Unified(oldName, newName, oldText, newText string) string {
+	edits := diffLines(splitLines(oldText), splitLines(newText))
+
+	// Group changes into hunks, merging hunks whose context overlaps
+	var hunks [][2]int
+	for i, e := range edits {
+		if e.op == ' ' {
+			continue
+		}
+		start := max(0, i-contextLines)
+		end := min(len(edits), i+contextLines+1)
+		if n := len(hunks); n > 0 && start <= hunks[n-1][1] {
+			hunks[n-1][1] = end
+		} else {
+			hunks = append(hunks, [2]int{start, end})
+		}
+	}
+	if len(hunks) == 0 {
+		return ""
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "--- %s\n+++ %s\n", oldName, newName)
+	for _, h := range hunks {
+		oldBefore, newBefore := countLines(edits[:h[0]])
+		oldCount, newCount := countLines(edits[h[0]:h[1]])
+		fmt.Fprintf(&b, "@@ -%s +%s @@\n", hunkRange(oldBefore, oldCount), hunkRange(newBefore, newCount))
+		for _, e := range edits[h[0]:h[1]] {
+			b.WriteByte(e.op)
+			b.WriteString(e.line)
+			b.WriteByte('\n')
+		}
+	}
+	return b.String()
+}
+
+// diffLines computes a minimal line diff using the longest common subsequence
+func diffLines(a, b []string) []edit {
+	n, m := len(a), len(b)
+	lcs := make([][]int, n+1)
+	for i := range lcs {
+		lcs[i] = make([]int, m+1)
+	}
+	for i := n - 1; i >= 0; i-- {
+		for j := m - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	var edits []edit
+	i, j := 0, 0
+	for i < n && j < m {
+		switch {
+		case a[i] == b[j]:
+			edits = append(edits, edit{' ', a[i]})
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			edits = append(edits, edit{'-', a[i]})
+			i++
+		default:
+			edits = append(edits, edit{'+', b[j]})
+			j++
+		}
+	}
+	for ; i < n; i++ {
+		edits = append(edits, edit{'-', a[i]})
+	}
+	for ; j < m; j++ {
+		edits = append(edits, edit{'+', b[j]})
+	}
+	return edits
+}
+
+// countLines returns the number of old and new lines covered by edits
+func countLines(edits []edit) (oldLines, newLines int) {
+	for _, e := range edits {
+		if e.op != '+' {
+			oldLines++
+		}
+		if e.op != '-' {
+			newLines++
+		}
+	}
+	return oldLines, newLines
+}
+
+// hunkRange formats the "start,count" part of a hunk header
+func hunkRange(before, count int) string {
+	if count == 0 {
+		return fmt.Sprintf("%d,0", before)
+	}
+	return fmt.Sprintf("%d,%d", before+1, count)
+}
+
+// splitLines splits text into lines without their trailing newline
+func splitLines(text string) []string {
+	if text == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+}
@@ -0,0 +1,143 @@
+// Package plan describes the changes the sync tasks would make, without
+// applying any of them.
+package plan
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Action kinds
+const (
+	KindCreateInterface = "create-interface"
+	KindUpdateInterface = "update-interface"
+	KindDeleteInterface = "delete-interface"
+	KindWriteFile       = "write-file"
+	KindRenameFile      = "rename-file"
+	KindDeleteFile      = "delete-file"
+	KindOpenPort        = "open-port"
+	KindClosePort       = "close-port"
+	KindReconfigure     = "reconfigure"
+	KindDisableProtocol = "disable-protocol"
+	KindReportStatus    = "report-status"
+	KindRemediate       = "remediate"
+)
+
+// Action is a single change a task would make
+type Action struct {
+	Task   string `json:"task"`
+	Kind   string `json:"kind"`
+	Target string `json:"target"`
+	Detail string `json:"detail,omitempty"`
+	Diff   string `json:"diff,omitempty"`
+}
+
+// Plan is the list of intended actions of one or more tasks
+type Plan struct {
+	Actions []Action `json:"actions"`
+	Errors  []string `json:"errors,omitempty"`
+}
+
+// Planner is implemented by sync tasks that can describe their next run
+type Planner interface {
+	Plan(ctx context.Context, p *Plan) error
+}
+
+// Build collects the plans of all planners in name order. A failing planner
+// is recorded in Errors and does not stop the others.
+func Build(ctx context.Context, planners map[string]Planner) *Plan {
+	names := make([]string, 0, len(planners))
+	for name := range planners {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	p := &Plan{Actions: []Action{}}
+	for _, name := range names {
+		if err := planners[name].Plan(ctx, p); err != nil {
+			p.Errors = append(p.Errors, fmt.Sprintf("%s: %v", name, err))
+		}
+	}
+	return p
+}
+
+// Add records an action
+func (p *Plan) Add(task, kind, target, detail string) {
+	p.Actions = append(p.Actions, Action{Task: task, Kind: kind, Target: target, Detail: detail})
+}
+
+// WriteFile records writing content to path if it differs from the file on
+// disk, with a unified diff. It reports whether the file would change.
+func (p *Plan) WriteFile(task, path string, content []byte) bool {
+	existing, err := os.ReadFile(path)
+	if err == nil && bytes.Equal(existing, content) {
+		return false
+	}
+
+	detail := "update"
+	oldName := "a" + path
+	if err != nil {
+		detail = "create"
+		oldName = "/dev/null"
+	}
+	p.Actions = append(p.Actions, Action{
+		Task:   task,
+		Kind:   KindWriteFile,
+		Target: path,
+		Detail: detail,
+		Diff:   redact(Unified(oldName, "b"+path, string(existing), string(content))),
+	})
+	return true
+}
+
+// DeleteFile records removing path if it exists, with a diff of the removed
+// content. It reports whether the file exists.
+func (p *Plan) DeleteFile(task, path string) bool {
+	existing, err := os.ReadFile(path)
+	if err != nil {
+		return false
+	}
+	p.Actions = append(p.Actions, Action{
+		Task:   task,
+		Kind:   KindDeleteFile,
+		Target: path,
+		Diff:   redact(Unified("a"+path, "/dev/null", string(existing), "")),
+	})
+	return true
+}
+
+// secretPattern matches quoted secrets in BIRD config statements
+var secretPattern = regexp.MustCompile(`\b(password|secret)(\s+")[^"]*"`)
+
+// redact hides secrets in a diff, so plans can be shown and logged safely.
+// A changed secret still shows up as a changed line.
+func redact(diff string) string {
+	return secretPattern.ReplaceAllString(diff, `$1$2<redacted>"`)
+}
+
+// String renders the plan for terminal output
+func (p *Plan) String() string {
+	var b strings.Builder
+	if len(p.Actions) == 0 {
+		b.WriteString("No changes.\n")
+	}
+	for _, a := range p.Actions {
+		fmt.Fprintf(&b, "[%s] %s %s", a.Task, a.Kind, a.Target)
+		if a.Detail != "" {
+			fmt.Fprintf(&b, " (%s)", a.Detail)
+		}
+		b.WriteByte('\n')
+		for _, line := range splitLines(a.Diff) {
+			b.WriteString("    " + line + "\n")
+		}
+	}
+	for _, e := range p.Errors {
+		fmt.Fprintf(&b, "error: %s\n", e)
+	}
+	return b.String()
+}
@@ -0,0 +1,96 @@
+package plan
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestWriteFile(t *testing.T) {
+	dir := t.TempDir()
+	existing := filepath.Join(dir, "existing.conf")
+	if err := os.WriteFile(existing, []byte("a\nb\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		path     string
+		content  string
+		changed  bool
+		detail   string
+		diffLine string
+	}{
+		{"unchanged", existing, "a\nb\n", false, "", ""},
+		{"update", existing, "a\nc\n", true, "update", "+c"},
+		{"create", filepath.Join(dir, "new.conf"), "x\n", true, "create", "--- /dev/null"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &Plan{}
+			if changed := p.WriteFile("Test", tt.path, []byte(tt.content)); changed != tt.changed {
+				t.Fatalf("Expected changed %v, got %v", tt.changed, changed)
+			}
+			if !tt.changed {
+				if len(p.Actions) != 0 {
+					t.Errorf("Expected no actions, got %v", p.Actions)
+				}
+				return
+			}
+			if len(p.Actions) != 1 {
+				t.Fatalf("Expected 1 action, got %d", len(p.Actions))
+			}
+			a := p.Actions[0]
+			if a.Kind != KindWriteFile || a.Detail != tt.detail {
+				t.Errorf("Expected %s (%s), got %s (%s)", KindWriteFile, tt.detail, a.Kind, a.Detail)
+			}
+			if !strings.Contains(a.Diff, tt.diffLine) {
+				t.Errorf("Expected diff to contain %q, got:\n%s", tt.diffLine, a.Diff)
+			}
+		})
+	}
+}
+
+func TestDeleteFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "old.conf")
+	if err := os.WriteFile(path, []byte("a\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	p := &Plan{}
+	if p.DeleteFile("Test", filepath.Join(dir, "missing.conf")) {
+		t.Error("Expected missing file not to be recorded")
+	}
+	if !p.DeleteFile("Test", path) {
+		t.Fatal("Expected existing file to be recorded")
+	}
+	if len(p.Actions) != 1 || p.Actions[0].Kind != KindDeleteFile {
+		t.Fatalf("Expected 1 %s action, got %v", KindDeleteFile, p.Actions)
+	}
+	if !strings.Contains(p.Actions[0].Diff, "-a") {
+		t.Errorf("Expected diff to remove content, got:\n%s", p.Actions[0].Diff)
+	}
+}
+
+func TestWriteFileRedactsSecrets(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "peer.conf")
+	if err := os.WriteFile(path, []byte("    password \"old-secret\";\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	p := &Plan{}
+	p.WriteFile("Test", path, []byte("    password \"new-secret\";\n"))
+	if len(p.Actions) != 1 {
+		t.Fatalf("Expected 1 action, got %d", len(p.Actions))
+	}
+	diff := p.Actions[0].Diff
+	if strings.Contains(diff, "old-secret") || strings.Contains(diff, "new-secret") {
+		t.Errorf("Expected secrets to be redacted, got:\n%s", diff)
+	}
+	if !strings.Contains(diff, `+    password "<redacted>";`) {
+		t.Errorf("Expected changed password line, got:\n%s", diff)
+	}
+}
@@ -0,0 +1,231 @@
+package task
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/moenet/moenet-agent/internal/bird"
+)
+
+// stagingDirName is the directory in confDir policy files are rendered to
+// and checked in before they replace the live files
+const stagingDirName = ".staging"
+
+// Results reported to CP for a config hash
+const (
+	birdConfigApplied  = "applied"
+	birdConfigRejected = "rejected"
+)
+
+// renderedFile is a policy file rendered from the CP configuration
+type renderedFile struct {
+	name    string
+	content []byte
+}
+
+// fileBackup is the previous content of a replaced file
+type fileBackup struct {
+	path    string
+	content []byte
+	existed bool
+}
+
+// applyFiles stages the rendered files, has BIRD check the staged config,
+// swaps the files in and reconfigures BIRD. If the check fails nothing is
+// touched; if the reconfigure fails the previous files are restored.
+func (s *BirdConfigSync) applyFiles(ctx context.Context, files []renderedFile) error {
+	staging := filepath.Join(s.confDir, stagingDirName)
+	defer os.RemoveAll(staging)
+
+	if err := s.stageFiles(staging, files); err != nil {
+		return fmt.Errorf("failed to stage config: %w", err)
+	}
+	if err := s.birdPool.CheckConfig(filepath.Join(staging, "bird.conf")); err != nil {
+		return fmt.Errorf("config check failed: %w", err)
+	}
+
+	backups, err := s.swapFiles(staging, files)
+	if err != nil {
+		s.restoreFiles(backups)
+		return fmt.Errorf("failed to install config: %w", err)
+	}
+	for _, f := range files {
+		log.Printf("[BirdConfig] Installed %s (%d bytes)", f.name, len(f.content))
+	}
+
+	if err := s.birdPool.Reconfigure(ctx); err != nil {
+		s.restoreFiles(backups)
+		if errors.Is(err, bird.ErrConfigReverted) {
+			// BIRD already runs the previous config again
+			return fmt.Errorf("BIRD reconfigure reverted, previous config restored: %w", err)
+		}
+		if restoreErr := s.birdPool.Reconfigure(ctx); restoreErr != nil {
+			log.Printf("[BirdConfig] Warning: BIRD reconfigure with restored config failed: %v", restoreErr)
+		}
+		return fmt.Errorf("BIRD reconfigure failed, previous config restored: %w", err)
+	}
+	return nil
+}
+
+// stageFiles writes the rendered files to an empty staging directory. The
+// other config files of confDir are linked in, so relative includes of the
+// staged bird.conf resolve as they do for the live one.
+func (s *BirdConfigSync) stageFiles(staging string, files []renderedFile) error {
+	if err := os.RemoveAll(staging); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(staging, 0755); err != nil {
+		return err
+	}
+
+	rendered := make(map[string]bool, len(files))
+	for _, f := range files {
+		if err := os.WriteFile(filepath.Join(staging, f.name), f.content, 0644); err != nil {
+			return fmt.Errorf("failed to write %s: %w", f.name, err)
+		}
+		rendered[f.name] = true
+	}
+
+	entries, err := os.ReadDir(s.confDir)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		name := entry.Name()
+		if rendered[name] || !entry.Type().IsRegular() || !strings.HasSuffix(name, ".conf") {
+			continue
+		}
+		if err := os.Symlink(filepath.Join(s.confDir, name), filepath.Join(staging, name)); err != nil {
+			return fmt.Errorf("failed to link %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// swapFiles moves the staged files over the live ones. Each rename is
+// atomic, so BIRD never reads a partially written file. The previous
+// contents are returned, including those of files replaced before an error.
+func (s *BirdConfigSync) swapFiles(staging string, files []renderedFile) ([]fileBackup, error) {
+	var backups []fileBackup
+	for _, f := range files {
+		path := filepath.Join(s.confDir, f.name)
+		backup, err := backupFile(path)
+		if err != nil {
+			return backups, fmt.Errorf("failed to back up %s: %w", f.name, err)
+		}
+
+		if err := os.Rename(filepath.Join(staging, f.name), path); err != nil {
+			return backups, fmt.Errorf("failed to replace %s: %w", f.name, err)
+		}
+		backups = append(backups, backup)
+	}
+	return backups, nil
+}
+
+// backupFile reads the current content of a file that is about to be
+// replaced or removed
+func backupFile(path string) (fileBackup, error) {
+	content, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fileBackup{}, err
+	}
+	return fileBackup{path: path, content: content, existed: err == nil}, nil
+}
+
+// restoreFiles puts back the files replaced by swapFiles
+func (s *BirdConfigSync) restoreFiles(backups []fileBackup) {
+	if err := restoreBackups(backups); err != nil {
+		log.Printf("[BirdConfig] Warning: %v", err)
+		return
+	}
+	log.Printf("[BirdConfig] Restored %d config files", len(backups))
+}
+
+// restoreBackups puts back backed up files. It restores as many files as it
+// can and returns the first error.
+func restoreBackups(backups []fileBackup) error {
+	var firstErr error
+	for _, b := range backups {
+		var err error
+		if b.existed {
+			err = writeFileAtomic(b.path, b.content)
+		} else if err = os.Remove(b.path); errors.Is(err, fs.ErrNotExist) {
+			err = nil
+		}
+		if err != nil && firstErr == nil {
+			firstErr = fmt.Errorf("failed to restore %s: %w", b.path, err)
+		}
+	}
+	return firstErr
+}
+
+// writeFileAtomic writes a file through a temporary file in the same
+// directory, so readers see either the old or the new content
+func writeFileAtomic(path string, content []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+"-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // No-op after a successful rename
+
+	if _, err := tmp.Write(content); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(0644); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// reportConfigStatus tells CP whether the config of a hash was applied or
+// rejected
+func (s *BirdConfigSync) reportConfigStatus(ctx context.Context, hash, status, lastError string) error {
+	url := fmt.Sprintf("%s/api/v1/agent/%s/bird-config/status", s.config.ControlPlane.URL, s.config.Node.Name)
+
+	payload := map[string]interface{}{
+		"configHash": hash,
+		"status":     status,
+	}
+	if lastError != "" {
+		payload["lastError"] = lastError
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+s.config.ControlPlane.Token)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		respBody, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("CP returned status %d: %s", resp.StatusCode, string(respBody))
+	}
+	return nil
+}
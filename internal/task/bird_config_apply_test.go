@@ -0,0 +1,85 @@
+package task
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestStageFiles(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "bird.conf"), []byte("old main"), 0644)
+	os.WriteFile(filepath.Join(dir, "maintenance.conf"), []byte("maintenance"), 0644)
+	os.WriteFile(filepath.Join(dir, "README"), []byte("not a config"), 0644)
+	os.Mkdir(filepath.Join(dir, "peers"), 0755)
+
+	s := &BirdConfigSync{confDir: dir}
+	staging := filepath.Join(dir, stagingDirName)
+	files := []renderedFile{
+		{name: "bird.conf", content: []byte("new main")},
+		{name: "filters.conf", content: []byte("new filters")},
+	}
+	if err := s.stageFiles(staging, files); err != nil {
+		t.Fatalf("stageFiles failed: %v", err)
+	}
+
+	expected := map[string]string{
+		"bird.conf":        "new main",
+		"filters.conf":     "new filters",
+		"maintenance.conf": "maintenance",
+	}
+	for name, want := range expected {
+		got, err := os.ReadFile(filepath.Join(staging, name))
+		if err != nil {
+			t.Errorf("Expected staged %s, got %v", name, err)
+			continue
+		}
+		if string(got) != want {
+			t.Errorf("Expected %s to contain %q, got %q", name, want, got)
+		}
+	}
+	for _, name := range []string{"README", "peers"} {
+		if _, err := os.Lstat(filepath.Join(staging, name)); err == nil {
+			t.Errorf("Expected %s not to be staged", name)
+		}
+	}
+
+	// Live files are untouched until the swap
+	if got, _ := os.ReadFile(filepath.Join(dir, "bird.conf")); string(got) != "old main" {
+		t.Errorf("Expected live bird.conf unchanged, got %q", got)
+	}
+}
+
+func TestSwapAndRestoreFiles(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "bird.conf"), []byte("old main"), 0644)
+
+	s := &BirdConfigSync{confDir: dir}
+	staging := filepath.Join(dir, stagingDirName)
+	files := []renderedFile{
+		{name: "bird.conf", content: []byte("new main")},
+		{name: "filters.conf", content: []byte("new filters")},
+	}
+	if err := s.stageFiles(staging, files); err != nil {
+		t.Fatalf("stageFiles failed: %v", err)
+	}
+
+	backups, err := s.swapFiles(staging, files)
+	if err != nil {
+		t.Fatalf("swapFiles failed: %v", err)
+	}
+	if got, _ := os.ReadFile(filepath.Join(dir, "bird.conf")); string(got) != "new main" {
+		t.Errorf("Expected new bird.conf, got %q", got)
+	}
+	if got, _ := os.ReadFile(filepath.Join(dir, "filters.conf")); string(got) != "new filters" {
+		t.Errorf("Expected new filters.conf, got %q", got)
+	}
+
+	s.restoreFiles(backups)
+	if got, _ := os.ReadFile(filepath.Join(dir, "bird.conf")); string(got) != "old main" {
+		t.Errorf("Expected restored bird.conf, got %q", got)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "filters.conf")); !os.IsNotExist(err) {
+		t.Errorf("Expected filters.conf to be removed, got %v", err)
+	}
+}
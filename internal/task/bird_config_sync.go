@@ -1,24 +1,25 @@
 package task
 
 import (
-	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
-	"os"
 	"path/filepath"
 	"sync"
-	"text/template"
 	"time"
 
 	"github.com/moenet/moenet-agent/internal/bird"
 	"github.com/moenet/moenet-agent/internal/config"
 	"github.com/moenet/moenet-agent/internal/httpclient"
+	"github.com/moenet/moenet-agent/internal/plan"
 )
 
+// birdConfigPlanTask labels the plan actions of BirdConfigSync
+const birdConfigPlanTask = "BirdConfigSync"
+
 // BirdConfigSync handles BIRD policy configuration synchronization from Control Plane
 type BirdConfigSync struct {
 	config     *config.Config
@@ -26,31 +27,42 @@ type BirdConfigSync struct {
 	httpClient *httpclient.Client
 	confDir    string
 	ibgpSync   *IBGPSync // Reference to iBGP sync for peer updates
+	renderer   *bird.Renderer
+	localAS    *LocalAS
 
 	mu             sync.RWMutex
 	lastConfigHash string
-	templates      map[string]*template.Template
+	rejectedHash   string // Hash of the last config BIRD refused, not retried
+	stateStore     *StateStore
 }
 
 // NewBirdConfigSync creates a new BIRD config sync handler
-func NewBirdConfigSync(cfg *config.Config, birdPool *bird.Pool, httpClient *httpclient.Client, ibgpSync *IBGPSync) (*BirdConfigSync, error) {
-	confDir := "/etc/bird"
-
-	s := &BirdConfigSync{
+func NewBirdConfigSync(cfg *config.Config, birdPool *bird.Pool, httpClient *httpclient.Client, ibgpSync *IBGPSync, renderer *bird.Renderer) *BirdConfigSync {
+	return &BirdConfigSync{
 		config:     cfg,
 		birdPool:   birdPool,
 		httpClient: httpClient,
-		confDir:    confDir,
+		confDir:    "/etc/bird",
 		ibgpSync:   ibgpSync,
-		templates:  make(map[string]*template.Template),
+		renderer:   renderer,
+		localAS:    NewLocalAS(cfg.Node),
 	}
+}
 
-	// Load embedded templates
-	if err := s.loadTemplates(); err != nil {
-		return nil, fmt.Errorf("failed to load templates: %w", err)
-	}
+// SetLocalAS sets the local AS holder updated from the CP policy, shared
+// with IBGPSync and MeshSync
+func (s *BirdConfigSync) SetLocalAS(localAS *LocalAS) {
+	s.localAS = localAS
+}
+
+// SetStateStore sets the store the config hash is persisted to. The hash of
+// the previous run is restored, so a restart does not re-render unchanged files.
+func (s *BirdConfigSync) SetStateStore(store *StateStore) {
+	s.stateStore = store
 
-	return s, nil
+	s.mu.Lock()
+	s.lastConfigHash = store.Get().BirdConfigHash
+	s.mu.Unlock()
 }
 
 // Run starts the BIRD config sync task
@@ -87,6 +99,11 @@ func (s *BirdConfigSync) Sync(ctx context.Context) error {
 		return fmt.Errorf("failed to fetch bird config: %w", err)
 	}
 
+	// iBGP and the mesh need the local AS, also when the policy is unchanged
+	if err := validateLocalAS(&birdConfig.Policy, s.config.Node); err == nil {
+		s.localAS.setFromPolicy(&birdConfig.Policy)
+	}
+
 	// Always update iBGP peers (regardless of config hash)
 	if s.ibgpSync != nil && len(birdConfig.IBGPPeers) > 0 {
 		s.ibgpSync.UpdatePeersFromAPI(birdConfig.IBGPPeers)
@@ -96,52 +113,121 @@ func (s *BirdConfigSync) Sync(ctx context.Context) error {
 	// Check if config has changed
 	s.mu.RLock()
 	lastHash := s.lastConfigHash
+	rejectedHash := s.rejectedHash
 	s.mu.RUnlock()
 
 	if birdConfig.ConfigHash == lastHash {
 		log.Println("[BirdConfig] Config unchanged, skipping render")
 		return nil
 	}
+	if birdConfig.ConfigHash == rejectedHash {
+		log.Printf("[BirdConfig] Config %s was rejected before, waiting for a new one", rejectedHash)
+		return nil
+	}
 
 	log.Printf("[BirdConfig] Config changed (hash: %s -> %s), rendering templates...",
 		lastHash, birdConfig.ConfigHash)
 
-	// Render templates
-	if err := s.renderFilters(birdConfig); err != nil {
-		return fmt.Errorf("failed to render filters.conf: %w", err)
+	if err := validatePolicy(&birdConfig.Policy, s.config.Node); err != nil {
+		return s.rejectConfig(ctx, birdConfig.ConfigHash, fmt.Errorf("invalid policy: %w", err))
 	}
 
-	if err := s.renderCommunities(birdConfig); err != nil {
-		return fmt.Errorf("failed to render moenet_communities.conf: %w", err)
+	// Render templates
+	files := make([]renderedFile, 0, len(birdConfigFiles))
+	for _, f := range birdConfigFiles {
+		content, err := s.renderTemplate(f.template, birdConfig)
+		if err != nil {
+			return fmt.Errorf("failed to render %s: %w", f.file, err)
+		}
+		files = append(files, renderedFile{name: f.file, content: content})
 	}
 
-	if err := s.renderBabel(birdConfig); err != nil {
-		return fmt.Errorf("failed to render babel.conf: %w", err)
+	// Check, install and load the files, keeping the old ones on failure
+	if err := s.applyFiles(ctx, files); err != nil {
+		return s.rejectConfig(ctx, birdConfig.ConfigHash, err)
 	}
+	log.Println("[BirdConfig] BIRD configuration reloaded successfully")
+
+	// Update last config hash
+	s.mu.Lock()
+	s.lastConfigHash = birdConfig.ConfigHash
+	s.rejectedHash = ""
+	s.mu.Unlock()
 
-	if err := s.renderColdPotato(birdConfig); err != nil {
-		return fmt.Errorf("failed to render cold_potato.conf: %w", err)
+	if s.stateStore != nil {
+		if err := s.stateStore.SetBirdConfigHash(birdConfig.ConfigHash); err != nil {
+			log.Printf("[BirdConfig] Warning: failed to persist state: %v", err)
+		}
 	}
 
-	if err := s.renderBirdConf(birdConfig); err != nil {
-		return fmt.Errorf("failed to render bird.conf: %w", err)
+	if err := s.reportConfigStatus(ctx, birdConfig.ConfigHash, birdConfigApplied, ""); err != nil {
+		log.Printf("[BirdConfig] Warning: failed to report applied config: %v", err)
 	}
 
-	// Update last config hash
+	return nil
+}
+
+// rejectConfig remembers a config hash as rejected, so it is not retried,
+// and reports it to CP
+func (s *BirdConfigSync) rejectConfig(ctx context.Context, hash string, err error) error {
 	s.mu.Lock()
-	s.lastConfigHash = birdConfig.ConfigHash
+	s.rejectedHash = hash
 	s.mu.Unlock()
+	if reportErr := s.reportConfigStatus(ctx, hash, birdConfigRejected, err.Error()); reportErr != nil {
+		log.Printf("[BirdConfig] Warning: failed to report rejected config: %v", reportErr)
+	}
+	return fmt.Errorf("config %s not applied: %w", hash, err)
+}
 
-	// Reload BIRD
-	if err := s.birdPool.Configure(); err != nil {
-		log.Printf("[BirdConfig] Warning: BIRD reconfigure failed: %v", err)
-	} else {
-		log.Println("[BirdConfig] BIRD configuration reloaded successfully")
+// Plan records the policy file changes the next Sync would make
+func (s *BirdConfigSync) Plan(ctx context.Context, p *plan.Plan) error {
+	birdConfig, err := s.fetchBirdConfig(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to fetch bird config: %w", err)
 	}
 
+	s.mu.RLock()
+	lastHash := s.lastConfigHash
+	s.mu.RUnlock()
+	if birdConfig.ConfigHash == lastHash {
+		return nil
+	}
+
+	if err := validatePolicy(&birdConfig.Policy, s.config.Node); err != nil {
+		p.Errors = append(p.Errors, fmt.Sprintf("%s: invalid policy: %v", birdConfigPlanTask, err))
+		return nil
+	}
+
+	changed := false
+	for _, f := range birdConfigFiles {
+		content, err := s.renderTemplate(f.template, birdConfig)
+		if err != nil {
+			return fmt.Errorf("failed to render %s: %w", f.file, err)
+		}
+		if p.WriteFile(birdConfigPlanTask, filepath.Join(s.confDir, f.file), content) {
+			changed = true
+		}
+	}
+
+	// Sync reloads on every hash change, even if the files are identical
+	detail := "config hash " + birdConfig.ConfigHash
+	if !changed {
+		detail += ", files unchanged"
+	}
+	p.Add(birdConfigPlanTask, plan.KindReconfigure, "bird", detail)
 	return nil
 }
 
+// IBGPPeers fetches the iBGP peers from Control Plane, the peer source of
+// IBGPSync.Plan
+func (s *BirdConfigSync) IBGPPeers(ctx context.Context) ([]BirdIBGPPeer, error) {
+	birdConfig, err := s.fetchBirdConfig(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return birdConfig.IBGPPeers, nil
+}
+
 // fetchBirdConfig retrieves BIRD configuration from Control Plane
 func (s *BirdConfigSync) fetchBirdConfig(ctx context.Context) (*BirdConfigResponse, error) {
 	url := fmt.Sprintf("%s/api/v1/agent/%s/bird-config", s.config.ControlPlane.URL, s.config.Node.Name)
@@ -171,898 +257,26 @@ func (s *BirdConfigSync) fetchBirdConfig(ctx context.Context) (*BirdConfigRespon
 		return nil, fmt.Errorf("failed to decode response: %w", err)
 	}
 
+	fillPolicyDefaults(&apiResp.Data.Policy, s.config.Node)
 	return &apiResp.Data, nil
 }
 
-// loadTemplates loads the embedded Go templates
-func (s *BirdConfigSync) loadTemplates() error {
-	// filters.conf template
-	filtersTmpl, err := template.New("filters").Parse(filtersTemplate)
-	if err != nil {
-		return fmt.Errorf("failed to parse filters template: %w", err)
-	}
-	s.templates["filters"] = filtersTmpl
-
-	// moenet_communities.conf template
-	commTmpl, err := template.New("communities").Parse(communitiesTemplate)
-	if err != nil {
-		return fmt.Errorf("failed to parse communities template: %w", err)
-	}
-	s.templates["communities"] = commTmpl
-
-	// babel.conf template
-	babelTmpl, err := template.New("babel").Parse(babelTemplate)
-	if err != nil {
-		return fmt.Errorf("failed to parse babel template: %w", err)
-	}
-	s.templates["babel"] = babelTmpl
-
-	// cold_potato.conf template
-	coldPotatoTmpl, err := template.New("cold_potato").Parse(coldPotatoTemplate)
-	if err != nil {
-		return fmt.Errorf("failed to parse cold_potato template: %w", err)
-	}
-	s.templates["cold_potato"] = coldPotatoTmpl
-
-	// bird.conf template (main config)
-	birdConfTmpl, err := template.New("bird_conf").Parse(birdConfTemplate)
-	if err != nil {
-		return fmt.Errorf("failed to parse bird_conf template: %w", err)
-	}
-	s.templates["bird_conf"] = birdConfTmpl
-
-	return nil
-}
-
-// renderFilters renders the filters.conf template
-func (s *BirdConfigSync) renderFilters(cfg *BirdConfigResponse) error {
-	tmpl := s.templates["filters"]
-	if tmpl == nil {
-		return fmt.Errorf("filters template not loaded")
-	}
-
-	var buf bytes.Buffer
-	if err := tmpl.Execute(&buf, cfg); err != nil {
-		return fmt.Errorf("template execution failed: %w", err)
-	}
-
-	path := filepath.Join(s.confDir, "filters.conf")
-	if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
-		return fmt.Errorf("failed to write filters.conf: %w", err)
-	}
-
-	log.Printf("[BirdConfig] Rendered filters.conf (%d bytes)", buf.Len())
-	return nil
-}
-
-// renderCommunities renders the moenet_communities.conf template
-func (s *BirdConfigSync) renderCommunities(cfg *BirdConfigResponse) error {
-	tmpl := s.templates["communities"]
-	if tmpl == nil {
-		return fmt.Errorf("communities template not loaded")
-	}
-
-	var buf bytes.Buffer
-	if err := tmpl.Execute(&buf, cfg); err != nil {
-		return fmt.Errorf("template execution failed: %w", err)
-	}
-
-	path := filepath.Join(s.confDir, "moenet_communities.conf")
-	if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
-		return fmt.Errorf("failed to write moenet_communities.conf: %w", err)
-	}
-
-	log.Printf("[BirdConfig] Rendered moenet_communities.conf (%d bytes)", buf.Len())
-	return nil
-}
-
-// renderBabel renders the babel.conf template for Babel IGP
-func (s *BirdConfigSync) renderBabel(cfg *BirdConfigResponse) error {
-	tmpl := s.templates["babel"]
-	if tmpl == nil {
-		return fmt.Errorf("babel template not loaded")
-	}
-
-	var buf bytes.Buffer
-	if err := tmpl.Execute(&buf, cfg); err != nil {
-		return fmt.Errorf("template execution failed: %w", err)
-	}
-
-	path := filepath.Join(s.confDir, "babel.conf")
-	if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
-		return fmt.Errorf("failed to write babel.conf: %w", err)
-	}
-
-	log.Printf("[BirdConfig] Rendered babel.conf (%d bytes)", buf.Len())
-	return nil
-}
-
-// renderColdPotato renders the cold_potato.conf template
-func (s *BirdConfigSync) renderColdPotato(cfg *BirdConfigResponse) error {
-	tmpl := s.templates["cold_potato"]
-	if tmpl == nil {
-		return fmt.Errorf("cold_potato template not loaded")
-	}
-
-	var buf bytes.Buffer
-	if err := tmpl.Execute(&buf, cfg); err != nil {
-		return fmt.Errorf("template execution failed: %w", err)
-	}
-
-	path := filepath.Join(s.confDir, "cold_potato.conf")
-	if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
-		return fmt.Errorf("failed to write cold_potato.conf: %w", err)
-	}
-
-	log.Printf("[BirdConfig] Rendered cold_potato.conf (%d bytes)", buf.Len())
-	return nil
-}
-
-// renderBirdConf renders the main bird.conf template
-func (s *BirdConfigSync) renderBirdConf(cfg *BirdConfigResponse) error {
-	tmpl := s.templates["bird_conf"]
-	if tmpl == nil {
-		return fmt.Errorf("bird_conf template not loaded")
-	}
-
-	var buf bytes.Buffer
-	if err := tmpl.Execute(&buf, cfg); err != nil {
-		return fmt.Errorf("template execution failed: %w", err)
-	}
-
-	path := filepath.Join(s.confDir, "bird.conf")
-	if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
-		return fmt.Errorf("failed to write bird.conf: %w", err)
-	}
-
-	log.Printf("[BirdConfig] Rendered bird.conf (%d bytes)", buf.Len())
-	return nil
-}
-
-// filtersTemplate is the Go template for filters.conf (migrated from Jinja2)
-const filtersTemplate = `# =============================================================================
-# BIRD Filters for {{.Node.Name}} - Auto-generated by moenet-agent
-# Generated by moenet-agent
-# Config Hash: {{.ConfigHash}}
-# =============================================================================
-
-# -----------------------------------------------------------------------------
-# DN42 BGP Community Definitions
-# -----------------------------------------------------------------------------
-
-# Latency Communities (64511, 1-9)
-define DN42_LATENCY_0    = (64511, 1);  # RTT < 2.7ms
-define DN42_LATENCY_1    = (64511, 2);  # RTT < 7.3ms
-define DN42_LATENCY_2    = (64511, 3);  # RTT < 20ms
-define DN42_LATENCY_3    = (64511, 4);  # RTT < 55ms
-define DN42_LATENCY_4    = (64511, 5);  # RTT < 148ms
-define DN42_LATENCY_5    = (64511, 6);  # RTT < 403ms
-define DN42_LATENCY_6    = (64511, 7);  # RTT < 1097ms
-define DN42_LATENCY_7    = (64511, 8);  # RTT < 2981ms
-define DN42_LATENCY_8    = (64511, 9);  # RTT >= 2981ms
-
-# Bandwidth Communities (64511, 21-25)
-define DN42_BW_100M_PLUS = (64511, 21);
-define DN42_BW_10G_PLUS  = (64511, 22);
-define DN42_BW_1G_PLUS   = (64511, 23);
-define DN42_BW_100K_PLUS = (64511, 24);
-define DN42_BW_10M_PLUS  = (64511, 25);
-
-# Crypto Communities (64511, 31-34)
-define DN42_CRYPTO_NONE      = (64511, 31);
-define DN42_CRYPTO_UNSAFE    = (64511, 32);
-define DN42_CRYPTO_ENCRYPTED = (64511, 33);
-define DN42_CRYPTO_LATENCY   = (64511, 34);
-
-# Region Communities (64511, 41-53)
-define DN42_REGION_EU       = (64511, 41);
-define DN42_REGION_NA_E     = (64511, 42);
-define DN42_REGION_NA_C     = (64511, 43);
-define DN42_REGION_NA_W     = (64511, 44);
-define DN42_REGION_CA       = (64511, 45);
-define DN42_REGION_SA       = (64511, 46);
-define DN42_REGION_AF       = (64511, 47);
-define DN42_REGION_AS_S     = (64511, 48);
-define DN42_REGION_AS_SE    = (64511, 49);
-define DN42_REGION_AS_E     = (64511, 50);
-define DN42_REGION_OC       = (64511, 51);
-define DN42_REGION_ME       = (64511, 52);
-define DN42_REGION_AS_N     = (64511, 53);
-
-# Action Communities
-define DN42_NO_EXPORT   = (64511, 65281);
-define DN42_NO_ANNOUNCE = (64511, 65282);
-
-# RFC 8326 Graceful Shutdown
-define GRACEFUL_SHUTDOWN = (65535, 0);
-
-# -----------------------------------------------------------------------------
-# Our Node's Community Values (from API config)
-# -----------------------------------------------------------------------------
-define OUR_REGION = {{.Node.RegionCommunity}};
-define OUR_BANDWIDTH = {{.Node.BandwidthCommunity}};
-
-# -----------------------------------------------------------------------------
-# MoeNet Large Communities
-# -----------------------------------------------------------------------------
-
-define LC_ACCEPTED_HERE = ({{.Policy.DN42As}}, 100, {{.Node.ID}});
-define LC_REJECT_SELF      = ({{.Policy.DN42As}}, 150, 1);
-define LC_REJECT_PREFIX    = ({{.Policy.DN42As}}, 150, 2);
-define LC_REJECT_ROA       = ({{.Policy.DN42As}}, 150, 3);
-define LC_REJECT_PATH_LEN  = ({{.Policy.DN42As}}, 150, 4);
-define LC_REJECT_BLACKLIST = ({{.Policy.DN42As}}, 150, 5);
-
-# -----------------------------------------------------------------------------
-# Prefix Validation
-# -----------------------------------------------------------------------------
-
-function is_valid_dn42_prefix() -> bool {
-    return net ~ [
-        172.20.0.0/14{21,29},
-        172.20.0.0/24{28,32},
-        172.21.0.0/24{28,32},
-        172.22.0.0/24{28,32},
-        172.23.0.0/24{28,32},
-        172.31.0.0/16+,
-        10.0.0.0/8{15,24}
-    ];
-}
-
-function is_valid_dn42_prefix6() -> bool {
-    return net ~ [
-        fd00::/8{44,64}
-    ];
-}
-
-# -----------------------------------------------------------------------------
-# ROA Validation
-# -----------------------------------------------------------------------------
-
-function check_roa() -> bool {
-    if (net.type = NET_IP4) then {
-        if (roa_check(dn42_roa4, net, bgp_path.last) = ROA_INVALID) then {
-            return false;
-        }
-    } else {
-        if (roa_check(dn42_roa6, net, bgp_path.last) = ROA_INVALID) then {
-            return false;
-        }
-    }
-    return true;
-}
-
-# -----------------------------------------------------------------------------
-# Import/Export Filters
-# -----------------------------------------------------------------------------
-
-function update_local_pref_from_latency() {
-    bgp_local_pref = 100;
-    if (DN42_LATENCY_0 ~ bgp_community) then bgp_local_pref = 260;
-    if (DN42_LATENCY_1 ~ bgp_community) then bgp_local_pref = 250;
-    if (DN42_LATENCY_2 ~ bgp_community) then bgp_local_pref = 240;
-    if (DN42_LATENCY_3 ~ bgp_community) then bgp_local_pref = 230;
-    if (DN42_LATENCY_4 ~ bgp_community) then bgp_local_pref = 220;
-    if (DN42_LATENCY_5 ~ bgp_community) then bgp_local_pref = 210;
-    if (DN42_LATENCY_6 ~ bgp_community) then bgp_local_pref = 200;
-    if (DN42_LATENCY_7 ~ bgp_community) then bgp_local_pref = 150;
-    if (DN42_LATENCY_8 ~ bgp_community) then bgp_local_pref = 100;
-    if (GRACEFUL_SHUTDOWN ~ bgp_community) then bgp_local_pref = 0;
-}
-
-filter dn42_import_filter {
-    if (bgp_path.len > {{.Policy.ASPathMaxLen}}) then {
-        bgp_large_community.add(LC_REJECT_PATH_LEN);
-        reject "AS path too long";
-    }
-    # Check prefix validity based on address family
-    if (net.type = NET_IP4) then {
-        if (!is_valid_dn42_prefix()) then {
-            bgp_large_community.add(LC_REJECT_PREFIX);
-            reject "Invalid DN42 prefix";
-        }
-    } else {
-        if (!is_valid_dn42_prefix6()) then {
-            bgp_large_community.add(LC_REJECT_PREFIX);
-            reject "Invalid DN42 prefix";
-        }
-    }
-    if (!check_roa()) then {
-        bgp_large_community.add(LC_REJECT_ROA);
-        reject "ROA check failed";
-    }
-    update_local_pref_from_latency();
-    bgp_large_community.add(LC_ACCEPTED_HERE);
-    accept;
-}
-
-# -----------------------------------------------------------------------------
-# Add our communities ONLY to self-originated routes
-# IMPORTANT: Never add region/crypto communities to foreign prefixes!
-# -----------------------------------------------------------------------------
-function add_self_origin_communities() {
-    # Only called for our own announcements (static/device routes)
-    bgp_community.add(OUR_REGION);    # Our region (from config)
-    bgp_community.add(OUR_BANDWIDTH); # Our bandwidth (from config)
-    bgp_community.add(DN42_CRYPTO_ENCRYPTED);  # WireGuard
-    bgp_community.add(DN42_LATENCY_3);    # Default latency tier
-}
-
-filter dn42_export_filter {
-    # Check prefix validity based on address family
-    if (net.type = NET_IP4) then {
-        if (!is_valid_dn42_prefix()) then reject;
-    } else {
-        if (!is_valid_dn42_prefix6()) then reject;
-    }
-    
-    # Self-originated routes: add our communities
-    if (source = RTS_STATIC || source = RTS_DEVICE) then {
-        add_self_origin_communities();
-        accept;
-    }
-    
-    # BGP-learned routes: pass through WITHOUT modifying communities
-    # This prevents polluting foreign prefixes with our region tags
-    if (source = RTS_BGP) then {
-        accept;
-    }
-    
-    reject;
-}
-`
-
-// communitiesTemplate is the Go template for moenet_communities.conf
-const communitiesTemplate = `# =============================================================================
-# MoeNet Large Community Definitions
-# For internal cold potato routing within MoeNet backbone
-# Auto-generated by moenet-agent
-# =============================================================================
-
-# Node Info: {{.Node.Name}} (ID: {{.Node.ID}}, Region: {{.Node.RegionCode}})
-# Bandwidth: {{.Node.Bandwidth}}
-
-# Our ASN
-define MOENET_ASN = {{.Policy.DN42As}};
-
-# -----------------------------------------------------------------------------
-# Type 1: Continent Origin (for cold potato routing)
-# Format: (4242420998, 1, <continent_code>)
-# -----------------------------------------------------------------------------
-define LC_ORIGIN_AS = (MOENET_ASN, 1, 100);  # Asia
-define LC_ORIGIN_NA = (MOENET_ASN, 1, 200);  # North America
-define LC_ORIGIN_EU = (MOENET_ASN, 1, 300);  # Europe
-define LC_ORIGIN_OC = (MOENET_ASN, 1, 400);  # Oceania
-define LC_ORIGIN_OTHER = (MOENET_ASN, 1, 500);  # Other (AF, ME, SA, CA)
-
-# -----------------------------------------------------------------------------
-# Type 2: Sub-region (more granular routing)
-# Format: (4242420998, 2, <subregion_code>)
-# Codes: 1xx=Asia, 2xx=NA, 3xx=EU, 4xx=OC, 5xx=Other
-# -----------------------------------------------------------------------------
-
-# Asia (matching DN42 standard)
-define LC_REGION_AS_E  = (MOENET_ASN, 2, 101);  # East Asia: HK, JP, KR, TW
-define LC_REGION_AS_SE = (MOENET_ASN, 2, 102);  # Southeast: SG, MY
-define LC_REGION_AS_S  = (MOENET_ASN, 2, 103);  # South: IN
-define LC_REGION_AS_N  = (MOENET_ASN, 2, 104);  # North: RU/Siberia
-
-# North America (matching DN42 standard)
-define LC_REGION_NA_E = (MOENET_ASN, 2, 201);  # East coast
-define LC_REGION_NA_C = (MOENET_ASN, 2, 202);  # Central
-define LC_REGION_NA_W = (MOENET_ASN, 2, 203);  # West coast
-define LC_REGION_CA   = (MOENET_ASN, 2, 204);  # Central America
-define LC_REGION_SA   = (MOENET_ASN, 2, 205);  # South America
-
-# Europe (MoeNet extension, DN42 only has eu)
-define LC_REGION_EU_W = (MOENET_ASN, 2, 301);  # Western: GB, FR
-define LC_REGION_EU_C = (MOENET_ASN, 2, 302);  # Central: DE, CH, NL
-define LC_REGION_EU_E = (MOENET_ASN, 2, 303);  # Eastern: PL, RU-West
-
-# Oceania
-define LC_REGION_OC = (MOENET_ASN, 2, 401);    # AU, NZ
-
-# Other regions
-define LC_REGION_AF = (MOENET_ASN, 2, 501);    # Africa
-define LC_REGION_ME = (MOENET_ASN, 2, 502);    # Middle East
-
-# -----------------------------------------------------------------------------
-# Type 4: Link Characteristics
-# Format: (4242420998, 4, <characteristic>)
-# -----------------------------------------------------------------------------
-define LC_LINK_INTERCONT = (MOENET_ASN, 4, 1);   # Intercontinental link
-define LC_LINK_HIGH_LAT  = (MOENET_ASN, 4, 2);   # High latency (>200ms)
-define LC_LINK_LOW_MTU   = (MOENET_ASN, 4, 3);   # Low MTU (<1400)
-
-# -----------------------------------------------------------------------------
-# Type 5: Granular Bandwidth (MoeNet internal only)
-# Format: (4242420998, 5, <bandwidth_mbps>)
-# Used for iBGP path selection within MoeNet backbone
-# -----------------------------------------------------------------------------
-define LC_BW_10G   = (MOENET_ASN, 5, 10000);  # 10 Gbps
-define LC_BW_5G    = (MOENET_ASN, 5, 5000);   # 5 Gbps
-define LC_BW_2G    = (MOENET_ASN, 5, 2000);   # 2 Gbps
-define LC_BW_1G    = (MOENET_ASN, 5, 1000);   # 1 Gbps
-define LC_BW_500M  = (MOENET_ASN, 5, 500);    # 500 Mbps
-define LC_BW_200M  = (MOENET_ASN, 5, 200);    # 200 Mbps
-define LC_BW_100M  = (MOENET_ASN, 5, 100);    # 100 Mbps
-define LC_BW_50M   = (MOENET_ASN, 5, 50);     # 50 Mbps
-define LC_BW_10M   = (MOENET_ASN, 5, 10);     # 10 Mbps
-
-# Our node's bandwidth
-define OUR_LC_BANDWIDTH = LC_BW_{{.Node.Bandwidth}};
-
-# -----------------------------------------------------------------------------
-# Helper: Map sub-region to continent
-# -----------------------------------------------------------------------------
-function get_continent_from_region(pair region) -> lc {
-    if region = LC_REGION_AS_E  then return LC_ORIGIN_AS;
-    if region = LC_REGION_AS_SE then return LC_ORIGIN_AS;
-    if region = LC_REGION_AS_S  then return LC_ORIGIN_AS;
-    if region = LC_REGION_AS_N  then return LC_ORIGIN_AS;
-    if region = LC_REGION_NA_E  then return LC_ORIGIN_NA;
-    if region = LC_REGION_NA_C  then return LC_ORIGIN_NA;
-    if region = LC_REGION_NA_W  then return LC_ORIGIN_NA;
-    if region = LC_REGION_CA    then return LC_ORIGIN_NA;
-    if region = LC_REGION_SA    then return LC_ORIGIN_OTHER;
-    if region = LC_REGION_EU_W  then return LC_ORIGIN_EU;
-    if region = LC_REGION_EU_C  then return LC_ORIGIN_EU;
-    if region = LC_REGION_EU_E  then return LC_ORIGIN_EU;
-    if region = LC_REGION_OC    then return LC_ORIGIN_OC;
-    if region = LC_REGION_AF    then return LC_ORIGIN_OTHER;
-    if region = LC_REGION_ME    then return LC_ORIGIN_OTHER;
-    return (0, 0, 0);
-}
-
-# -----------------------------------------------------------------------------
-# Helper: Add MoeNet bandwidth to iBGP routes
-# Call this in iBGP export filter
-# -----------------------------------------------------------------------------
-function add_moenet_bandwidth() {
-    bgp_large_community.delete([(MOENET_ASN, 5, *)]);
-    bgp_large_community.add(OUR_LC_BANDWIDTH);
-}
-`
-
-// babelTemplate is the Go template for babel.conf (Babel IGP for mesh)
-const babelTemplate = `# Babel IGP Configuration - Auto-generated by MoeNet Agent
-# Purpose: Exchange loopback addresses for iBGP next-hop reachability
-# Mode: P2P (one interface per peer)
-# DO NOT EDIT MANUALLY
-
-protocol babel babel_igp {
-    # P2P mode: each peer has its own interface (dn42-wg-igp-{node_id})
-    # Using wildcard to match all mesh interfaces
-
-    interface "dn42-wg-igp-*" {
-        type tunnel;            # WireGuard is a tunnel interface
-        rxcost 64;              # Higher base cost, reduces RTT impact ratio
-
-        # Hybrid approach: RTT for path selection, not for reachability
-        # Low RTT weight + extreme threshold = smart routing without 65535
-        rtt cost 32;            # Reduced weight (was 96)
-        rtt min 200 ms;         # Start adding cost above 200ms
-        rtt max 10000 ms;       # Extreme ceiling - RTT up to 10s still just "slow" not "dead"
-
-        # Long intervals for stability on unreliable links
-        hello interval 10 s;    # ~30s before neighbor timeout
-        update interval 40 s;
-    };
-
-    # Dummy0 interface for loopback address announcement
-    interface "dummy0" {
-        type wired;
-        rxcost 1;               # Very low cost for local interface
-        hello interval 10 s;    # Match tunnel interfaces
-        update interval 40 s;
-    };
-
-    ipv4 {
-        # Exchange IPv4 loopback addresses for iBGP next-hop reachability
-        import filter {
-            # Only accept /32 loopback addresses within our loopback range
-            if net.len = 32 && net ~ 172.22.188.0/26 then accept;
-            reject;
-        };
-        export filter {
-            # Only export our own loopback address
-            if net.len = 32 && net ~ 172.22.188.0/26 then accept;
-            reject;
-        };
-    };
-
-    ipv6 {
-        # CRITICAL: Only exchange loopback addresses!
-        # Never propagate DN42 full table via Babel - use iBGP for that
-        import filter {
-            # Only accept /128 loopback addresses within our loopback range
-            if net.len = 128 && net ~ fd00:4242:7777::/48 then accept;
-            reject;
-        };
-        export filter {
-            # Only export our own loopback address
-            if net.len = 128 && net ~ fd00:4242:7777::/48 then accept;
-            reject;
-        };
-    };
-}
-`
-
-// coldPotatoTemplate is the Go template for cold_potato.conf
-const coldPotatoTemplate = `# =============================================================================
-# MoeNet Cold Potato Routing Functions
-# Keep traffic inside backbone as long as possible
-# Auto-generated by moenet-agent
-# =============================================================================
-
-# Our node's identity
-define OUR_NODE_ID = {{.Node.ID}};
-define OUR_CONTINENT = {{.Node.ContinentLC}};
-define OUR_SUBREGION = {{.Node.SubregionLC}};
-
-# Adjacent continent pairs (lower penalty)
-# AS <-> OC, NA <-> EU
-function is_adjacent_continent(lc origin) -> bool {
-    if (OUR_CONTINENT = LC_ORIGIN_AS) then {
-        if (origin = LC_ORIGIN_OC) then return true;
-    }
-    if (OUR_CONTINENT = LC_ORIGIN_OC) then {
-        if (origin = LC_ORIGIN_AS) then return true;
-    }
-    if (OUR_CONTINENT = LC_ORIGIN_NA) then {
-        if (origin = LC_ORIGIN_EU) then return true;
-    }
-    if (OUR_CONTINENT = LC_ORIGIN_EU) then {
-        if (origin = LC_ORIGIN_NA) then return true;
-    }
-    return false;
-}
-
-# -----------------------------------------------------------------------------
-# Cold Potato: Set local_pref based on route origin
-# Prefer routes that stay in our backbone longer
-# -----------------------------------------------------------------------------
-function apply_cold_potato() {
-    # Start with base local_pref from latency
-    # (assumes update_local_pref_from_latency() was called first)
-    
-    # Check origin continent from Large Community
-    lc origin_continent = (0, 0, 0);
-    lc origin_subregion = (0, 0, 0);
-    
-    # Extract origin from large communities
-    if (LC_ORIGIN_AS ~ bgp_large_community) then origin_continent = LC_ORIGIN_AS;
-    else if (LC_ORIGIN_NA ~ bgp_large_community) then origin_continent = LC_ORIGIN_NA;
-    else if (LC_ORIGIN_EU ~ bgp_large_community) then origin_continent = LC_ORIGIN_EU;
-    else if (LC_ORIGIN_OC ~ bgp_large_community) then origin_continent = LC_ORIGIN_OC;
-    
-    # Extract subregion
-    if (LC_REGION_AS_E ~ bgp_large_community) then origin_subregion = LC_REGION_AS_E;
-    else if (LC_REGION_AS_SE ~ bgp_large_community) then origin_subregion = LC_REGION_AS_SE;
-    else if (LC_REGION_EU_W ~ bgp_large_community) then origin_subregion = LC_REGION_EU_W;
-    else if (LC_REGION_EU_C ~ bgp_large_community) then origin_subregion = LC_REGION_EU_C;
-    else if (LC_REGION_NA_E ~ bgp_large_community) then origin_subregion = LC_REGION_NA_E;
-    else if (LC_REGION_NA_W ~ bgp_large_community) then origin_subregion = LC_REGION_NA_W;
-    else if (LC_REGION_OC ~ bgp_large_community) then origin_subregion = LC_REGION_OC;
-    
-    # Apply cold potato preference
-    if (origin_subregion = OUR_SUBREGION) then {
-        # Same sub-region: highest preference
-        bgp_local_pref = bgp_local_pref + 100;
-    } else if (origin_continent = OUR_CONTINENT) then {
-        # Same continent, different sub-region
-        bgp_local_pref = bgp_local_pref + 50;
-    } else if is_adjacent_continent(origin_continent) then {
-        # Adjacent continent (AS<->OC, NA<->EU)
-        bgp_local_pref = bgp_local_pref - 50;
-    } else if (origin_continent != (0, 0, 0)) then {
-        # Intercontinental (far)
-        bgp_local_pref = bgp_local_pref - 200;
-    }
-    
-    # Penalize marked intercontinental links
-    if (LC_LINK_INTERCONT ~ bgp_large_community) then {
-        bgp_local_pref = bgp_local_pref - 50;
-    }
-    
-    # Penalize high latency links
-    if (LC_LINK_HIGH_LAT ~ bgp_large_community) then {
-        bgp_local_pref = bgp_local_pref - 30;
-    }
+// birdConfigFile maps a template to the file it renders to in confDir
+type birdConfigFile struct {
+	template string
+	file     string
 }
 
-# -----------------------------------------------------------------------------
-# Tag outgoing routes with our origin information
-# -----------------------------------------------------------------------------
-function tag_moenet_origin() {
-    # Remove old MoeNet tags
-    bgp_large_community.delete([(MOENET_ASN, 1, *)]);
-    bgp_large_community.delete([(MOENET_ASN, 2, *)]);
-    bgp_large_community.delete([(MOENET_ASN, 3, *)]);
-    
-    # Add our origin
-    bgp_large_community.add(OUR_CONTINENT);
-    bgp_large_community.add(OUR_SUBREGION);
-    bgp_large_community.add((MOENET_ASN, 3, OUR_NODE_ID));
+// birdConfigFiles lists the policy files rendered from the CP configuration
+var birdConfigFiles = []birdConfigFile{
+	{bird.TemplateFilters, "filters.conf"},
+	{bird.TemplateCommunities, "moenet_communities.conf"},
+	{bird.TemplateBabel, "babel.conf"}, // Babel IGP
+	{bird.TemplateColdPotato, "cold_potato.conf"},
+	{bird.TemplateBirdConf, "bird.conf"}, // Main config
 }
 
-# -----------------------------------------------------------------------------
-# iBGP import filter with cold potato
-# -----------------------------------------------------------------------------
-function moenet_ibgp_import() -> bool {
-    # Apply standard DN42 checks
-    if !is_valid_dn42_prefix() then return false;
-    
-    # Apply latency-based local_pref first
-    update_local_pref_from_latency();
-    
-    # Then apply cold potato adjustments
-    apply_cold_potato();
-    
-    return true;
-}
-
-# -----------------------------------------------------------------------------
-# iBGP export filter: tag with our origin
-# -----------------------------------------------------------------------------
-function moenet_ibgp_export() -> bool {
-    if !is_valid_dn42_prefix() then return false;
-    
-    # Tag with our origin info for cold potato
-    tag_moenet_origin();
-    
-    return true;
-}
-`
-
-// birdConfTemplate is the template for the main bird.conf
-// This replaces legacy Ansible-managed configuration
-const birdConfTemplate = `# =============================================================================
-# {{.Node.Name}} - BIRD Configuration
-# MOENET-DN42 - AS4242420998
-# Auto-generated by moenet-agent - DO NOT EDIT MANUALLY
-# =============================================================================
-
-log syslog all;
-router id {{.Node.LoopbackIPv4}};
-
-protocol device {
-    scan time 10;
+// renderTemplate executes a template against the CP configuration
+func (s *BirdConfigSync) renderTemplate(name string, cfg *BirdConfigResponse) ([]byte, error) {
+	return s.renderer.Render(name, cfg)
 }
-
-protocol direct direct1 {
-    ipv4;
-    ipv6;
-    interface "dn42*", "dummy0", "lo";
-}
-
-# =============================================================================
-# Static Protocol - Announce our aggregate prefixes to DN42
-# Using blackhole type with LOW preference (10) so:
-# 1. iBGP routes (preference 100) and Babel routes (130) always win for internal traffic
-# 2. Blackhole routes are still exported to BGP for aggregate announcement
-# 3. Blackhole routes are rejected by kernel export (won't block internal traffic)
-# =============================================================================
-protocol static static_v4 {
-    ipv4 {
-        preference 10;  # Low preference so iBGP/Babel routes win
-    };
-    # MoeNet IPv4 aggregate - matches ROA 172.22.188.0/26
-    route 172.22.188.0/26 blackhole;
-}
-
-protocol static static_v6 {
-    ipv6 {
-        preference 10;  # Low preference so iBGP/Babel routes win
-    };
-    # MoeNet IPv6 aggregate - matches ROA fd00:4242:7777::/48
-    route fd00:4242:7777::/48 blackhole;
-}
-
-# =============================================================================
-# Kernel Protocol - Export routes to kernel with proper source address
-# CRITICAL: Babel loopback routes are exported FIRST for iBGP reachability
-# =============================================================================
-protocol kernel kernel1 {
-    ipv4 {
-        export filter {
-            # PRIORITY 1: Export Babel loopback routes for iBGP neighbor reachability
-            if source = RTS_BABEL && net.len = 32 && net ~ 172.22.188.0/26 then {
-                krt_prefsrc = {{.Node.LoopbackIPv4}};
-                accept;
-            }
-            # Never export unreachable/blackhole routes
-            if dest = RTD_UNREACHABLE then reject;
-            if dest = RTD_BLACKHOLE then reject;
-            # Export DN42 ranges
-            if net ~ [ 172.16.0.0/12+, 10.0.0.0/8+ ] then {
-                krt_prefsrc = {{.Node.LoopbackIPv4}};
-                accept;
-            }
-            reject;
-        };
-        import filter {
-            if net ~ [ 172.16.0.0/12+, 10.0.0.0/8+ ] then accept;
-            reject;
-        };
-    };
-}
-
-protocol kernel kernel2 {
-    ipv6 {
-        export filter {
-            # PRIORITY 1: Export Babel loopback routes for iBGP neighbor reachability
-            if source = RTS_BABEL && net.len = 128 && net ~ fd00:4242:7777::/48 then {
-                krt_prefsrc = {{.Node.LoopbackIPv6}};
-                accept;
-            }
-            # Never export unreachable/blackhole routes
-            if dest = RTD_UNREACHABLE then reject;
-            if dest = RTD_BLACKHOLE then reject;
-            # Export DN42 IPv6 ranges
-            if net ~ [ fd00::/8+ ] then {
-                krt_prefsrc = {{.Node.LoopbackIPv6}};
-                accept;
-            }
-            reject;
-        };
-        import filter {
-            if net ~ [ fd00::/8+ ] then accept;
-            reject;
-        };
-    };
-}
-
-# ROA tables for DN42
-roa4 table dn42_roa4;
-roa6 table dn42_roa6;
-
-# RPKI ROA for DN42 - Multiple sources for redundancy
-protocol rpki rpki_akae {
-    roa4 { table dn42_roa4; };
-    roa6 { table dn42_roa6; };
-    remote "rpki.akae.re" port 8082;
-    retry keep 90;
-    refresh keep 900;
-    expire keep 172800;
-}
-
-protocol rpki rpki_launchpadx {
-    roa4 { table dn42_roa4; };
-    roa6 { table dn42_roa6; };
-    remote "rpki.dn42.launchpadx.top" port 8082;
-    retry keep 90;
-    refresh keep 900;
-    expire keep 172800;
-}
-
-# =============================================================================
-# Babel IGP - Managed by moenet-agent
-# Used for loopback route propagation, supports mesh topology changes
-# =============================================================================
-include "babel.conf";
-
-# Include optimizations and filters (managed by moenet-agent)
-include "maintenance.conf";
-include "filters.conf";
-include "blacklist.conf";
-include "moenet_communities.conf";
-include "cold_potato.conf";
-
-# =============================================================================
-# eBGP Template - External peers (supports LLA)
-# =============================================================================
-template bgp dn42_peer {
-    local as 4242420998;
-    
-    graceful restart on;
-    graceful restart time 120;
-    
-    ipv4 {
-        import limit 10000 action warn;
-        export limit 5000 action warn;
-        import filter dn42_import_filter;
-        export filter dn42_export_filter;
-        extended next hop on;
-        next hop self;
-    };
-    ipv6 {
-        import limit 10000 action warn;
-        export limit 5000 action warn;
-        import filter dn42_import_filter;
-        export filter dn42_export_filter;
-        next hop self;
-    };
-}
-
-# =============================================================================
-# iBGP Template - Internal connections (RR <-> Edge)
-# Uses loopback as source, reachable via Babel IGP
-# =============================================================================
-template bgp dn42_internal {
-    local as 4242420998;
-    hold time 240;
-    keepalive time 80;
-    connect retry time 30;
-    error wait time 60, 300;
-    error forget time 1800;
-    
-    graceful restart on;
-    graceful restart time 120;
-    
-    source address {{.Node.LoopbackIPv6}};
-    
-    ipv4 {
-        import limit 20000 action warn;
-        export limit 30000 action warn;
-        import filter {
-            if (GRACEFUL_SHUTDOWN ~ bgp_community) then {
-                bgp_local_pref = 0;
-            }
-            accept;
-        };
-        export filter { 
-            add_moenet_bandwidth();
-            if (MAINTENANCE_MODE) then {
-                bgp_community.add(GRACEFUL_SHUTDOWN);
-            }
-            accept; 
-        };
-        extended next hop on;
-        add paths rx;
-    };
-    ipv6 {
-        import limit 25000 action warn;
-        export limit 30000 action warn;
-        import filter {
-            if (GRACEFUL_SHUTDOWN ~ bgp_community) then {
-                bgp_local_pref = 0;
-            }
-            accept;
-        };
-        export filter { 
-            add_moenet_bandwidth();
-            if (MAINTENANCE_MODE) then {
-                bgp_community.add(GRACEFUL_SHUTDOWN);
-            }
-            accept; 
-        };
-        add paths rx;
-    };
-}
-
-# =============================================================================
-# DN42 Global Route Collector (GRC) - AS4242422602
-# https://wiki.dn42.dev/services/Route-Collector
-# GRC only COLLECTS routes (does not announce routes back)
-# =============================================================================
-protocol bgp Route_Collector from dn42_peer {
-    description "DN42 GRC (Route Collector) IPv6";
-    neighbor fd42:d42:d42:179::1 as 4242422602;
-    source address {{.Node.LoopbackIPv6}};
-    
-    # Multihop required - GRC is not directly connected
-    multihop 64;
-    
-    # Don't import anything from GRC (they only collect)
-    ipv4 {
-        import none;
-        export filter dn42_export_filter;
-        extended next hop on;
-        # Export all available paths to the collector (per DN42 Wiki)
-        add paths tx;
-    };
-    ipv6 {
-        import none;
-        export filter dn42_export_filter;
-        # Export all available paths to the collector (per DN42 Wiki)
-        add paths tx;
-    };
-}
-
-# Peer configurations
-include "/etc/bird/peers/*.conf";
-
-# iBGP configurations managed by Agent
-include "/etc/bird/ibgp.d/*.conf";
-`
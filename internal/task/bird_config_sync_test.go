@@ -0,0 +1,118 @@
+package task
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/moenet/moenet-agent/internal/bird"
+	"github.com/moenet/moenet-agent/internal/config"
+)
+
+func testNodeConfig() config.NodeConfig {
+	return config.NodeConfig{
+		Name:       "test-node",
+		ASN:        4242420998,
+		IPv4Prefix: "172.22.188.0/26",
+		IPv6Prefix: "fd00:4242:7777::/48",
+	}
+}
+
+// testRenderer returns a renderer with the embedded templates
+func testRenderer(t *testing.T) *bird.Renderer {
+	t.Helper()
+	r, err := bird.NewRenderer("")
+	if err != nil {
+		t.Fatalf("NewRenderer failed: %v", err)
+	}
+	return r
+}
+
+// testBirdConfig returns a CP configuration with the policy defaults applied
+func testBirdConfig() *BirdConfigResponse {
+	cfg := &BirdConfigResponse{
+		ConfigHash: "abc123",
+		Node: BirdNodeConfig{
+			ID: 4, Name: "test-node", Bandwidth: "1G", RegionCode: 302,
+			LoopbackIPv4: "172.22.188.1", LoopbackIPv6: "fd00:4242:7777::1",
+			ContinentLC: "LC_ORIGIN_EU", SubregionLC: "LC_REGION_EU_C",
+			RegionCommunity: "DN42_REGION_EU", BandwidthCommunity: "DN42_BW_1G_PLUS",
+		},
+	}
+	fillPolicyDefaults(&cfg.Policy, testNodeConfig())
+	return cfg
+}
+
+func TestRenderPolicyFiles(t *testing.T) {
+	s := NewBirdConfigSync(&config.Config{}, nil, nil, nil, testRenderer(t))
+	cfg := testBirdConfig()
+
+	expected := map[string][]string{
+		"filters.conf": {
+			"Config Hash: abc123",
+			"define OUR_REGION = DN42_REGION_EU;",
+			"define LC_ACCEPTED_HERE = (4242420998, 100, 4);",
+			"if (bgp_path.len > 25) then {",
+		},
+		"moenet_communities.conf": {
+			"define MOENET_ASN = 4242420998;",
+		},
+		"babel.conf": {
+			"protocol babel babel_igp {",
+			"if net.len = 32 && net ~ 172.22.188.0/26 then accept;",
+			"if net.len = 128 && net ~ fd00:4242:7777::/48 then accept;",
+		},
+		"cold_potato.conf": {
+			"bgp_large_community.add((MOENET_ASN, 3, OUR_NODE_ID));",
+		},
+		"bird.conf": {
+			"router id 172.22.188.1;",
+			"local as 4242420998;",
+			"route 172.22.188.0/26 blackhole;",
+			"route fd00:4242:7777::/48 blackhole;",
+			"neighbor fd42:d42:d42:179::1 as 4242422602;",
+			"source address fd00:4242:7777::1;",
+			"import limit 10000 action warn;",
+			"import limit 20000 action warn;",
+			"import limit 25000 action warn;",
+			"export limit 30000 action warn;",
+			"protocol rpki rpki_akae {",
+			`remote "rpki.dn42.launchpadx.top" port 8082;`,
+			"expire keep 172800;",
+		},
+	}
+
+	for _, f := range birdConfigFiles {
+		t.Run(f.file, func(t *testing.T) {
+			content, err := s.renderTemplate(f.template, cfg)
+			if err != nil {
+				t.Fatalf("renderTemplate failed: %v", err)
+			}
+			if strings.Contains(string(content), "<no value>") {
+				t.Errorf("Expected all template fields to be set in %s", f.file)
+			}
+			wants, ok := expected[f.file]
+			if !ok {
+				t.Fatalf("No expectations for %s", f.file)
+			}
+			for _, want := range wants {
+				if !strings.Contains(string(content), want) {
+					t.Errorf("Expected %s to contain %q", f.file, want)
+				}
+			}
+		})
+	}
+}
+
+func TestRenderBirdConfRouteCollectorDisabled(t *testing.T) {
+	s := NewBirdConfigSync(&config.Config{}, nil, nil, nil, testRenderer(t))
+	cfg := testBirdConfig()
+	cfg.Policy.RouteCollector.Disabled = true
+
+	content, err := s.renderTemplate(bird.TemplateBirdConf, cfg)
+	if err != nil {
+		t.Fatalf("renderTemplate failed: %v", err)
+	}
+	if strings.Contains(string(content), "Route_Collector") {
+		t.Error("Expected no route collector session when disabled")
+	}
+}
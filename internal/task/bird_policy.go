@@ -0,0 +1,215 @@
+package task
+
+import (
+	"fmt"
+	"net/netip"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/moenet/moenet-agent/internal/config"
+)
+
+// DN42 Global Route Collector, peered with unless CP sets another collector
+const (
+	defaultCollectorNeighbor = "fd42:d42:d42:179::1"
+	defaultCollectorASN      = 4242422602
+)
+
+// Limits used when the policy leaves them unset
+const (
+	defaultEBGPImportLimit     = 10000
+	defaultEBGPExportLimit     = 5000
+	defaultIBGPImportLimitIPv4 = 20000
+	defaultIBGPImportLimitIPv6 = 25000
+	defaultIBGPExportLimit     = 30000
+	maxRouteLimit              = 1000000 // Far above the DN42 table
+	defaultASPathMaxLen        = 25
+	maxASPathLen               = 255
+)
+
+// RPKI-RTR timers in seconds used when a server leaves them unset
+const (
+	defaultRPKIRefresh = 900
+	defaultRPKIRetry   = 90
+	defaultRPKIExpire  = 172800
+)
+
+// defaultRPKIServers are used when the policy lists no RPKI server
+var defaultRPKIServers = []RPKIServer{
+	{Name: "akae", Host: "rpki.akae.re", Port: 8082},
+	{Name: "launchpadx", Host: "rpki.dn42.launchpadx.top", Port: 8082},
+}
+
+// rpkiNamePattern matches names usable in a BIRD protocol name
+var rpkiNamePattern = regexp.MustCompile(`^[A-Za-z0-9_]+$`)
+
+// fillPolicyDefaults completes the policy with the local AS and aggregate
+// prefixes of the node config and the defaults for everything else left
+// unset. Values set by CP are kept; validatePolicy rejects those that
+// contradict the node config.
+func fillPolicyDefaults(policy *BirdPolicy, node config.NodeConfig) {
+	if policy.DN42As == "" && node.ASN != 0 {
+		policy.DN42As = strconv.FormatUint(uint64(node.ASN), 10)
+	}
+	if policy.DN42Ipv4Prefix == "" {
+		policy.DN42Ipv4Prefix = node.IPv4Prefix
+	}
+	if policy.DN42Ipv6Prefix == "" {
+		policy.DN42Ipv6Prefix = node.IPv6Prefix
+	}
+
+	if policy.RouteCollector.Neighbor == "" {
+		policy.RouteCollector.Neighbor = defaultCollectorNeighbor
+	}
+	if policy.RouteCollector.ASN == 0 {
+		policy.RouteCollector.ASN = defaultCollectorASN
+	}
+
+	setLimitDefault(&policy.EBGPImportLimit, defaultEBGPImportLimit)
+	setLimitDefault(&policy.EBGPExportLimit, defaultEBGPExportLimit)
+	setLimitDefault(&policy.IBGPExportLimit, defaultIBGPExportLimit)
+	// ibgpImportLimit sets both families, each defaulting on its own
+	if policy.IBGPImportLimit != nil {
+		setLimitDefault(&policy.IBGPImportLimitIPv4, *policy.IBGPImportLimit)
+		setLimitDefault(&policy.IBGPImportLimitIPv6, *policy.IBGPImportLimit)
+	}
+	setLimitDefault(&policy.IBGPImportLimitIPv4, defaultIBGPImportLimitIPv4)
+	setLimitDefault(&policy.IBGPImportLimitIPv6, defaultIBGPImportLimitIPv6)
+	setDefault(&policy.ASPathMaxLen, defaultASPathMaxLen)
+
+	if len(policy.RPKIServers) == 0 {
+		policy.RPKIServers = append([]RPKIServer(nil), defaultRPKIServers...)
+	}
+	for i := range policy.RPKIServers {
+		server := &policy.RPKIServers[i]
+		if server.Name == "" {
+			server.Name = strconv.Itoa(i + 1)
+		}
+		setDefault(&server.Refresh, defaultRPKIRefresh)
+		setDefault(&server.Retry, defaultRPKIRetry)
+		setDefault(&server.Expire, defaultRPKIExpire)
+	}
+}
+
+// setDefault sets an unset value
+func setDefault(value *int, def int) {
+	if *value == 0 {
+		*value = def
+	}
+}
+
+// setLimitDefault sets an unset route limit. Limits set to 0 by CP are kept,
+// for validatePolicy to reject.
+func setLimitDefault(limit **int, def int) {
+	if *limit == nil {
+		*limit = &def
+	}
+}
+
+// validatePolicy rejects policy values that would render a broken or
+// useless BIRD config. Call it after fillPolicyDefaults.
+func validatePolicy(policy *BirdPolicy, node config.NodeConfig) error {
+	if err := validateLocalAS(policy, node); err != nil {
+		return err
+	}
+
+	limits := []struct {
+		field string
+		value *int
+	}{
+		{"ebgpImportLimit", policy.EBGPImportLimit},
+		{"ebgpExportLimit", policy.EBGPExportLimit},
+		{"ibgpImportLimit", policy.IBGPImportLimit},
+		{"ibgpImportLimitIpv4", policy.IBGPImportLimitIPv4},
+		{"ibgpImportLimitIpv6", policy.IBGPImportLimitIPv6},
+		{"ibgpExportLimit", policy.IBGPExportLimit},
+	}
+	for _, l := range limits {
+		if l.value == nil {
+			continue // Only the ibgpImportLimit shorthand may stay unset
+		}
+		if *l.value < 1 || *l.value > maxRouteLimit {
+			return fmt.Errorf("%s must be between 1 and %d, got %d", l.field, maxRouteLimit, *l.value)
+		}
+	}
+	if policy.ASPathMaxLen < 1 || policy.ASPathMaxLen > maxASPathLen {
+		return fmt.Errorf("asPathMaxLen must be between 1 and %d, got %d", maxASPathLen, policy.ASPathMaxLen)
+	}
+
+	names := make(map[string]bool, len(policy.RPKIServers))
+	for _, server := range policy.RPKIServers {
+		if err := validateRPKIServer(server); err != nil {
+			return fmt.Errorf("RPKI server %q: %w", server.Name, err)
+		}
+		if names[server.Name] {
+			return fmt.Errorf("duplicate RPKI server name %q", server.Name)
+		}
+		names[server.Name] = true
+	}
+	return nil
+}
+
+// validateLocalAS checks the local AS and aggregate prefixes of the policy.
+// Either the node config or CP must supply them, and where both do they
+// must agree: bird.conf, iBGP and the mesh tunnels all use the same values.
+func validateLocalAS(policy *BirdPolicy, node config.NodeConfig) error {
+	if policy.DN42As == "" {
+		return fmt.Errorf("no local AS: set node.asn or dn42As in the CP policy")
+	}
+	asn, err := strconv.ParseUint(policy.DN42As, 10, 32)
+	if err != nil || asn == 0 {
+		return fmt.Errorf("invalid dn42As %q", policy.DN42As)
+	}
+	if node.ASN != 0 && uint32(asn) != node.ASN {
+		return fmt.Errorf("dn42As %s differs from node.asn %d", policy.DN42As, node.ASN)
+	}
+
+	prefixes := []struct {
+		field, value, nodeField, nodeValue string
+		ipv4                               bool
+	}{
+		{"dn42Ipv4Prefix", policy.DN42Ipv4Prefix, "node.ipv4Prefix", node.IPv4Prefix, true},
+		{"dn42Ipv6Prefix", policy.DN42Ipv6Prefix, "node.ipv6Prefix", node.IPv6Prefix, false},
+	}
+	for _, p := range prefixes {
+		if p.value == "" {
+			return fmt.Errorf("no %s: set %s or send it in the CP policy", p.field, p.nodeField)
+		}
+		if err := config.ValidatePrefix(p.field, p.value, p.ipv4); err != nil {
+			return err
+		}
+		if p.nodeValue != "" && !samePrefix(p.value, p.nodeValue) {
+			return fmt.Errorf("%s %s differs from %s %s", p.field, p.value, p.nodeField, p.nodeValue)
+		}
+	}
+	return nil
+}
+
+// samePrefix reports whether two valid prefixes are equal, however written
+func samePrefix(a, b string) bool {
+	pa, errA := netip.ParsePrefix(a)
+	pb, errB := netip.ParsePrefix(b)
+	return errA == nil && errB == nil && pa == pb
+}
+
+// validateRPKIServer checks a single RPKI server with its defaults applied
+func validateRPKIServer(server RPKIServer) error {
+	if !rpkiNamePattern.MatchString(server.Name) {
+		return fmt.Errorf("name may only contain letters, digits and underscores")
+	}
+	if server.Host == "" || strings.ContainsAny(server.Host, "\" \t\n;{}") {
+		return fmt.Errorf("invalid host %q", server.Host)
+	}
+	if server.Port < 0 || server.Port > 65535 {
+		return fmt.Errorf("invalid port %d", server.Port)
+	}
+	if server.Refresh < 0 || server.Retry < 0 || server.Expire < 0 {
+		return fmt.Errorf("timers must be positive")
+	}
+	if server.Expire <= server.Refresh || server.Expire <= server.Retry {
+		return fmt.Errorf("expire (%ds) must be longer than refresh (%ds) and retry (%ds)",
+			server.Expire, server.Refresh, server.Retry)
+	}
+	return nil
+}
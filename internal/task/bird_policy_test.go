@@ -0,0 +1,180 @@
+package task
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/moenet/moenet-agent/internal/config"
+)
+
+func TestFillPolicyDefaults(t *testing.T) {
+	var policy BirdPolicy
+	fillPolicyDefaults(&policy, testNodeConfig())
+
+	if policy.DN42As != "4242420998" {
+		t.Errorf("Expected dn42As from node config, got %q", policy.DN42As)
+	}
+	if policy.DN42Ipv4Prefix != "172.22.188.0/26" || policy.DN42Ipv6Prefix != "fd00:4242:7777::/48" {
+		t.Errorf("Expected prefixes from node config, got %q and %q", policy.DN42Ipv4Prefix, policy.DN42Ipv6Prefix)
+	}
+	if policy.RouteCollector.Neighbor != defaultCollectorNeighbor || policy.RouteCollector.ASN != defaultCollectorASN {
+		t.Errorf("Expected default route collector, got %+v", policy.RouteCollector)
+	}
+	if *policy.EBGPImportLimit != defaultEBGPImportLimit || *policy.IBGPExportLimit != defaultIBGPExportLimit {
+		t.Errorf("Expected default limits, got %d and %d", *policy.EBGPImportLimit, *policy.IBGPExportLimit)
+	}
+	if *policy.IBGPImportLimitIPv4 != 20000 || *policy.IBGPImportLimitIPv6 != 25000 {
+		t.Errorf("Expected iBGP import limits 20000/25000, got %d/%d", *policy.IBGPImportLimitIPv4, *policy.IBGPImportLimitIPv6)
+	}
+	if policy.ASPathMaxLen != defaultASPathMaxLen {
+		t.Errorf("Expected default AS path length, got %d", policy.ASPathMaxLen)
+	}
+	if len(policy.RPKIServers) != len(defaultRPKIServers) || policy.RPKIServers[0].Expire != defaultRPKIExpire {
+		t.Errorf("Expected default RPKI servers with timers, got %+v", policy.RPKIServers)
+	}
+	if err := validatePolicy(&policy, testNodeConfig()); err != nil {
+		t.Errorf("Expected defaults to be valid, got %v", err)
+	}
+
+	// Values from CP are kept
+	policy = BirdPolicy{
+		DN42As:          "4242421234",
+		RouteCollector:  RouteCollector{Neighbor: "fd42::179", ASN: 4242421235},
+		EBGPImportLimit: limit(500),
+		IBGPImportLimit: limit(40000),
+		RPKIServers:     []RPKIServer{{Host: "rpki.example.dn42", Refresh: 300}},
+	}
+	fillPolicyDefaults(&policy, testNodeConfig())
+	if policy.DN42As != "4242421234" {
+		t.Errorf("Expected dn42As from CP, got %q", policy.DN42As)
+	}
+	if policy.RouteCollector.Neighbor != "fd42::179" || policy.RouteCollector.ASN != 4242421235 {
+		t.Errorf("Expected route collector from CP, got %+v", policy.RouteCollector)
+	}
+	if *policy.EBGPImportLimit != 500 {
+		t.Errorf("Expected eBGP import limit from CP, got %d", *policy.EBGPImportLimit)
+	}
+	if *policy.IBGPImportLimitIPv4 != 40000 || *policy.IBGPImportLimitIPv6 != 40000 {
+		t.Errorf("Expected ibgpImportLimit for both families, got %d/%d", *policy.IBGPImportLimitIPv4, *policy.IBGPImportLimitIPv6)
+	}
+	expected := RPKIServer{Name: "1", Host: "rpki.example.dn42", Refresh: 300, Retry: defaultRPKIRetry, Expire: defaultRPKIExpire}
+	if len(policy.RPKIServers) != 1 || policy.RPKIServers[0] != expected {
+		t.Errorf("Expected %+v, got %+v", expected, policy.RPKIServers)
+	}
+}
+
+// limit returns a route limit as set by CP
+func limit(n int) *int {
+	return &n
+}
+
+func TestValidatePolicy(t *testing.T) {
+	tests := []struct {
+		name    string
+		modify  func(p *BirdPolicy)
+		wantErr bool
+	}{
+		{"defaults", func(p *BirdPolicy) {}, false},
+		{"negative limit", func(p *BirdPolicy) { p.EBGPExportLimit = limit(-1) }, true},
+		{"zero limit", func(p *BirdPolicy) { p.IBGPExportLimit = limit(0) }, true},
+		{"zero family limit", func(p *BirdPolicy) { p.IBGPImportLimitIPv6 = limit(0) }, true},
+		{"absurd limit", func(p *BirdPolicy) { p.EBGPImportLimit = limit(50000000) }, true},
+		{"custom limit", func(p *BirdPolicy) { p.IBGPImportLimitIPv4 = limit(30000) }, false},
+		{"path length too long", func(p *BirdPolicy) { p.ASPathMaxLen = 1000 }, true},
+		{"path length negative", func(p *BirdPolicy) { p.ASPathMaxLen = -5 }, true},
+		{"port out of range", func(p *BirdPolicy) { p.RPKIServers[0].Port = 70000 }, true},
+		{"empty host", func(p *BirdPolicy) { p.RPKIServers[0].Host = "" }, true},
+		{"quote in host", func(p *BirdPolicy) { p.RPKIServers[0].Host = `rpki"; protocol` }, true},
+		{"invalid name", func(p *BirdPolicy) { p.RPKIServers[0].Name = "rpki-1" }, true},
+		{"duplicate name", func(p *BirdPolicy) { p.RPKIServers[1].Name = p.RPKIServers[0].Name }, true},
+		{"expire below refresh", func(p *BirdPolicy) { p.RPKIServers[0].Expire = 600; p.RPKIServers[0].Refresh = 900 }, true},
+		{"custom timers", func(p *BirdPolicy) { p.RPKIServers[0].Refresh = 300; p.RPKIServers[0].Expire = 7200 }, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var policy BirdPolicy
+			fillPolicyDefaults(&policy, testNodeConfig())
+			tt.modify(&policy)
+			err := validatePolicy(&policy, testNodeConfig())
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Expected error %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestValidateLocalAS(t *testing.T) {
+	node := testNodeConfig()
+	bootstrap := config.NodeConfig{Name: "test-node"}
+
+	tests := []struct {
+		name    string
+		node    config.NodeConfig
+		policy  BirdPolicy
+		wantErr bool
+	}{
+		{"from node config", node, BirdPolicy{}, false},
+		{"from policy", bootstrap, BirdPolicy{DN42As: "4242420998", DN42Ipv4Prefix: "172.22.188.0/26", DN42Ipv6Prefix: "fd00:4242:7777::/48"}, false},
+		{"same in both", node, BirdPolicy{DN42As: "4242420998", DN42Ipv6Prefix: "fd00:4242:7777:0::/48"}, false},
+		{"in neither", bootstrap, BirdPolicy{}, true},
+		{"prefix in neither", bootstrap, BirdPolicy{DN42As: "4242420998", DN42Ipv4Prefix: "172.22.188.0/26"}, true},
+		{"asn mismatch", node, BirdPolicy{DN42As: "4242421234"}, true},
+		{"prefix mismatch", node, BirdPolicy{DN42Ipv4Prefix: "172.22.189.0/26"}, true},
+		{"invalid asn", bootstrap, BirdPolicy{DN42As: "AS4242420998", DN42Ipv4Prefix: "172.22.188.0/26", DN42Ipv6Prefix: "fd00:4242:7777::/48"}, true},
+		{"invalid prefix", bootstrap, BirdPolicy{DN42As: "4242420998", DN42Ipv4Prefix: "172.22.188.1/26", DN42Ipv6Prefix: "fd00:4242:7777::/48"}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			policy := tt.policy
+			fillPolicyDefaults(&policy, tt.node)
+			err := validatePolicy(&policy, tt.node)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Expected error %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestLocalASFromPolicy(t *testing.T) {
+	localAS := NewLocalAS(config.NodeConfig{})
+	if localAS.ASN() != 0 {
+		t.Errorf("Expected unknown local AS, got %d", localAS.ASN())
+	}
+
+	localAS.setFromPolicy(&BirdPolicy{DN42As: "4242420998", DN42Ipv4Prefix: "172.22.188.0/26", DN42Ipv6Prefix: "fd00:4242:7777::/48"})
+	if localAS.ASN() != 4242420998 {
+		t.Errorf("Expected local AS from policy, got %d", localAS.ASN())
+	}
+	if ipv4, ipv6 := localAS.Prefixes(); ipv4 != "172.22.188.0/26" || ipv6 != "fd00:4242:7777::/48" {
+		t.Errorf("Expected prefixes from policy, got %q and %q", ipv4, ipv6)
+	}
+}
+
+func TestPolicyLimitsFromJSON(t *testing.T) {
+	tests := []struct {
+		name    string
+		json    string
+		wantErr bool
+	}{
+		{"unset", `{}`, false},
+		{"set", `{"ebgpImportLimit": 2000, "ibgpImportLimitIpv6": 40000}`, false},
+		{"explicit zero", `{"ebgpImportLimit": 0}`, true},
+		{"shorthand zero", `{"ibgpImportLimit": 0}`, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var policy BirdPolicy
+			if err := json.Unmarshal([]byte(tt.json), &policy); err != nil {
+				t.Fatalf("Unmarshal failed: %v", err)
+			}
+			fillPolicyDefaults(&policy, testNodeConfig())
+			err := validatePolicy(&policy, testNodeConfig())
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Expected error %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,133 @@
+package task
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// WireGuard defaults of DN42 sessions
+var defaultAllowedIPs = []string{"0.0.0.0/0", "fd00::/8", "fe80::/64"}
+
+const (
+	defaultKeepalive = 25
+	defaultMTU       = 1420
+	// BGP runs over IPv6 link-local addresses, which need at least 1280
+	minMTU = 1280
+	maxMTU = 9000
+)
+
+// WireGuardCredential is the WireGuard configuration CP sends in the
+// Credential field of a session
+type WireGuardCredential struct {
+	PublicKey    string   `json:"public_key"`
+	PresharedKey string   `json:"preshared_key,omitempty"`
+	ListenPort   *int     `json:"listen_port,omitempty"` // 0 lets the kernel choose
+	Endpoint     string   `json:"endpoint,omitempty"`    // host:port, used if the session has none
+	MTU          int      `json:"mtu,omitempty"`         // Used if the session has none
+	AllowedIPs   []string `json:"allowed_ips,omitempty"` // Overrides the DN42 defaults
+	Keepalive    *int     `json:"keepalive,omitempty"`   // Seconds, 0 disables keepalives
+}
+
+// ParseWireGuardCredential parses and validates the Credential of a
+// WireGuard session. Besides the JSON form, a bare public key is accepted
+// for sessions created before the JSON schema.
+func ParseWireGuardCredential(raw string) (*WireGuardCredential, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return nil, fmt.Errorf("credential is empty")
+	}
+
+	var cred WireGuardCredential
+	if strings.HasPrefix(raw, "{") {
+		if err := json.Unmarshal([]byte(raw), &cred); err != nil {
+			return nil, fmt.Errorf("credential is not valid JSON: %w", err)
+		}
+	} else {
+		if err := validateWireGuardKey(raw); err != nil {
+			return nil, fmt.Errorf("credential is neither JSON nor a public key: %w", err)
+		}
+		cred.PublicKey = raw
+	}
+
+	if err := cred.Validate(); err != nil {
+		return nil, err
+	}
+	return &cred, nil
+}
+
+// Validate checks all fields of the credential
+func (c *WireGuardCredential) Validate() error {
+	if c.PublicKey == "" {
+		return fmt.Errorf("public_key is missing")
+	}
+	if err := validateWireGuardKey(c.PublicKey); err != nil {
+		return fmt.Errorf("public_key: %w", err)
+	}
+	if c.PresharedKey != "" {
+		if err := validateWireGuardKey(c.PresharedKey); err != nil {
+			return fmt.Errorf("preshared_key: %w", err)
+		}
+	}
+	if c.ListenPort != nil && (*c.ListenPort < 0 || *c.ListenPort > 65535) {
+		return fmt.Errorf("listen_port %d out of range 0-65535", *c.ListenPort)
+	}
+	if c.Endpoint != "" {
+		if err := validateEndpoint(c.Endpoint); err != nil {
+			return fmt.Errorf("endpoint: %w", err)
+		}
+	}
+	if c.MTU != 0 {
+		if err := validateMTU(c.MTU); err != nil {
+			return fmt.Errorf("mtu: %w", err)
+		}
+	}
+	for _, prefix := range c.AllowedIPs {
+		if _, _, err := net.ParseCIDR(prefix); err != nil {
+			return fmt.Errorf("allowed_ips: invalid prefix %q", prefix)
+		}
+	}
+	if c.Keepalive != nil && (*c.Keepalive < 0 || *c.Keepalive > 65535) {
+		return fmt.Errorf("keepalive %d out of range 0-65535", *c.Keepalive)
+	}
+	return nil
+}
+
+// validateWireGuardKey checks that key is a base64 encoded 32 byte key
+func validateWireGuardKey(key string) error {
+	decoded, err := base64.StdEncoding.DecodeString(key)
+	if err != nil {
+		return fmt.Errorf("not valid base64")
+	}
+	if len(decoded) != 32 {
+		return fmt.Errorf("decodes to %d bytes, want 32", len(decoded))
+	}
+	return nil
+}
+
+// validateEndpoint checks that endpoint is host:port with a usable port
+func validateEndpoint(endpoint string) error {
+	host, port, err := net.SplitHostPort(endpoint)
+	if err != nil {
+		return fmt.Errorf("%q is not host:port", endpoint)
+	}
+	if host == "" {
+		return fmt.Errorf("%q has no host", endpoint)
+	}
+	n, err := strconv.Atoi(port)
+	if err != nil || n < 1 || n > 65535 {
+		return fmt.Errorf("port %q out of range 1-65535", port)
+	}
+	return nil
+}
+
+// validateMTU checks that mtu is within the bounds supported on tunnels
+func validateMTU(mtu int) error {
+	if mtu < minMTU || mtu > maxMTU {
+		return fmt.Errorf("%d out of range %d-%d", mtu, minMTU, maxMTU)
+	}
+	return nil
+}
@@ -0,0 +1,82 @@
+package task
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/moenet/moenet-agent/internal/config"
+)
+
+// 32 zero bytes and 16 zero bytes, base64 encoded
+const (
+	testKey      = "AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA="
+	testShortKey = "AAAAAAAAAAAAAAAAAAAAAA=="
+)
+
+func TestParseWireGuardCredential(t *testing.T) {
+	tests := []struct {
+		name    string
+		raw     string
+		wantErr string
+	}{
+		{"bare key", testKey, ""},
+		{"json", `{"public_key":"` + testKey + `","preshared_key":"` + testKey + `","listen_port":24001,"endpoint":"peer.example.com:51820","mtu":1420}`, ""},
+		{"overrides", `{"public_key":"` + testKey + `","allowed_ips":["172.20.0.0/14"],"keepalive":0}`, ""},
+		{"empty", "", "credential is empty"},
+		{"garbage", "not-a-key", "neither JSON nor a public key"},
+		{"broken json", `{"public_key":`, "not valid JSON"},
+		{"missing key", `{"endpoint":"1.2.3.4:51820"}`, "public_key is missing"},
+		{"short key", `{"public_key":"` + testShortKey + `"}`, "public_key: decodes to 16 bytes, want 32"},
+		{"bad preshared key", `{"public_key":"` + testKey + `","preshared_key":"???"}`, "preshared_key: not valid base64"},
+		{"port out of range", `{"public_key":"` + testKey + `","listen_port":70000}`, "listen_port 70000 out of range"},
+		{"endpoint without port", `{"public_key":"` + testKey + `","endpoint":"1.2.3.4"}`, "endpoint: \"1.2.3.4\" is not host:port"},
+		{"endpoint port zero", `{"public_key":"` + testKey + `","endpoint":"[fd00::1]:0"}`, "endpoint: port \"0\" out of range"},
+		{"mtu too small", `{"public_key":"` + testKey + `","mtu":1000}`, "mtu: 1000 out of range 1280-9000"},
+		{"bad allowed ip", `{"public_key":"` + testKey + `","allowed_ips":["fd00::"]}`, "allowed_ips: invalid prefix"},
+		{"negative keepalive", `{"public_key":"` + testKey + `","keepalive":-1}`, "keepalive -1 out of range"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cred, err := ParseWireGuardCredential(tt.raw)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("Expected no error, got %v", err)
+				}
+				if cred.PublicKey != testKey {
+					t.Errorf("Expected public key %s, got %s", testKey, cred.PublicKey)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Expected error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestDesiredWireGuardOverrides(t *testing.T) {
+	s := &SessionSync{config: &config.Config{}}
+
+	desired, err := s.desiredWireGuard(&BgpSession{
+		Credential: `{"public_key":"` + testKey + `","allowed_ips":["172.20.0.0/14"],"keepalive":0,"mtu":1380}`,
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(desired.Peer.AllowedIPs) != 1 || desired.Peer.AllowedIPs[0] != "172.20.0.0/14" {
+		t.Errorf("Expected allowed IPs override, got %v", desired.Peer.AllowedIPs)
+	}
+	if desired.Peer.Keepalive != 0 {
+		t.Errorf("Expected keepalive 0, got %d", desired.Peer.Keepalive)
+	}
+	if desired.MTU != 1380 {
+		t.Errorf("Expected MTU 1380, got %d", desired.MTU)
+	}
+
+	// Session fields take precedence and are validated too
+	_, err = s.desiredWireGuard(&BgpSession{Credential: testKey, MTU: 100})
+	if err == nil || !strings.Contains(err.Error(), "invalid MTU") {
+		t.Errorf("Expected invalid MTU error, got %v", err)
+	}
+}
@@ -0,0 +1,199 @@
+package task
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"net/netip"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/moenet/moenet-agent/internal/config"
+	"github.com/moenet/moenet-agent/internal/metrics"
+	"github.com/moenet/moenet-agent/internal/tunnel"
+	"github.com/moenet/moenet-agent/internal/wireguard"
+)
+
+// Endpoint change kinds, used as metric labels
+const (
+	endpointKindSession = "session"
+	endpointKindMesh    = "mesh"
+)
+
+// endpointSetter is the part of wireguard.Executor the resolver uses
+type endpointSetter interface {
+	GetInterfaceState(name string) (*wireguard.InterfaceState, error)
+	SetEndpoint(name, publicKey, endpoint string) error
+}
+
+// tunnelChanger is the part of tunnel.Executor the resolver uses
+type tunnelChanger interface {
+	GetTunnel(name string) (*tunnel.TunnelState, error)
+	CreateTunnel(name, mode, local, remote string) error
+}
+
+// EndpointResolver re-resolves hostname endpoints of eBGP sessions and mesh
+// peers, so tunnels to peers with dynamic DNS follow their address changes.
+// Only the endpoint of a tunnel is touched, and only when the address changed.
+type EndpointResolver struct {
+	config      *config.Config
+	sessionSync *SessionSync
+	meshSync    *MeshSync
+	wgExecutor  endpointSetter
+	tnExecutor  tunnelChanger
+
+	// Lookups, replaced in tests
+	resolveWireGuard func(ctx context.Context, endpoint, family string) (string, error)
+	resolveGRE       func(ctx context.Context, endpoint, mode string) (string, error)
+}
+
+// NewEndpointResolver creates a new endpoint resolver
+func NewEndpointResolver(cfg *config.Config, sessionSync *SessionSync, meshSync *MeshSync, wgExecutor *wireguard.Executor, tnExecutor *tunnel.Executor) *EndpointResolver {
+	return &EndpointResolver{
+		config:           cfg,
+		sessionSync:      sessionSync,
+		meshSync:         meshSync,
+		wgExecutor:       wgExecutor,
+		tnExecutor:       tnExecutor,
+		resolveWireGuard: wireguard.ResolveEndpoint,
+		resolveGRE:       tunnel.ResolveRemote,
+	}
+}
+
+// Run starts the endpoint resolver task
+func (r *EndpointResolver) Run(ctx context.Context, wg *sync.WaitGroup) {
+	defer wg.Done()
+	ticker := time.NewTicker(time.Duration(r.config.WireGuard.EndpointResolveInterval) * time.Second)
+	defer ticker.Stop()
+
+	// No initial run: tunnels are set up with freshly resolved endpoints
+	for {
+		select {
+		case <-ctx.Done():
+			log.Println("[Resolver] Task stopped")
+			return
+		case <-ticker.C:
+			r.Resolve(ctx)
+		}
+	}
+}
+
+// Resolve re-resolves the hostname endpoints of all sessions with a live
+// tunnel and of all mesh peers, updating the tunnels whose address changed
+func (r *EndpointResolver) Resolve(ctx context.Context) {
+	for _, session := range r.sessionSync.GetAllSessions() {
+		switch session.Status {
+		case StatusEnabled, StatusProblem, StatusTeardown:
+			r.resolveSession(ctx, session)
+		}
+	}
+
+	for _, peer := range r.meshSync.GetPeers() {
+		if peer.NodeID == r.config.Node.ID || !wireguard.IsHostnameEndpoint(peer.Endpoint) {
+			continue
+		}
+		desired := r.meshSync.desiredMeshTunnel(&peer)
+		label := fmt.Sprintf("mesh peer %s", peer.NodeName)
+		r.updateWireGuard(ctx, meshInterfaceName(&peer), desired, endpointKindMesh, label)
+	}
+}
+
+// resolveSession updates the tunnel endpoint of a session. The session lock
+// keeps the update from racing with a sync of the same session.
+func (r *EndpointResolver) resolveSession(ctx context.Context, session *BgpSession) {
+	if session.Interface == "" {
+		return
+	}
+
+	unlock := r.sessionSync.sessionLocks.lock(session.UUID)
+	defer unlock()
+
+	label := fmt.Sprintf("AS%d", session.ASN)
+	switch session.Type {
+	case SessionTypeWireGuard:
+		desired, err := r.sessionSync.desiredWireGuard(session)
+		if err != nil || desired == nil || !wireguard.IsHostnameEndpoint(desired.Peer.Endpoint) {
+			return
+		}
+		r.updateWireGuard(ctx, session.Interface, desired, endpointKindSession, label)
+	case SessionTypeGRE, SessionTypeIP6GRE:
+		if isTunnelHostname(session.Endpoint) {
+			r.updateGRE(ctx, session, label)
+		}
+	}
+}
+
+// updateWireGuard points the peer of a WireGuard interface at the current
+// address of its hostname endpoint
+func (r *EndpointResolver) updateWireGuard(ctx context.Context, ifname string, desired *wireguard.InterfaceConfig, kind, label string) {
+	resolved, err := r.resolveWireGuard(ctx, desired.Peer.Endpoint, desired.EndpointFamily)
+	if err != nil {
+		log.Printf("[Resolver] Warning: %s (%s): %v", ifname, label, err)
+		return
+	}
+
+	live, err := r.wgExecutor.GetInterfaceState(ifname)
+	if err != nil {
+		return // Missing interfaces are recreated by the sync tasks
+	}
+	var current string
+	found := false
+	for _, peer := range live.Peers {
+		if peer.PublicKey == desired.Peer.PublicKey {
+			current, found = peer.Endpoint, true
+		}
+	}
+	// A peer with a recent handshake is reachable where WireGuard found it;
+	// forcing the DNS address back would break roaming and NATed peers
+	if !found || current == resolved || live.Roaming(desired.Peer.PublicKey) {
+		return
+	}
+
+	if err := r.wgExecutor.SetEndpoint(ifname, desired.Peer.PublicKey, resolved); err != nil {
+		log.Printf("[Resolver] Warning: failed to update endpoint of %s (%s): %v", ifname, label, err)
+		return
+	}
+	log.Printf("[Resolver] Endpoint %s of %s (%s) moved: %s -> %s",
+		desired.Peer.Endpoint, ifname, label, current, resolved)
+	metrics.Get().RecordEndpointChange(kind)
+}
+
+// updateGRE points a GRE tunnel at the current address of its hostname
+// endpoint, keeping the local address
+func (r *EndpointResolver) updateGRE(ctx context.Context, session *BgpSession, label string) {
+	remote, err := r.resolveGRE(ctx, session.Endpoint, session.Type)
+	if err != nil {
+		log.Printf("[Resolver] Warning: %s (%s): %v", session.Interface, label, err)
+		return
+	}
+
+	live, err := r.tnExecutor.GetTunnel(session.Interface)
+	if err != nil || live.Remote == remote || live.Local == "" {
+		return
+	}
+
+	if err := r.tnExecutor.CreateTunnel(session.Interface, session.Type, live.Local, remote); err != nil {
+		log.Printf("[Resolver] Warning: failed to update endpoint of %s (%s): %v", session.Interface, label, err)
+		return
+	}
+	log.Printf("[Resolver] Endpoint %s of %s (%s) moved: %s -> %s",
+		session.Endpoint, session.Interface, label, live.Remote, remote)
+	metrics.Get().RecordEndpointChange(endpointKindSession)
+}
+
+// isTunnelHostname reports whether a GRE endpoint, with or without port,
+// names a host rather than an IP address
+func isTunnelHostname(endpoint string) bool {
+	host := endpoint
+	if h, _, err := net.SplitHostPort(endpoint); err == nil {
+		host = h
+	}
+	host = strings.Trim(host, "[]")
+	if host == "" {
+		return false
+	}
+	_, err := netip.ParseAddr(host)
+	return err != nil
+}
@@ -0,0 +1,127 @@
+package task
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/moenet/moenet-agent/internal/tunnel"
+	"github.com/moenet/moenet-agent/internal/wireguard"
+)
+
+// fakeEndpoints records endpoint and tunnel changes instead of applying them
+type fakeEndpoints struct {
+	wgState   *wireguard.InterfaceState
+	tunState  *tunnel.TunnelState
+	endpoints []string
+	remotes   []string
+}
+
+func (f *fakeEndpoints) GetInterfaceState(name string) (*wireguard.InterfaceState, error) {
+	return f.wgState, nil
+}
+
+func (f *fakeEndpoints) SetEndpoint(name, publicKey, endpoint string) error {
+	f.endpoints = append(f.endpoints, endpoint)
+	return nil
+}
+
+func (f *fakeEndpoints) GetTunnel(name string) (*tunnel.TunnelState, error) {
+	return f.tunState, nil
+}
+
+func (f *fakeEndpoints) CreateTunnel(name, mode, local, remote string) error {
+	f.remotes = append(f.remotes, remote)
+	return nil
+}
+
+func newFakeResolver(fake *fakeEndpoints, address string) *EndpointResolver {
+	return &EndpointResolver{
+		wgExecutor: fake,
+		tnExecutor: fake,
+		resolveWireGuard: func(ctx context.Context, endpoint, family string) (string, error) {
+			return address + ":51820", nil
+		},
+		resolveGRE: func(ctx context.Context, endpoint, mode string) (string, error) {
+			return address, nil
+		},
+	}
+}
+
+func TestUpdateWireGuard(t *testing.T) {
+	desired := &wireguard.InterfaceConfig{
+		Peer: wireguard.PeerConfig{PublicKey: "peer-key", Endpoint: "peer.example.com:51820"},
+	}
+
+	tests := []struct {
+		name      string
+		resolved  string
+		handshake time.Time
+		want      []string
+	}{
+		{"address changed", "192.0.2.2", time.Time{}, []string{"192.0.2.2:51820"}},
+		{"address unchanged", "192.0.2.1", time.Time{}, nil},
+		{"stale handshake", "192.0.2.2", time.Now().Add(-10 * time.Minute), []string{"192.0.2.2:51820"}},
+		{"recent handshake", "192.0.2.2", time.Now().Add(-30 * time.Second), nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := &fakeEndpoints{wgState: &wireguard.InterfaceState{
+				Peers:      []wireguard.PeerConfig{{PublicKey: "peer-key", Endpoint: "192.0.2.1:51820"}},
+				Handshakes: map[string]time.Time{"peer-key": tt.handshake},
+			}}
+			r := newFakeResolver(fake, tt.resolved)
+			r.updateWireGuard(context.Background(), "dn42-test", desired, endpointKindSession, "AS4242421234")
+
+			if len(fake.endpoints) != len(tt.want) || (len(tt.want) > 0 && fake.endpoints[0] != tt.want[0]) {
+				t.Errorf("Expected endpoint updates %v, got %v", tt.want, fake.endpoints)
+			}
+		})
+	}
+}
+
+func TestUpdateGRE(t *testing.T) {
+	session := &BgpSession{Interface: "dn42-test", Type: SessionTypeGRE, Endpoint: "peer.example.com"}
+
+	tests := []struct {
+		name     string
+		resolved string
+		want     []string
+	}{
+		{"address changed", "192.0.2.2", []string{"192.0.2.2"}},
+		{"address unchanged", "192.0.2.1", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := &fakeEndpoints{tunState: &tunnel.TunnelState{Mode: "gre", Local: "198.51.100.1", Remote: "192.0.2.1"}}
+			r := newFakeResolver(fake, tt.resolved)
+			r.updateGRE(context.Background(), session, "AS4242421234")
+
+			if len(fake.remotes) != len(tt.want) || (len(tt.want) > 0 && fake.remotes[0] != tt.want[0]) {
+				t.Errorf("Expected tunnel changes %v, got %v", tt.want, fake.remotes)
+			}
+		})
+	}
+}
+
+func TestIsTunnelHostname(t *testing.T) {
+	tests := []struct {
+		endpoint string
+		want     bool
+	}{
+		{"peer.example.com", true},
+		{"peer.example.com:0", true},
+		{"1.2.3.4", false},
+		{"fd00::1", false},
+		{"[fd00::1]:0", false},
+		{"", false},
+	}
+
+	for _, tt := range tests {
+		if got := isTunnelHostname(tt.endpoint); got != tt.want {
+			t.Errorf("isTunnelHostname(%q): expected %v, got %v", tt.endpoint, tt.want, got)
+		}
+	}
+}
@@ -3,53 +3,67 @@ package task
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"log"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 	"sync"
-	"text/template"
 	"time"
 
 	"github.com/moenet/moenet-agent/internal/bird"
 	"github.com/moenet/moenet-agent/internal/config"
+	"github.com/moenet/moenet-agent/internal/plan"
 )
 
+// ibgpPlanTask labels the plan actions of IBGPSync
+const ibgpPlanTask = "IBGPSync"
+
 // IBGPSync handles iBGP peer configuration synchronization
 type IBGPSync struct {
-	config       *config.Config
-	birdPool     *bird.Pool
-	ibgpConfDir  string
-	ibgpTemplate *template.Template
-
-	mu    sync.RWMutex
-	peers map[int]*MeshPeer // key: node ID
+	config      *config.Config
+	birdPool    *bird.Pool
+	ibgpConfDir string
+	renderer    *bird.Renderer
+	localAS     *LocalAS
+
+	mu         sync.RWMutex
+	peers      map[int]*MeshPeer // key: node ID
+	stateStore *StateStore
+
+	// Fetches the current peers from CP for Plan, nil to plan the known peers
+	peerSource func(ctx context.Context) ([]BirdIBGPPeer, error)
 }
 
 // NewIBGPSync creates a new iBGP sync handler
-func NewIBGPSync(cfg *config.Config, birdPool *bird.Pool) (*IBGPSync, error) {
-	confDir := cfg.Bird.IBGPConfDir
-	if confDir == "" {
-		confDir = "/etc/bird/ibgp"
-	}
+func NewIBGPSync(cfg *config.Config, birdPool *bird.Pool, renderer *bird.Renderer) (*IBGPSync, error) {
+	sync := OpenIBGPSync(cfg, birdPool, renderer)
 
 	// Ensure directory exists
-	if err := os.MkdirAll(confDir, 0755); err != nil {
+	if err := os.MkdirAll(sync.ibgpConfDir, 0755); err != nil {
 		return nil, fmt.Errorf("failed to create iBGP conf dir: %w", err)
 	}
 
-	tmpl, err := template.New("ibgp").Parse(ibgpTemplate)
-	if err != nil {
-		return nil, fmt.Errorf("failed to parse iBGP template: %w", err)
+	return sync, nil
+}
+
+// OpenIBGPSync creates the iBGP sync without creating its config directory,
+// for planning only
+func OpenIBGPSync(cfg *config.Config, birdPool *bird.Pool, renderer *bird.Renderer) *IBGPSync {
+	confDir := cfg.Bird.IBGPConfDir
+	if confDir == "" {
+		confDir = "/etc/bird/ibgp"
 	}
 
 	sync := &IBGPSync{
-		config:       cfg,
-		birdPool:     birdPool,
-		ibgpConfDir:  confDir,
-		ibgpTemplate: tmpl,
-		peers:        make(map[int]*MeshPeer),
+		config:      cfg,
+		birdPool:    birdPool,
+		ibgpConfDir: confDir,
+		renderer:    renderer,
+		localAS:     NewLocalAS(cfg.Node),
+		peers:       make(map[int]*MeshPeer),
 	}
 
 	// Compile-time references to silence unused method warnings
@@ -57,7 +71,21 @@ func NewIBGPSync(cfg *config.Config, birdPool *bird.Pool) (*IBGPSync, error) {
 	_ = sync.removePeerConfig
 	_ = sync.cleanupStaleConfigs
 
-	return sync, nil
+	return sync
+}
+
+// SetStateStore sets the store the iBGP peers are persisted to. Peers of the
+// previous run are restored, so stale configs are cleaned up before CP answers.
+func (i *IBGPSync) SetStateStore(store *StateStore) {
+	i.stateStore = store
+
+	saved := store.Get().IBGPPeers
+	i.mu.Lock()
+	i.peers = peerMap(saved)
+	i.mu.Unlock()
+	if len(saved) > 0 {
+		log.Printf("[iBGP] Restored %d peers from state file", len(saved))
+	}
 }
 
 // Run starts the iBGP sync task
@@ -101,7 +129,8 @@ func (i *IBGPSync) Sync(ctx context.Context) error {
 		return nil
 	}
 
-	changed := false
+	// Previous contents of the changed files, restored if BIRD reverts
+	var backups []fileBackup
 
 	for _, peer := range peers {
 		// Skip self
@@ -110,27 +139,34 @@ func (i *IBGPSync) Sync(ctx context.Context) error {
 		}
 
 		// Generate iBGP config file
-		filename := filepath.Join(i.ibgpConfDir, fmt.Sprintf("ibgp_%d.conf", peer.NodeID))
-		peerChanged, err := i.generateConfig(peer, filename)
+		backup, peerChanged, err := i.generateConfig(peer, i.peerConfigPath(peer.NodeID))
 		if err != nil {
 			log.Printf("[iBGP] Failed to generate config for %s: %v", peer.NodeName, err)
 			continue
 		}
 		if peerChanged {
-			changed = true
+			backups = append(backups, backup)
 			log.Printf("[iBGP] Config changed for %s", peer.NodeName)
 		}
 	}
 
 	// Clean up stale configs (files not matching current peers)
-	if err := i.cleanupStaleConfigs(peerMap); err != nil {
+	removed, err := i.cleanupStaleConfigs(peerMap)
+	if err != nil {
 		log.Printf("[iBGP] Warning: cleanup failed: %v", err)
 	}
+	backups = append(backups, removed...)
 
 	// Reload BIRD if configs changed
-	if changed {
-		if err := i.birdPool.Configure(); err != nil {
+	if len(backups) > 0 {
+		if err := i.birdPool.Reconfigure(ctx); err != nil {
 			log.Printf("[iBGP] Warning: BIRD reconfigure failed: %v", err)
+			if errors.Is(err, bird.ErrConfigReverted) {
+				// Keep the files in line with the config BIRD runs again
+				if err := restoreBackups(backups); err != nil {
+					log.Printf("[iBGP] Warning: %v", err)
+				}
+			}
 		} else {
 			log.Printf("[iBGP] Configured %d iBGP peers", len(peers)-1)
 		}
@@ -150,19 +186,15 @@ func (i *IBGPSync) UpdatePeers(peers map[int]*MeshPeer) {
 func (i *IBGPSync) UpdatePeersFromAPI(apiPeers []BirdIBGPPeer) {
 	i.mu.Lock()
 
-	// Convert API peers to internal format
-	newPeers := make(map[int]*MeshPeer)
-	for _, p := range apiPeers {
-		newPeers[p.NodeID] = &MeshPeer{
-			NodeID:       p.NodeID,
-			NodeName:     p.NodeName,
-			LoopbackIPv4: p.LoopbackIPv4,
-			LoopbackIPv6: p.LoopbackIPv6,
-			IsRR:         p.IsRR,
+	peers := ibgpPeersFromAPI(apiPeers)
+	i.peers = peers
+	i.mu.Unlock()
+
+	if i.stateStore != nil {
+		if err := i.stateStore.SetIBGPPeers(peers); err != nil {
+			log.Printf("[iBGP] Warning: failed to persist state: %v", err)
 		}
 	}
-	i.peers = newPeers
-	i.mu.Unlock()
 
 	log.Printf("[iBGP] Received %d peers from API", len(apiPeers))
 
@@ -176,9 +208,59 @@ func (i *IBGPSync) UpdatePeersFromAPI(apiPeers []BirdIBGPPeer) {
 	}
 }
 
+// ibgpPeersFromAPI converts API peers to internal format
+func ibgpPeersFromAPI(apiPeers []BirdIBGPPeer) map[int]*MeshPeer {
+	peers := make(map[int]*MeshPeer)
+	for _, p := range apiPeers {
+		peers[p.NodeID] = &MeshPeer{
+			NodeID:       p.NodeID,
+			NodeName:     p.NodeName,
+			LoopbackIPv4: p.LoopbackIPv4,
+			LoopbackIPv6: p.LoopbackIPv6,
+			IsRR:         p.IsRR,
+		}
+	}
+	return peers
+}
+
 // generateConfig generates iBGP configuration for a peer
-// Returns (changed bool, err error) - changed is true only if file was actually modified
-func (i *IBGPSync) generateConfig(peer *MeshPeer, filename string) (bool, error) {
+// Returns the previous file content and whether the file was actually modified
+func (i *IBGPSync) generateConfig(peer *MeshPeer, filename string) (fileBackup, bool, error) {
+	newContent, err := i.renderConfig(peer)
+	if err != nil {
+		return fileBackup{}, false, err
+	}
+
+	// Compare with existing file content
+	backup, err := backupFile(filename)
+	if err != nil {
+		return fileBackup{}, false, err
+	}
+	if backup.existed && bytes.Equal(backup.content, newContent) {
+		// File exists and content is identical - no change needed
+		return backup, false, nil
+	}
+
+	// Write new content (file doesn't exist or content differs)
+	if err := os.WriteFile(filename, newContent, 0644); err != nil {
+		return fileBackup{}, false, err
+	}
+
+	return backup, true, nil
+}
+
+// SetLocalAS sets the local AS holder shared with BirdConfigSync
+func (i *IBGPSync) SetLocalAS(localAS *LocalAS) {
+	i.localAS = localAS
+}
+
+// renderConfig renders the iBGP configuration for a peer
+func (i *IBGPSync) renderConfig(peer *MeshPeer) ([]byte, error) {
+	localASN := i.localAS.ASN()
+	if localASN == 0 {
+		return nil, fmt.Errorf("local AS unknown: set node.asn or wait for the CP policy")
+	}
+
 	// Determine local node type from config
 	localIsRR := strings.Contains(strings.ToLower(i.config.Node.Name), "-rr")
 
@@ -194,76 +276,127 @@ func (i *IBGPSync) generateConfig(peer *MeshPeer, filename string) (bool, error)
 		"IsRR":           peer.IsRR,
 		"MarkAsRRClient": markAsRRClient, // true = add "rr client" directive
 		"LocalLoopback":  i.config.WireGuard.DN42IPv6,
+		"LocalASN":       localASN,
 	}
 
-	// Generate config to buffer first
-	var buf bytes.Buffer
-	if err := i.ibgpTemplate.Execute(&buf, data); err != nil {
-		return false, err
+	return i.renderer.Render(bird.TemplateIBGPPeer, data)
+}
+
+// peerConfigPath returns the iBGP config file path for a peer
+func (i *IBGPSync) peerConfigPath(nodeID int) string {
+	return filepath.Join(i.ibgpConfDir, fmt.Sprintf("ibgp_%d.conf", nodeID))
+}
+
+// SetPeerSource sets where Plan gets the current peer list from. The peers
+// arrive with the BIRD config of CP, so BirdConfigSync provides them.
+func (i *IBGPSync) SetPeerSource(source func(ctx context.Context) ([]BirdIBGPPeer, error)) {
+	i.peerSource = source
+}
+
+// Plan records the iBGP config changes the next sync would make
+func (i *IBGPSync) Plan(ctx context.Context, p *plan.Plan) error {
+	var peers map[int]*MeshPeer
+	if i.peerSource != nil {
+		apiPeers, err := i.peerSource(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to fetch iBGP peers: %w", err)
+		}
+		peers = ibgpPeersFromAPI(apiPeers)
+	} else {
+		i.mu.RLock()
+		peers = make(map[int]*MeshPeer, len(i.peers))
+		for id, peer := range i.peers {
+			peers[id] = peer
+		}
+		i.mu.RUnlock()
 	}
-	newContent := buf.Bytes()
+	i.planPeers(p, peers)
+	return nil
+}
 
-	// Compare with existing file content
-	existingContent, err := os.ReadFile(filename)
-	if err == nil && bytes.Equal(existingContent, newContent) {
-		// File exists and content is identical - no change needed
-		return false, nil
+// planPeers records the iBGP config changes a sync with peers would make
+func (i *IBGPSync) planPeers(p *plan.Plan, peers map[int]*MeshPeer) bool {
+	if len(peers) == 0 {
+		return false
 	}
 
-	// Write new content (file doesn't exist or content differs)
-	if err := os.WriteFile(filename, newContent, 0644); err != nil {
-		return false, err
+	ids := make([]int, 0, len(peers))
+	for id := range peers {
+		ids = append(ids, id)
 	}
+	sort.Ints(ids)
 
-	return true, nil
+	changed := false
+	for _, id := range ids {
+		peer := peers[id]
+		if peer.NodeID == i.config.Node.ID {
+			continue
+		}
+		content, err := i.renderConfig(peer)
+		if err != nil {
+			p.Errors = append(p.Errors, fmt.Sprintf("%s: %s: %v", ibgpPlanTask, peer.NodeName, err))
+			continue
+		}
+		if p.WriteFile(ibgpPlanTask, i.peerConfigPath(peer.NodeID), content) {
+			changed = true
+		}
+	}
+
+	stale, err := i.staleConfigs(peers)
+	if err != nil {
+		p.Errors = append(p.Errors, fmt.Sprintf("%s: %v", ibgpPlanTask, err))
+	}
+	for _, path := range stale {
+		if p.DeleteFile(ibgpPlanTask, path) {
+			changed = true
+		}
+	}
+
+	if changed {
+		p.Add(ibgpPlanTask, plan.KindReconfigure, "bird", "")
+	}
+	return changed
 }
 
 // removePeerConfig removes the iBGP config for a peer
 //
 //nolint:unused // Reserved for future use
 func (i *IBGPSync) removePeerConfig(nodeID int) error {
-	filename := filepath.Join(i.ibgpConfDir, fmt.Sprintf("ibgp_%d.conf", nodeID))
-	if err := os.Remove(filename); err != nil && !os.IsNotExist(err) {
+	if err := os.Remove(i.peerConfigPath(nodeID)); err != nil && !os.IsNotExist(err) {
 		return err
 	}
 	return nil
 }
 
-// ibgpTemplate is the BIRD 3 template for iBGP peers
-const ibgpTemplate = `# iBGP peer: {{.NodeName}} (Node {{.NodeID}})
-# Auto-generated by moenet-agent
-
-protocol bgp ibgp_{{.NodeID}} {
-    local as 4242420998;
-    neighbor {{.LoopbackIPv6}} as 4242420998;
-    source address {{.LocalLoopback}};
-    description "iBGP to {{.NodeName}}";
-    multihop 8;
-    {{- if .MarkAsRRClient}}
-    rr client;
-    {{- end}}
-    
-    ipv4 {
-        import where true;
-        export where true;
-        next hop self;
-    };
-    
-    ipv6 {
-        import where true;
-        export where true;
-        next hop self;
-    };
+// cleanupStaleConfigs removes configs for peers that no longer exist and
+// returns the backups of the removed files
+func (i *IBGPSync) cleanupStaleConfigs(currentPeers map[int]*MeshPeer) ([]fileBackup, error) {
+	stale, err := i.staleConfigs(currentPeers)
+	var removed []fileBackup
+	for _, path := range stale {
+		backup, backupErr := backupFile(path)
+		if backupErr != nil {
+			log.Printf("[iBGP] Warning: failed to back up stale config %s: %v", filepath.Base(path), backupErr)
+			continue
+		}
+		if err := os.Remove(path); err != nil {
+			log.Printf("[iBGP] Warning: failed to remove stale config %s: %v", filepath.Base(path), err)
+			continue
+		}
+		removed = append(removed, backup)
+		log.Printf("[iBGP] Removed stale config %s", filepath.Base(path))
+	}
+	return removed, err
 }
-`
 
-// cleanupStaleConfigs removes configs for peers that no longer exist
-func (i *IBGPSync) cleanupStaleConfigs(currentPeers map[int]*MeshPeer) error {
+// staleConfigs lists the config files of peers that no longer exist
+func (i *IBGPSync) staleConfigs(currentPeers map[int]*MeshPeer) ([]string, error) {
 	files, err := os.ReadDir(i.ibgpConfDir)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
+	var stale []string
 	for _, file := range files {
 		if !strings.HasPrefix(file.Name(), "ibgp_") || !strings.HasSuffix(file.Name(), ".conf") {
 			continue
@@ -276,11 +409,8 @@ func (i *IBGPSync) cleanupStaleConfigs(currentPeers map[int]*MeshPeer) error {
 		}
 
 		if _, exists := currentPeers[nodeID]; !exists {
-			path := filepath.Join(i.ibgpConfDir, file.Name())
-			os.Remove(path)
-			log.Printf("[iBGP] Removed stale config for node %d", nodeID)
+			stale = append(stale, filepath.Join(i.ibgpConfDir, file.Name()))
 		}
 	}
-
-	return nil
+	return stale, nil
 }
@@ -0,0 +1,146 @@
+package task
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/moenet/moenet-agent/internal/config"
+)
+
+func TestIBGPRenderConfig(t *testing.T) {
+	cfg := &config.Config{
+		Node:      config.NodeConfig{Name: "de-rr", ASN: 4242420998},
+		WireGuard: config.WireGuardConfig{DN42IPv6: "fd00:4242:7777::1"},
+	}
+	cfg.Bird.IBGPConfDir = t.TempDir()
+	i, err := NewIBGPSync(cfg, nil, testRenderer(t))
+	if err != nil {
+		t.Fatalf("NewIBGPSync failed: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		peer     MeshPeer
+		expected []string
+		absent   []string
+	}{
+		{
+			name: "client",
+			peer: MeshPeer{NodeID: 7, NodeName: "jp-edge", LoopbackIPv6: "fd00:4242:7777::7"},
+			expected: []string{
+				"# iBGP peer: jp-edge (Node 7)",
+				"protocol bgp ibgp_7 {",
+				"local as 4242420998;",
+				"neighbor fd00:4242:7777::7 as 4242420998;",
+				"source address fd00:4242:7777::1;",
+				`description "iBGP to jp-edge";`,
+				"rr client;",
+			},
+		},
+		{
+			name:   "route reflector",
+			peer:   MeshPeer{NodeID: 2, NodeName: "us-rr", LoopbackIPv6: "fd00:4242:7777::2", IsRR: true},
+			absent: []string{"rr client;"},
+		},
+		{
+			name:     "quoted name",
+			peer:     MeshPeer{NodeID: 3, NodeName: "odd \"name\"\nx", LoopbackIPv6: "fd00:4242:7777::3"},
+			expected: []string{"# iBGP peer: odd \"name\" x (Node 3)", `description "iBGP to odd \"name\" x";`},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			content, err := i.renderConfig(&tt.peer)
+			if err != nil {
+				t.Fatalf("renderConfig failed: %v", err)
+			}
+			for _, want := range tt.expected {
+				if !strings.Contains(string(content), want) {
+					t.Errorf("Expected config to contain %q, got:\n%s", want, content)
+				}
+			}
+			for _, unwanted := range tt.absent {
+				if strings.Contains(string(content), unwanted) {
+					t.Errorf("Expected config not to contain %q", unwanted)
+				}
+			}
+		})
+	}
+}
+
+func TestIBGPConfigBackups(t *testing.T) {
+	cfg := &config.Config{Node: config.NodeConfig{Name: "de-edge", ID: 1, ASN: 4242420998}}
+	cfg.Bird.IBGPConfDir = t.TempDir()
+	i, err := NewIBGPSync(cfg, nil, testRenderer(t))
+	if err != nil {
+		t.Fatalf("NewIBGPSync failed: %v", err)
+	}
+	os.WriteFile(i.peerConfigPath(7), []byte("old ibgp_7"), 0644)
+	os.WriteFile(i.peerConfigPath(9), []byte("stale ibgp_9"), 0644)
+
+	peers := map[int]*MeshPeer{
+		7: {NodeID: 7, NodeName: "jp-edge", LoopbackIPv6: "fd00:4242:7777::7"},
+		8: {NodeID: 8, NodeName: "us-edge", LoopbackIPv6: "fd00:4242:7777::8"},
+	}
+	var backups []fileBackup
+	for _, id := range []int{7, 8} {
+		backup, changed, err := i.generateConfig(peers[id], i.peerConfigPath(id))
+		if err != nil {
+			t.Fatalf("generateConfig failed: %v", err)
+		}
+		if !changed {
+			t.Errorf("Expected config of node %d to change", id)
+		}
+		backups = append(backups, backup)
+	}
+	removed, err := i.cleanupStaleConfigs(peers)
+	if err != nil {
+		t.Fatalf("cleanupStaleConfigs failed: %v", err)
+	}
+	if len(removed) != 1 {
+		t.Fatalf("Expected 1 stale config removed, got %d", len(removed))
+	}
+	backups = append(backups, removed...)
+
+	// A reverted reconfigure puts the previous files back
+	if err := restoreBackups(backups); err != nil {
+		t.Fatalf("restoreBackups failed: %v", err)
+	}
+	if got, _ := os.ReadFile(i.peerConfigPath(7)); string(got) != "old ibgp_7" {
+		t.Errorf("Expected restored ibgp_7, got %q", got)
+	}
+	if _, err := os.Stat(i.peerConfigPath(8)); !os.IsNotExist(err) {
+		t.Errorf("Expected new ibgp_8 to be removed, got %v", err)
+	}
+	if got, _ := os.ReadFile(i.peerConfigPath(9)); string(got) != "stale ibgp_9" {
+		t.Errorf("Expected restored ibgp_9, got %q", got)
+	}
+}
+
+func TestIBGPRenderConfigLocalASFromPolicy(t *testing.T) {
+	// Bootstrap node: the local AS comes from the CP policy
+	cfg := &config.Config{Node: config.NodeConfig{Name: "de-edge"}}
+	cfg.Bird.IBGPConfDir = t.TempDir()
+	i, err := NewIBGPSync(cfg, nil, testRenderer(t))
+	if err != nil {
+		t.Fatalf("NewIBGPSync failed: %v", err)
+	}
+	peer := &MeshPeer{NodeID: 7, NodeName: "jp-edge", LoopbackIPv6: "fd00:4242:7777::7"}
+
+	if _, err := i.renderConfig(peer); err == nil {
+		t.Error("Expected error while the local AS is unknown")
+	}
+
+	localAS := NewLocalAS(cfg.Node)
+	localAS.setFromPolicy(&BirdPolicy{DN42As: "4242420998"})
+	i.SetLocalAS(localAS)
+	content, err := i.renderConfig(peer)
+	if err != nil {
+		t.Fatalf("renderConfig failed: %v", err)
+	}
+	if !strings.Contains(string(content), "local as 4242420998;") {
+		t.Errorf("Expected local AS from policy, got:\n%s", content)
+	}
+}
@@ -0,0 +1,51 @@
+package task
+
+import (
+	"strconv"
+	"sync"
+
+	"github.com/moenet/moenet-agent/internal/config"
+)
+
+// LocalAS holds the local AS and its aggregate prefixes in effect. They come
+// from the node config, or from the CP policy when the node config leaves
+// them unset, as in bootstrap mode. BirdConfigSync updates it from every
+// valid policy; IBGPSync and MeshSync read it.
+type LocalAS struct {
+	mu         sync.RWMutex
+	asn        uint32
+	ipv4Prefix string
+	ipv6Prefix string
+}
+
+// NewLocalAS creates the local AS holder with the values of the node config
+func NewLocalAS(node config.NodeConfig) *LocalAS {
+	return &LocalAS{asn: node.ASN, ipv4Prefix: node.IPv4Prefix, ipv6Prefix: node.IPv6Prefix}
+}
+
+// ASN returns the local AS number, 0 while unknown
+func (l *LocalAS) ASN() uint32 {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.asn
+}
+
+// Prefixes returns the IPv4 and IPv6 aggregate prefixes, empty while unknown
+func (l *LocalAS) Prefixes() (ipv4, ipv6 string) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.ipv4Prefix, l.ipv6Prefix
+}
+
+// setFromPolicy takes the values of a policy that passed validatePolicy
+func (l *LocalAS) setFromPolicy(policy *BirdPolicy) {
+	asn, err := strconv.ParseUint(policy.DN42As, 10, 32)
+	if err != nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.asn = uint32(asn)
+	l.ipv4Prefix = policy.DN42Ipv4Prefix
+	l.ipv6Prefix = policy.DN42Ipv6Prefix
+}
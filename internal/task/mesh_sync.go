@@ -12,18 +12,24 @@ import (
 	"time"
 
 	"github.com/moenet/moenet-agent/internal/config"
+	"github.com/moenet/moenet-agent/internal/plan"
 	"github.com/moenet/moenet-agent/internal/wireguard"
 )
 
+// meshInterfacePrefix is the name prefix of mesh tunnel interfaces
+const meshInterfacePrefix = "dn42-wg-igp-"
+
 // MeshSync handles WireGuard mesh tunnel synchronization
 type MeshSync struct {
 	config     *config.Config
 	httpClient *http.Client
 	wgExecutor *wireguard.Executor
+	localAS    *LocalAS
 
 	mu             sync.RWMutex
 	peers          map[int]*MeshPeer // key: node ID
 	onPeersUpdated func(map[int]*MeshPeer)
+	stateStore     *StateStore
 }
 
 // NewMeshSync creates a new mesh sync handler
@@ -35,14 +41,34 @@ func NewMeshSync(cfg *config.Config, wgExecutor *wireguard.Executor) *MeshSync {
 		},
 		wgExecutor: wgExecutor,
 		peers:      make(map[int]*MeshPeer),
+		localAS:    NewLocalAS(cfg.Node),
 	}
 }
 
+// SetLocalAS sets the local AS holder shared with BirdConfigSync
+func (m *MeshSync) SetLocalAS(localAS *LocalAS) {
+	m.localAS = localAS
+}
+
 // SetOnPeersUpdated sets a callback that's invoked when mesh peers are updated
 func (m *MeshSync) SetOnPeersUpdated(callback func(map[int]*MeshPeer)) {
 	m.onPeersUpdated = callback
 }
 
+// SetStateStore sets the store the mesh peers are persisted to. Peers of the
+// previous run are restored, so their tunnels are removed if CP dropped them.
+func (m *MeshSync) SetStateStore(store *StateStore) {
+	m.stateStore = store
+
+	saved := store.Get().MeshPeers
+	m.mu.Lock()
+	m.peers = peerMap(saved)
+	m.mu.Unlock()
+	if len(saved) > 0 {
+		log.Printf("[MeshSync] Restored %d peers from state file", len(saved))
+	}
+}
+
 // Run starts the mesh sync task
 func (m *MeshSync) Run(ctx context.Context, wg *sync.WaitGroup) {
 	defer wg.Done()
@@ -114,6 +140,12 @@ func (m *MeshSync) Sync(ctx context.Context) error {
 	m.peers = newPeers
 	m.mu.Unlock()
 
+	if m.stateStore != nil {
+		if err := m.stateStore.SetMeshPeers(newPeers); err != nil {
+			log.Printf("[MeshSync] Warning: failed to persist state: %v", err)
+		}
+	}
+
 	// Notify RTT of updated peers
 	if m.onPeersUpdated != nil {
 		m.onPeersUpdated(newPeers)
@@ -131,6 +163,42 @@ func (m *MeshSync) Sync(ctx context.Context) error {
 	return nil
 }
 
+// Plan records the mesh tunnel changes the next Sync would make
+func (m *MeshSync) Plan(ctx context.Context, p *plan.Plan) error {
+	meshConfig, err := m.fetchMeshConfig(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to fetch mesh config: %w", err)
+	}
+
+	newPeers := make(map[int]bool)
+	for i := range meshConfig.Peers {
+		peer := &meshConfig.Peers[i]
+		newPeers[peer.NodeID] = true
+		if peer.NodeID == m.config.Node.ID {
+			continue
+		}
+
+		ifname := meshInterfaceName(peer)
+		live, err := m.wgExecutor.GetInterfaceState(ifname)
+		if err != nil {
+			p.Add("MeshSync", plan.KindCreateInterface, ifname, "mesh to "+peer.NodeName)
+			continue
+		}
+		if drifts := m.wgExecutor.Drift(ctx, m.desiredMeshTunnel(peer), live); len(drifts) > 0 {
+			p.Add("MeshSync", plan.KindUpdateInterface, ifname, driftFields(drifts))
+		}
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	for nodeID, oldPeer := range m.peers {
+		if !newPeers[nodeID] {
+			p.Add("MeshSync", plan.KindDeleteInterface, meshInterfaceName(oldPeer), "stale mesh to "+oldPeer.NodeName)
+		}
+	}
+	return nil
+}
+
 // fetchMeshConfig retrieves mesh configuration from Control Plane
 func (m *MeshSync) fetchMeshConfig(ctx context.Context) (*MeshConfig, error) {
 	url := fmt.Sprintf("%s/api/v1/agent/%s/mesh", m.config.ControlPlane.URL, m.config.Node.Name)
@@ -168,46 +236,30 @@ func (m *MeshSync) fetchMeshConfig(ctx context.Context) (*MeshConfig, error) {
 
 // ensureMeshTunnel creates or updates a mesh tunnel to a peer
 func (m *MeshSync) ensureMeshTunnel(peer *MeshPeer) error {
-	ifname := fmt.Sprintf("dn42-wg-igp-%d", peer.NodeID)
-
-	// Build allowed IPs - allow all traffic through mesh for IGP routing
-	// IMPORTANT: Must include ff00::/8 for Babel multicast neighbor discovery
-	allowedIPs := []string{
-		"fe80::/10",           // Link-local (full range, not just /64)
-		"ff00::/8",            // Multicast (required for Babel IGP)
-		"fd00:4242:7777::/48", // MoeNet loopback subnet (covers all regions: :101:, :203:, :302:, etc.)
-		"172.22.188.0/26",     // MoeNet IPv4 loopback subnet
-	}
+	ifname := meshInterfaceName(peer)
+	desired := m.desiredMeshTunnel(peer)
 
 	// Create interface
-	// Use port based on PEER node ID (51820 + peerNodeID) so each interface has unique port
-	listenPort := 51820 + peer.NodeID
 	if err := m.wgExecutor.CreateInterface(
 		ifname,
-		listenPort,
-		peer.PublicKey,
-		"", // No PSK for mesh tunnels
-		peer.Endpoint,
-		allowedIPs,
-		25, // Keepalive
+		desired.ListenPort,
+		desired.Peer.PublicKey,
+		desired.Peer.PresharedKey,
+		desired.Peer.Endpoint,
+		desired.Peer.AllowedIPs,
+		desired.Peer.Keepalive,
 	); err != nil {
 		return fmt.Errorf("failed to create interface: %w", err)
 	}
 
 	// Set MTU
-	mtu := peer.MTU
-	if mtu == 0 {
-		mtu = 1420
-	}
-	if err := m.wgExecutor.SetMTU(ifname, mtu); err != nil {
+	if err := m.wgExecutor.SetMTU(ifname, desired.MTU); err != nil {
 		log.Printf("[MeshSync] Warning: failed to set MTU for %s: %v", ifname, err)
 	}
 
 	// Assign IPv6 link-local address for Babel IGP
-	// Format: fe80:{region}:{local_index}::1 derived from loopback fd00:4242:7777:{region}:{local_index}::1
-	linkLocalAddr := deriveLLAFromLoopback(m.config.WireGuard.DN42IPv6)
-	if linkLocalAddr != "" {
-		if err := m.wgExecutor.AddAddress(ifname, linkLocalAddr); err != nil {
+	for _, addr := range desired.Addresses {
+		if err := m.wgExecutor.AddAddress(ifname, addr); err != nil {
 			log.Printf("[MeshSync] Warning: failed to add link-local address to %s: %v", ifname, err)
 		}
 	}
@@ -216,9 +268,63 @@ func (m *MeshSync) ensureMeshTunnel(peer *MeshPeer) error {
 	return nil
 }
 
+// desiredMeshTunnel returns the desired WireGuard state of a mesh tunnel
+func (m *MeshSync) desiredMeshTunnel(peer *MeshPeer) *wireguard.InterfaceConfig {
+	// Build allowed IPs - allow all traffic through mesh for IGP routing
+	// IMPORTANT: Must include ff00::/8 for Babel multicast neighbor discovery
+	allowedIPs := []string{
+		"fe80::/10", // Link-local (full range, not just /64)
+		"ff00::/8",  // Multicast (required for Babel IGP)
+	}
+	// Our aggregates, holding the loopbacks of all regions. Until the CP
+	// policy supplies them on bootstrap nodes, the tunnels carry the IGP only.
+	ipv4Prefix, ipv6Prefix := m.localAS.Prefixes()
+	for _, prefix := range []string{ipv6Prefix, ipv4Prefix} {
+		if prefix != "" {
+			allowedIPs = append(allowedIPs, prefix)
+		}
+	}
+
+	mtu := peer.MTU
+	if mtu == 0 {
+		mtu = 1420
+	}
+
+	desired := &wireguard.InterfaceConfig{
+		// Use port based on PEER node ID (51820 + peerNodeID) so each interface has unique port
+		ListenPort: 51820 + peer.NodeID,
+		MTU:        mtu,
+		Peer: wireguard.PeerConfig{
+			PublicKey:  peer.PublicKey,
+			Endpoint:   peer.Endpoint, // No PSK for mesh tunnels
+			AllowedIPs: allowedIPs,
+			Keepalive:  25,
+		},
+		EndpointFamily: peer.EndpointFamily,
+	}
+
+	// Format: fe80:{region}:{local_index}::1 derived from loopback fd00:4242:7777:{region}:{local_index}::1
+	if lla := deriveLLAFromLoopback(m.config.WireGuard.DN42IPv6); lla != "" {
+		desired.Addresses = []string{lla}
+	}
+	return desired
+}
+
+// GetPeers returns copies of the current mesh peers
+func (m *MeshSync) GetPeers() []MeshPeer {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return peerList(m.peers)
+}
+
+// meshInterfaceName returns the interface name of the mesh tunnel to a peer
+func meshInterfaceName(peer *MeshPeer) string {
+	return fmt.Sprintf("%s%d", meshInterfacePrefix, peer.NodeID)
+}
+
 // removeMeshTunnel removes a mesh tunnel
 func (m *MeshSync) removeMeshTunnel(peer *MeshPeer) {
-	ifname := fmt.Sprintf("dn42-wg-igp-%d", peer.NodeID)
+	ifname := meshInterfaceName(peer)
 	if err := m.wgExecutor.DeleteInterface(ifname); err != nil {
 		log.Printf("[MeshSync] Warning: failed to delete interface %s: %v", ifname, err)
 	}
@@ -21,20 +21,22 @@ type MetricCollector struct {
 	config     *config.Config
 	httpClient *http.Client
 	birdPool   *bird.Pool
+	birdConfig *bird.ConfigGenerator
 
 	mu      sync.RWMutex
 	metrics map[string]*SessionMetric // key: peer UUID
 }
 
 // NewMetricCollector creates a new metric collector
-func NewMetricCollector(cfg *config.Config, birdPool *bird.Pool) *MetricCollector {
+func NewMetricCollector(cfg *config.Config, birdPool *bird.Pool, birdConfig *bird.ConfigGenerator) *MetricCollector {
 	return &MetricCollector{
 		config: cfg,
 		httpClient: &http.Client{
 			Timeout: time.Duration(cfg.ControlPlane.RequestTimeout) * time.Second,
 		},
-		birdPool: birdPool,
-		metrics:  make(map[string]*SessionMetric),
+		birdPool:   birdPool,
+		birdConfig: birdConfig,
+		metrics:    make(map[string]*SessionMetric),
 	}
 }
 
@@ -73,88 +75,108 @@ func (m *MetricCollector) collectAndReport(ctx context.Context) error {
 
 // collectBGPStats collects BGP protocol statistics from BIRD
 func (m *MetricCollector) collectBGPStats() []map[string]interface{} {
-	output, err := m.birdPool.ShowProtocols()
+	protocols, err := m.birdPool.ShowProtocols()
 	if err != nil {
 		log.Printf("[Metric] Failed to get BIRD protocols: %v", err)
 		return nil
 	}
 
 	var sessions []map[string]interface{}
-	lines := strings.Split(output, "\n")
-
-	for _, line := range lines {
-		// Skip header and empty lines
-		if len(line) == 0 || strings.HasPrefix(line, "Name") {
+	for _, p := range protocols {
+		// Only report DN42 eBGP sessions
+		if p.Proto != "BGP" || !strings.HasPrefix(p.Name, "dn42_") {
 			continue
 		}
+		session := map[string]interface{}{
+			"name":  p.Name,
+			"type":  "bgp",
+			"state": p.State,
+			"info":  p.Info,
+		}
+
+		// Get route counts for this session
+		routeCounts := m.getSessionRouteCounts(p.Name)
+		if routeCounts != nil {
+			session["routes_imported"] = routeCounts["imported"]
+			session["routes_exported"] = routeCounts["exported"]
+		}
+
+		sessions = append(sessions, session)
+	}
 
-		fields := strings.Fields(line)
-		if len(fields) < 5 {
+	return mergeIPv4Protocols(sessions, m.peerProtocols())
+}
+
+// peerProtocols maps the further protocols of each peer file, such as the
+// separate IPv4 protocol of a peer without MP-BGP, to the file's main protocol
+func (m *MetricCollector) peerProtocols() map[string]string {
+	mains := make(map[string]string)
+	if m.birdConfig == nil {
+		return mains
+	}
+	names, err := m.birdConfig.ListSessions()
+	if err != nil {
+		log.Printf("[Metric] Failed to scan BIRD peer configs: %v", err)
+		return mains
+	}
+	for _, name := range names {
+		file, err := m.birdConfig.ReadSession(name)
+		if err != nil || len(file.Protocols) < 2 {
 			continue
 		}
+		for _, protocol := range file.Protocols[1:] {
+			mains[protocol] = file.Protocol
+		}
+	}
+	return mains
+}
+
+// mergeIPv4Protocols folds the separate IPv4 protocol of a peer without
+// MP-BGP into the entry of its main protocol, so CP sees one session.
+// Protocols are paired by the peer files that declare them (mains), not by
+// name: a session with the suffix "v4" is a session of its own.
+// Route counts are summed and the session is only up if both protocols are.
+func mergeIPv4Protocols(sessions []map[string]interface{}, mains map[string]string) []map[string]interface{} {
+	byName := make(map[string]map[string]interface{}, len(sessions))
+	for _, session := range sessions {
+		byName[session["name"].(string)] = session
+	}
 
-		name := fields[0]
-		proto := fields[1]
-		state := fields[3]
-		info := ""
-		if len(fields) > 5 {
-			info = strings.Join(fields[5:], " ")
+	merged := make([]map[string]interface{}, 0, len(sessions))
+	for _, session := range sessions {
+		main, ok := byName[mains[session["name"].(string)]]
+		if !ok {
+			merged = append(merged, session)
+			continue
 		}
 
-		// Only report DN42 eBGP sessions
-		if proto == "BGP" && strings.HasPrefix(name, "dn42_") {
-			session := map[string]interface{}{
-				"name":  name,
-				"type":  "bgp",
-				"state": state,
-				"info":  info,
+		for _, key := range []string{"routes_imported", "routes_exported"} {
+			if count, ok := session[key].(int); ok {
+				total, _ := main[key].(int)
+				main[key] = total + count
 			}
-
-			// Get route counts for this session
-			routeCounts := m.getSessionRouteCounts(name)
-			if routeCounts != nil {
-				session["routes_imported"] = routeCounts["imported"]
-				session["routes_exported"] = routeCounts["exported"]
+		}
+		if session["state"] != "up" {
+			if main["state"] == "up" {
+				main["state"] = session["state"]
 			}
-
-			sessions = append(sessions, session)
+			main["info"] = fmt.Sprintf("%v; IPv4: %v", main["info"], session["info"])
 		}
 	}
-
-	return sessions
+	return merged
 }
 
 // getSessionRouteCounts fetches route import/export counts for a specific protocol
 func (m *MetricCollector) getSessionRouteCounts(protocolName string) map[string]int {
-	output, err := m.birdPool.Execute(fmt.Sprintf("show protocols all %s", protocolName))
+	detail, err := m.birdPool.ShowProtocolDetail(protocolName)
 	if err != nil {
 		return nil
 	}
 
-	imported := 0
-	exported := 0
-
-	lines := strings.Split(output, "\n")
-	for _, line := range lines {
-		line = strings.TrimSpace(line)
-		// Look for "Routes:         X imported, Y exported"
-		if strings.HasPrefix(line, "Routes:") {
-			parts := strings.Split(line, ",")
-			for _, part := range parts {
-				part = strings.TrimSpace(part)
-				if strings.Contains(part, "imported") {
-					fmt.Sscanf(part, "Routes: %d imported", &imported)
-				} else if strings.Contains(part, "exported") {
-					fmt.Sscanf(part, "%d exported", &exported)
-				}
-			}
-			break
-		}
-	}
-
+	routes := detail.Routes()
 	return map[string]int{
-		"imported": imported,
-		"exported": exported,
+		"imported": routes.Imported,
+		"exported": routes.Exported,
 	}
 }
 
@@ -0,0 +1,39 @@
+package task
+
+import "testing"
+
+func TestMergeIPv4Protocols(t *testing.T) {
+	sessions := []map[string]interface{}{
+		{"name": "dn42_4242421080_1a2b3c4d", "state": "up", "info": "Established", "routes_imported": 100, "routes_exported": 10},
+		{"name": "dn42_4242421080_1a2b3c4d_v4", "state": "start", "info": "Active", "routes_imported": 50, "routes_exported": 5},
+		{"name": "dn42_4242421081_5e6f7a8b", "state": "up", "info": "Established"},
+		{"name": "dn42_4242421082_v4", "state": "up", "info": "Established"},
+		{"name": "dn42_4242421083", "state": "up", "info": "Established"},
+		{"name": "dn42_4242421083_v4", "state": "up", "info": "Established", "routes_imported": 20},
+	}
+	mains := map[string]string{"dn42_4242421080_1a2b3c4d_v4": "dn42_4242421080_1a2b3c4d"}
+
+	merged := mergeIPv4Protocols(sessions, mains)
+	if len(merged) != 5 {
+		t.Fatalf("Expected 5 sessions, got %d: %v", len(merged), merged)
+	}
+
+	main := merged[0]
+	if main["routes_imported"] != 150 || main["routes_exported"] != 15 {
+		t.Errorf("Expected summed routes 150/15, got %v/%v", main["routes_imported"], main["routes_exported"])
+	}
+	if main["state"] != "start" {
+		t.Errorf("Expected state start, got %v", main["state"])
+	}
+	if main["info"] != "Established; IPv4: Active" {
+		t.Errorf("Expected combined info, got %v", main["info"])
+	}
+	// A _v4 suffix without a matching main protocol is reported as is
+	if merged[2]["name"] != "dn42_4242421082_v4" {
+		t.Errorf("Expected unmatched protocol to be kept, got %v", merged[2]["name"])
+	}
+	// A session with the suffix "v4" is not folded into a legacy dn42_<asn>
+	if merged[3]["routes_imported"] != nil || merged[4]["name"] != "dn42_4242421083_v4" {
+		t.Errorf("Expected session with suffix v4 to stay separate, got %v", merged[3:])
+	}
+}
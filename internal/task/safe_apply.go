@@ -0,0 +1,213 @@
+package task
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/moenet/moenet-agent/internal/bird"
+	"github.com/moenet/moenet-agent/internal/config"
+	"github.com/moenet/moenet-agent/internal/metrics"
+)
+
+// cpProbeTimeout bounds a single CP reachability probe
+const cpProbeTimeout = 5 * time.Second
+
+// ApplyHealthCheck decides whether a BIRD reconfigure in safe-apply mode is
+// confirmed. The config is kept if CP is reachable and the iBGP sessions
+// and mesh Babel neighbours that were up before the reconfigure are up again.
+type ApplyHealthCheck struct {
+	config     *config.Config
+	birdPool   *bird.Pool
+	httpClient *http.Client
+
+	mu             sync.Mutex
+	ibgpProtocols  []string // iBGP protocols established before the reconfigure
+	meshInterfaces []string // Mesh interfaces with Babel neighbours before the reconfigure
+}
+
+// NewApplyHealthCheck creates the post-apply health check
+func NewApplyHealthCheck(cfg *config.Config, birdPool *bird.Pool) *ApplyHealthCheck {
+	return &ApplyHealthCheck{
+		config:     cfg,
+		birdPool:   birdPool,
+		httpClient: &http.Client{Timeout: cpProbeTimeout},
+	}
+}
+
+// Baseline records the iBGP sessions and Babel neighbours that are up, so
+// Verify only expects what worked before the reconfigure
+func (c *ApplyHealthCheck) Baseline(ctx context.Context) error {
+	protocols, protoErr := c.establishedIBGP()
+	interfaces, babelErr := c.babelInterfaces()
+
+	c.mu.Lock()
+	c.ibgpProtocols = protocols
+	c.meshInterfaces = interfaces
+	c.mu.Unlock()
+
+	if protoErr != nil {
+		return fmt.Errorf("failed to list iBGP sessions: %w", protoErr)
+	}
+	if babelErr != nil {
+		return fmt.Errorf("failed to list Babel neighbours: %w", babelErr)
+	}
+	return nil
+}
+
+// Verify checks CP reachability, the baseline iBGP sessions and the
+// baseline Babel neighbours that still exist
+func (c *ApplyHealthCheck) Verify(ctx context.Context) error {
+	if err := c.probeCP(ctx); err != nil {
+		return fmt.Errorf("CP unreachable: %w", err)
+	}
+
+	c.mu.Lock()
+	wantProtocols, wantInterfaces := c.ibgpProtocols, c.meshInterfaces
+	c.mu.Unlock()
+
+	if len(wantProtocols) > 0 {
+		protocols, err := c.showIBGP()
+		if err != nil {
+			return fmt.Errorf("failed to list iBGP sessions: %w", err)
+		}
+		if down := downIBGP(wantProtocols, protocols); len(down) > 0 {
+			return fmt.Errorf("iBGP sessions not established: %s", strings.Join(down, ", "))
+		}
+	}
+
+	if len(wantInterfaces) > 0 {
+		interfaces, err := c.babelInterfaces()
+		if err != nil {
+			return fmt.Errorf("failed to list Babel neighbours: %w", err)
+		}
+		// Mesh links removed since the baseline have no neighbour to wait for
+		missing := missingNames(wantInterfaces, interfaces)
+		missing = slices.DeleteFunc(missing, func(name string) bool {
+			_, err := net.InterfaceByName(name)
+			return err != nil
+		})
+		if len(missing) > 0 {
+			return fmt.Errorf("no Babel neighbour on %s", strings.Join(missing, ", "))
+		}
+	}
+	return nil
+}
+
+// Record logs the outcome of a safe-apply reconfigure and counts it
+func (c *ApplyHealthCheck) Record(result bird.SafeApplyResult) {
+	if result.Error != "" {
+		log.Printf("[BIRD] Safe-apply %s: %s", result.Outcome, result.Error)
+	} else {
+		log.Printf("[BIRD] Safe-apply %s", result.Outcome)
+	}
+	metrics.Get().RecordSafeApply(result.Outcome, result.Time)
+}
+
+// probeCP checks that CP answers HTTP requests. Any response will do: the
+// check is about the route to CP, not the state of the API.
+func (c *ApplyHealthCheck) probeCP(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, c.config.ControlPlane.URL, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// establishedIBGP returns the names of the established iBGP protocols
+func (c *ApplyHealthCheck) establishedIBGP() ([]string, error) {
+	protocols, err := c.showIBGP()
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, p := range protocols {
+		if isEstablished(p) {
+			names = append(names, p.Name)
+		}
+	}
+	return names, nil
+}
+
+// showIBGP returns the iBGP protocols
+func (c *ApplyHealthCheck) showIBGP() ([]bird.Protocol, error) {
+	protocols, err := c.birdPool.ShowProtocols()
+	if err != nil {
+		return nil, err
+	}
+	var ibgp []bird.Protocol
+	for _, p := range protocols {
+		if p.Proto == "BGP" && strings.HasPrefix(p.Name, "ibgp_") {
+			ibgp = append(ibgp, p)
+		}
+	}
+	return ibgp, nil
+}
+
+// downIBGP returns the protocols of want that are not established. A
+// protocol the new config removed is not expected back: requiring it would
+// revert every config that drops a stale peer.
+func downIBGP(want []string, protocols []bird.Protocol) []string {
+	byName := make(map[string]bird.Protocol, len(protocols))
+	for _, p := range protocols {
+		byName[p.Name] = p
+	}
+	var down []string
+	for _, name := range want {
+		if p, ok := byName[name]; ok && !isEstablished(p) {
+			down = append(down, name)
+		}
+	}
+	return down
+}
+
+// isEstablished reports whether a BGP protocol has an established session
+func isEstablished(p bird.Protocol) bool {
+	return strings.HasPrefix(p.Info, "Established")
+}
+
+// babelInterfaces returns the mesh interfaces with at least one Babel
+// neighbour
+func (c *ApplyHealthCheck) babelInterfaces() ([]string, error) {
+	neighbors, err := c.birdPool.ShowBabelNeighbors()
+	if err != nil {
+		return nil, err
+	}
+	seen := make(map[string]bool)
+	var names []string
+	for _, n := range neighbors {
+		if strings.HasPrefix(n.Interface, meshInterfacePrefix) && !seen[n.Interface] {
+			seen[n.Interface] = true
+			names = append(names, n.Interface)
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// missingNames returns the names of want not in have
+func missingNames(want, have []string) []string {
+	present := make(map[string]bool, len(have))
+	for _, name := range have {
+		present[name] = true
+	}
+	var missing []string
+	for _, name := range want {
+		if !present[name] {
+			missing = append(missing, name)
+		}
+	}
+	return missing
+}
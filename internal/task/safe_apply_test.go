@@ -0,0 +1,78 @@
+package task
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/moenet/moenet-agent/internal/bird"
+	"github.com/moenet/moenet-agent/internal/config"
+)
+
+func TestApplyHealthCheckVerifyCP(t *testing.T) {
+	// CP answering with an error status is still reachable
+	cp := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	cfg := &config.Config{}
+	cfg.ControlPlane.URL = cp.URL
+	check := NewApplyHealthCheck(cfg, nil)
+
+	if err := check.Verify(context.Background()); err != nil {
+		t.Errorf("Expected reachable CP to pass, got %v", err)
+	}
+
+	cp.Close()
+	if err := check.Verify(context.Background()); err == nil {
+		t.Error("Expected unreachable CP to fail")
+	}
+}
+
+func TestMissingNames(t *testing.T) {
+	tests := []struct {
+		name     string
+		want     []string
+		have     []string
+		expected []string
+	}{
+		{"all up", []string{"ibgp_2", "ibgp_3"}, []string{"ibgp_3", "ibgp_2", "ibgp_4"}, nil},
+		{"one down", []string{"ibgp_2", "ibgp_3"}, []string{"ibgp_3"}, []string{"ibgp_2"}},
+		{"nothing expected", nil, []string{"ibgp_2"}, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := missingNames(tt.want, tt.have); !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("Expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestDownIBGP(t *testing.T) {
+	protocols := []bird.Protocol{
+		{Name: "ibgp_2", Proto: "BGP", State: "up", Info: "Established"},
+		{Name: "ibgp_3", Proto: "BGP", State: "start", Info: "Active"},
+	}
+
+	tests := []struct {
+		name     string
+		want     []string
+		expected []string
+	}{
+		{"all up", []string{"ibgp_2"}, nil},
+		{"one down", []string{"ibgp_2", "ibgp_3"}, []string{"ibgp_3"}},
+		// ibgp_4 was removed by the new config, e.g. a stale peer
+		{"removed", []string{"ibgp_2", "ibgp_4"}, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := downIBGP(tt.want, protocols); !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("Expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,56 @@
+package task
+
+import (
+	"context"
+	"log"
+
+	"github.com/moenet/moenet-agent/internal/metrics"
+)
+
+// driftInterfaceMissing is the metric label used when the whole interface is gone
+const driftInterfaceMissing = "interface"
+
+// repairDrift compares the live WireGuard interface of an enabled session
+// with the desired state from CP and resets every field that differs
+func (s *SessionSync) repairDrift(ctx context.Context, session *BgpSession) {
+	if session.Type != SessionTypeWireGuard || session.Interface == "" {
+		return
+	}
+	desired, err := s.desiredWireGuard(session)
+	if err != nil {
+		log.Printf("[SessionSync] Warning: cannot check drift on %s (AS%d): %v", session.Interface, session.ASN, err)
+		return
+	}
+	if desired == nil {
+		return
+	}
+
+	live, err := s.wgExecutor.GetInterfaceState(session.Interface)
+	if err != nil {
+		// Interface deleted by hand: recreate it from scratch
+		log.Printf("[SessionSync] Drift on %s (AS%d): interface unreadable (%v), re-applying",
+			session.Interface, session.ASN, err)
+		if err := s.applyWireGuard(session); err != nil {
+			log.Printf("[SessionSync] Warning: failed to re-apply %s: %v", session.Interface, err)
+			return
+		}
+		metrics.Get().RecordDriftCorrection(driftInterfaceMissing)
+		return
+	}
+
+	for _, drift := range s.wgExecutor.Drift(ctx, desired, live) {
+		if drift.Desired != "" || drift.Live != "" {
+			log.Printf("[SessionSync] Drift on %s (AS%d): %s is %q, want %q",
+				session.Interface, session.ASN, drift.Field, drift.Live, drift.Desired)
+		} else {
+			log.Printf("[SessionSync] Drift on %s (AS%d): %s differs",
+				session.Interface, session.ASN, drift.Field)
+		}
+
+		if err := s.wgExecutor.Repair(ctx, session.Interface, desired, live, drift.Field); err != nil {
+			log.Printf("[SessionSync] Warning: failed to repair %s on %s: %v", drift.Field, session.Interface, err)
+			continue
+		}
+		metrics.Get().RecordDriftCorrection(drift.Field)
+	}
+}
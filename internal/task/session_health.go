@@ -0,0 +1,123 @@
+package task
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/moenet/moenet-agent/internal/bird"
+)
+
+// sessionHealth tracks how long an enabled session has been failing its checks
+type sessionHealth struct {
+	unhealthySince time.Time
+	lastError      string
+}
+
+// verifySession checks if an existing session is working. A session that
+// stays broken for longer than the configured grace period is reported to
+// CP as StatusProblem.
+func (s *SessionSync) verifySession(ctx context.Context, session *BgpSession) error {
+	// Undo manual edits and pick up CP changes before judging the session
+	s.repairDrift(ctx, session)
+
+	problem := s.checkSessionHealth(session)
+
+	s.healthMu.Lock()
+	health := s.health[session.UUID]
+	if problem == "" {
+		if health != nil {
+			log.Printf("[SessionSync] Session AS%d recovered after %s",
+				session.ASN, time.Since(health.unhealthySince).Round(time.Second))
+			delete(s.health, session.UUID)
+		}
+		s.healthMu.Unlock()
+		return nil
+	}
+	if health == nil {
+		health = &sessionHealth{unhealthySince: time.Now()}
+		s.health[session.UUID] = health
+	}
+	health.lastError = problem
+	brokenFor := time.Since(health.unhealthySince)
+	s.healthMu.Unlock()
+
+	grace := time.Duration(s.config.Session.HealthGracePeriod) * time.Second
+	if brokenFor < grace {
+		log.Printf("[SessionSync] Session AS%d unhealthy for %s (grace %s): %s",
+			session.ASN, brokenFor.Round(time.Second), grace, problem)
+		return nil
+	}
+
+	log.Printf("[SessionSync] Session AS%d broken for %s, reporting problem: %s",
+		session.ASN, brokenFor.Round(time.Second), problem)
+	if err := s.reportStatus(ctx, session.UUID, StatusProblem, problem); err != nil {
+		return fmt.Errorf("failed to report status: %w", err)
+	}
+
+	s.healthMu.Lock()
+	delete(s.health, session.UUID)
+	s.healthMu.Unlock()
+	return nil
+}
+
+// checkSessionHealth inspects the WireGuard handshake and the BIRD protocol
+// state of a session. It returns a description of all problems found, or an
+// empty string if the session is healthy.
+func (s *SessionSync) checkSessionHealth(session *BgpSession) string {
+	var problems []string
+
+	if session.Type == SessionTypeWireGuard && session.Interface != "" {
+		handshake, err := s.wgExecutor.LatestHandshake(session.Interface)
+		timeout := time.Duration(s.config.Session.HandshakeTimeout) * time.Second
+		switch {
+		case err != nil:
+			problems = append(problems, fmt.Sprintf("failed to read WireGuard handshake on %s: %v", session.Interface, err))
+		case handshake.IsZero():
+			problems = append(problems, fmt.Sprintf("no WireGuard handshake on %s", session.Interface))
+		case time.Since(handshake) > timeout:
+			problems = append(problems, fmt.Sprintf("last WireGuard handshake on %s was %s ago",
+				session.Interface, time.Since(handshake).Round(time.Second)))
+		}
+	}
+
+	for _, name := range s.sessionProtocols(session) {
+		if problem := s.checkProtocolHealth(name); problem != "" {
+			problems = append(problems, problem)
+		}
+	}
+
+	return strings.Join(problems, "; ")
+}
+
+// checkProtocolHealth returns a description of the problem of a BIRD
+// protocol, or an empty string if its BGP session is established
+func (s *SessionSync) checkProtocolHealth(name string) string {
+	detail, err := s.birdPool.ShowProtocolDetail(name)
+	if errors.Is(err, bird.ErrProtocolNotFound) {
+		return fmt.Sprintf("BIRD protocol %s not found", name)
+	}
+	if err != nil {
+		return fmt.Sprintf("failed to query BIRD protocol %s: %v", name, err)
+	}
+	return protocolProblem(detail)
+}
+
+// protocolProblem describes why the BGP session of a protocol is not
+// established, or returns an empty string if it is
+func protocolProblem(detail *bird.ProtocolDetail) string {
+	if detail.BGPState == "Established" {
+		return ""
+	}
+	msg := fmt.Sprintf("BGP %s is %s", detail.Name, detail.State)
+	if detail.BGPState != "" {
+		msg += fmt.Sprintf(" (state %s)", detail.BGPState)
+	}
+	if detail.LastError != "" {
+		msg += ", last error: " + detail.LastError
+	}
+	return msg
+}
@@ -0,0 +1,48 @@
+package task
+
+import (
+	"testing"
+
+	"github.com/moenet/moenet-agent/internal/bird"
+)
+
+func TestProtocolProblem(t *testing.T) {
+	tests := []struct {
+		name     string
+		detail   bird.ProtocolDetail
+		expected string
+	}{
+		{
+			name: "established",
+			detail: bird.ProtocolDetail{
+				Protocol: bird.Protocol{Name: "dn42_4242420919", State: "up"},
+				BGPState: "Established",
+			},
+			expected: "",
+		},
+		{
+			name: "active with error",
+			detail: bird.ProtocolDetail{
+				Protocol:  bird.Protocol{Name: "dn42_4242421080", State: "start"},
+				BGPState:  "Active",
+				LastError: "Socket: Connection refused",
+			},
+			expected: "BGP dn42_4242421080 is start (state Active), last error: Socket: Connection refused",
+		},
+		{
+			name: "disabled",
+			detail: bird.ProtocolDetail{
+				Protocol: bird.Protocol{Name: "dn42_4242421080", State: "down"},
+			},
+			expected: "BGP dn42_4242421080 is down",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := protocolProblem(&tt.detail); got != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, got)
+			}
+		})
+	}
+}
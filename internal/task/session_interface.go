@@ -0,0 +1,168 @@
+package task
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+)
+
+// maxInterfaceName is the longest interface name Linux accepts (IFNAMSIZ - 1)
+const maxInterfaceName = 15
+
+// validateInterfaceName checks that name can be used as the tunnel interface
+// of a session
+func validateInterfaceName(name string) error {
+	if name == "" {
+		return fmt.Errorf("interface name is empty")
+	}
+	if len(name) > maxInterfaceName {
+		return fmt.Errorf("interface name %q is longer than %d bytes", name, maxInterfaceName)
+	}
+	if name == "." || name == ".." {
+		return fmt.Errorf("interface name %q is not allowed", name)
+	}
+	for _, r := range name {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+		case r == '_', r == '-', r == '.':
+		default:
+			return fmt.Errorf("interface name %q contains invalid character %q", name, r)
+		}
+	}
+	if strings.HasPrefix(name, meshInterfacePrefix) {
+		return fmt.Errorf("interface name %q is reserved for mesh tunnels", name)
+	}
+	return nil
+}
+
+// generateInterfaceName returns the interface name of a session CP sent
+// without one: dn42_<last 4 ASN digits>_<session suffix>, cut to the length
+// Linux accepts. The name only depends on the session, so it is stable
+// across syncs and restarts.
+func generateInterfaceName(session *BgpSession) string {
+	name := fmt.Sprintf("dn42_%04d_%s", session.ASN%10000, sessionSuffix(session))
+	if len(name) > maxInterfaceName {
+		name = name[:maxInterfaceName]
+	}
+	return strings.TrimRight(name, "_")
+}
+
+// fallbackInterfaceName returns a name derived from the session UUID alone,
+// used when the generated name is taken by another session
+func fallbackInterfaceName(session *BgpSession) string {
+	sum := sha256.Sum256([]byte(session.UUID))
+	return "dn42_" + hex.EncodeToString(sum[:])[:maxInterfaceName-len("dn42_")]
+}
+
+// assignInterfaceNames validates the interface names of all sessions and
+// names the sessions CP sent without one. A name claimed by several sessions
+// stays with the session that already uses it, or else the lowest UUID.
+// Sessions left without a usable name are returned with the reason, by UUID.
+func (s *SessionSync) assignInterfaceNames(sessions []BgpSession) map[string]error {
+	current := make(map[string]string)
+	s.mu.RLock()
+	for uuid, session := range s.sessions {
+		current[uuid] = session.Interface
+	}
+	s.mu.RUnlock()
+
+	order := make([]*BgpSession, len(sessions))
+	for i := range sessions {
+		order[i] = &sessions[i]
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		a, b := order[i], order[j]
+		aOwns := a.Interface != "" && current[a.UUID] == a.Interface
+		bOwns := b.Interface != "" && current[b.UUID] == b.Interface
+		if aOwns != bOwns {
+			return aOwns
+		}
+		return a.UUID < b.UUID
+	})
+
+	owners := make(map[string]string) // key: interface name, value: UUID
+	errs := make(map[string]error)
+
+	// Names sent by CP first, so generated names never take them
+	for _, session := range order {
+		if session.Interface == "" {
+			continue
+		}
+		if err := validateInterfaceName(session.Interface); err != nil {
+			errs[session.UUID] = err
+			continue
+		}
+		if owner, taken := owners[session.Interface]; taken {
+			errs[session.UUID] = fmt.Errorf("interface name %q is already used by session %s", session.Interface, owner)
+			continue
+		}
+		owners[session.Interface] = session.UUID
+	}
+
+	for _, session := range order {
+		if session.Interface != "" {
+			continue
+		}
+		candidates := []string{current[session.UUID], generateInterfaceName(session), fallbackInterfaceName(session)}
+		for _, name := range candidates {
+			if name == "" || validateInterfaceName(name) != nil {
+				continue
+			}
+			if _, taken := owners[name]; taken {
+				continue
+			}
+			session.Interface = name
+			owners[name] = session.UUID
+			break
+		}
+		if session.Interface == "" {
+			errs[session.UUID] = fmt.Errorf("no free interface name for session")
+		}
+	}
+
+	return errs
+}
+
+// rejectInvalidInterfaces handles sessions without a usable interface name.
+// Sessions that would configure a tunnel are reported as problems and left
+// out of processing; the others are processed without touching any tunnel,
+// so a session never removes an interface owned by another one. Returns the
+// sessions to process.
+func (s *SessionSync) rejectInvalidInterfaces(ctx context.Context, sessions []BgpSession, errs map[string]error) []*BgpSession {
+	process := make([]*BgpSession, 0, len(sessions))
+	for i := range sessions {
+		session := &sessions[i]
+		err, invalid := errs[session.UUID]
+		if !invalid {
+			process = append(process, session)
+			continue
+		}
+
+		if needsInterface(session) {
+			log.Printf("[SessionSync] Session %s (AS%d) has no usable interface: %v", session.UUID, session.ASN, err)
+			if session.Status != StatusProblem {
+				session.Status = StatusProblem
+				if reportErr := s.reportStatus(ctx, session.UUID, StatusProblem, err.Error()); reportErr != nil {
+					log.Printf("[SessionSync] Warning: failed to report problem for AS%d: %v", session.ASN, reportErr)
+				}
+			}
+		} else {
+			session.Interface = ""
+			process = append(process, session)
+		}
+	}
+	return process
+}
+
+// needsInterface reports whether processing a session configures its tunnel
+func needsInterface(session *BgpSession) bool {
+	switch session.Status {
+	case StatusQueuedForSetup, StatusEnabled, StatusProblem:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,133 @@
+package task
+
+import "testing"
+
+func TestValidateInterfaceName(t *testing.T) {
+	tests := []struct {
+		name    string
+		iface   string
+		wantErr bool
+	}{
+		{"valid", "dn42_1080", false},
+		{"max length", "wg_424242108012", false},
+		{"dots and dashes", "wg-hk.1", false},
+		{"empty", "", true},
+		{"too long", "wg_4242421080123", true},
+		{"slash", "wg/1080", true},
+		{"space", "wg 1080", true},
+		{"colon", "wg:1080", true},
+		{"dot", ".", true},
+		{"mesh prefix", "dn42-wg-igp-3", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateInterfaceName(tt.iface)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Expected error %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestGenerateInterfaceName(t *testing.T) {
+	tests := []struct {
+		name     string
+		session  BgpSession
+		expected string
+	}{
+		{
+			name:     "uuid suffix",
+			session:  BgpSession{ASN: 4242421080, UUID: "1a2b3c4d-0000-4000-8000-000000000000"},
+			expected: "dn42_1080_1a2b3",
+		},
+		{
+			name:     "short asn",
+			session:  BgpSession{ASN: 64, UUID: "1a2b3c4d-0000"},
+			expected: "dn42_0064_1a2b3",
+		},
+		{
+			name:     "cp suffix",
+			session:  BgpSession{ASN: 4242420919, Suffix: "v4"},
+			expected: "dn42_0919_v4",
+		},
+		{
+			name:     "no suffix",
+			session:  BgpSession{ASN: 4242420919},
+			expected: "dn42_0919",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := generateInterfaceName(&tt.session)
+			if got != tt.expected {
+				t.Errorf("Expected %s, got %s", tt.expected, got)
+			}
+			if err := validateInterfaceName(got); err != nil {
+				t.Errorf("Expected a valid name, got %v", err)
+			}
+		})
+	}
+}
+
+func TestAssignInterfaceNames(t *testing.T) {
+	s := &SessionSync{sessions: map[string]*BgpSession{
+		"c": {UUID: "c", Interface: "wg_shared"},
+		"e": {UUID: "e", Interface: "dn42_0919_xyz"},
+	}}
+
+	sessions := []BgpSession{
+		{UUID: "a", ASN: 4242421080, Interface: "wg_shared"},                // Collides with the current owner
+		{UUID: "b", ASN: 4242421080, Interface: "wg_4242421080_long"},       // Too long
+		{UUID: "c", ASN: 4242420207, Interface: "wg_shared"},                // Current owner
+		{UUID: "d", ASN: 4242420919, Suffix: "v6"},                          // Generated
+		{UUID: "e", ASN: 4242420919},                                        // Keeps its name
+		{UUID: "f", ASN: 4242420919, Suffix: "v6"},                          // Generated name taken by d
+		{UUID: "g", ASN: 4242421234, Interface: "dn42_1234_x", Suffix: "x"}, // Sent by CP
+	}
+
+	errs := s.assignInterfaceNames(sessions)
+
+	for _, uuid := range []string{"a", "b"} {
+		if errs[uuid] == nil {
+			t.Errorf("Expected a naming error for session %s", uuid)
+		}
+	}
+	if len(errs) != 2 {
+		t.Errorf("Expected 2 naming errors, got %d: %v", len(errs), errs)
+	}
+
+	expected := map[string]string{
+		"c": "wg_shared",
+		"d": "dn42_0919_v6",
+		"e": "dn42_0919_xyz",
+		"f": fallbackInterfaceName(&BgpSession{UUID: "f"}),
+		"g": "dn42_1234_x",
+	}
+	for _, session := range sessions {
+		want, ok := expected[session.UUID]
+		if !ok {
+			continue
+		}
+		if session.Interface != want {
+			t.Errorf("Session %s: expected interface %s, got %s", session.UUID, want, session.Interface)
+		}
+		if err := validateInterfaceName(session.Interface); err != nil {
+			t.Errorf("Session %s: expected a valid name, got %v", session.UUID, err)
+		}
+	}
+}
+
+func TestNeedsInterface(t *testing.T) {
+	for _, status := range []int{StatusQueuedForSetup, StatusEnabled, StatusProblem} {
+		if !needsInterface(&BgpSession{Status: status}) {
+			t.Errorf("Expected status %d to need an interface", status)
+		}
+	}
+	for _, status := range []int{StatusDisabled, StatusQueuedForDelete, StatusTeardown, StatusPendingApproval} {
+		if needsInterface(&BgpSession{Status: status}) {
+			t.Errorf("Expected status %d not to need an interface", status)
+		}
+	}
+}
@@ -0,0 +1,223 @@
+package task
+
+import (
+	"fmt"
+	"log"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/moenet/moenet-agent/internal/bird"
+)
+
+// legacyPeerNamePattern matches peer files from before per-session naming
+var legacyPeerNamePattern = regexp.MustCompile(`^dn42_\d+$`)
+
+// sessionPeerName returns the BIRD protocol and peer file name for a session.
+// The name is unique per session, so several sessions with the same peer ASN
+// (e.g. one per address family or per site) can coexist.
+func sessionPeerName(session *BgpSession) string {
+	suffix := sessionSuffix(session)
+	if suffix == "" {
+		return fmt.Sprintf("dn42_%d", session.ASN)
+	}
+	return fmt.Sprintf("dn42_%d_%s", session.ASN, suffix)
+}
+
+// sessionSuffix returns the CP-supplied suffix, or the first 8 hex digits of
+// the session UUID. Characters not allowed in BIRD symbols are replaced.
+func sessionSuffix(session *BgpSession) string {
+	if session.Suffix != "" {
+		return sanitizeSymbol(session.Suffix)
+	}
+	suffix := strings.ReplaceAll(session.UUID, "-", "")
+	if len(suffix) > 8 {
+		suffix = suffix[:8]
+	}
+	return sanitizeSymbol(suffix)
+}
+
+// sanitizeSymbol lowercases s and replaces everything but [a-z0-9_] with '_'
+func sanitizeSymbol(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9', r == '_':
+			return r
+		case r >= 'A' && r <= 'Z':
+			return r - 'A' + 'a'
+		default:
+			return '_'
+		}
+	}, s)
+}
+
+// sessionProtocolName returns the name of the BIRD protocol currently running
+// for a session. Peer files moved by migrateLegacyConfigs keep their legacy
+// protocol name until the session is set up again.
+func (s *SessionSync) sessionProtocolName(session *BgpSession) string {
+	name := sessionPeerName(session)
+	if file, err := s.birdConfig.ReadSession(name); err == nil && file.Protocol != "" {
+		return file.Protocol
+	}
+	return name
+}
+
+// sessionProtocols returns all BIRD protocols of a session: the main protocol
+// and, for peers without MP-BGP, the separate IPv4 protocol
+func (s *SessionSync) sessionProtocols(session *BgpSession) []string {
+	name := sessionPeerName(session)
+	if file, err := s.birdConfig.ReadSession(name); err == nil && len(file.Protocols) > 0 {
+		return file.Protocols
+	}
+	return []string{name}
+}
+
+// legacyMigration is the rename of a dn42_<asn>.conf peer file
+type legacyMigration struct {
+	from     string
+	to       string
+	protocol string
+	iface    string      // Interface of the legacy neighbor statement
+	session  *BgpSession // Session the file belongs to
+	rename   bool        // Kept protocols collide with another session's
+}
+
+// migrateLegacyConfigs renames dn42_<asn>.conf peer files to the per-session
+// name of the session they belong to. Only the file is renamed: the protocols
+// inside keep their legacy names on purpose, so BIRD does not flap the
+// established session. They are renamed the next time the session's config is
+// rendered (setup, recreate or teardown), or right away if another session of
+// the same ASN declares one of them, e.g. the legacy IPv4 protocol
+// dn42_<asn>_v4 and a session with the CP suffix "v4". The renamed protocols
+// take effect with the reconfigure of that session's setup.
+func (s *SessionSync) migrateLegacyConfigs(sessions []BgpSession) {
+	for _, m := range s.legacyMigrations(sessions) {
+		if err := s.birdConfig.RenameSession(m.from, m.to); err != nil {
+			log.Printf("[SessionSync] Warning: failed to migrate %s to %s: %v", m.from, m.to, err)
+			continue
+		}
+		if !m.rename {
+			log.Printf("[SessionSync] Migrated legacy config %s to %s (protocol %s kept)", m.from, m.to, m.protocol)
+			continue
+		}
+
+		session := *m.session
+		if session.Interface == "" {
+			session.Interface = m.iface
+		}
+		cfg := s.birdSessionConfig(&session)
+		cfg.Teardown = session.Status == StatusTeardown
+		if err := s.birdConfig.GenerateSession(cfg); err != nil {
+			log.Printf("[SessionSync] Warning: failed to rename protocol %s in %s: %v", m.protocol, m.to, err)
+			continue
+		}
+		log.Printf("[SessionSync] Migrated legacy config %s to %s (protocol %s renamed, it collides with another session)", m.from, m.to, m.protocol)
+	}
+}
+
+// legacyMigrations lists the legacy peer files that can be matched to a session
+func (s *SessionSync) legacyMigrations(sessions []BgpSession) []legacyMigration {
+	names, err := s.birdConfig.ListSessions()
+	if err != nil {
+		log.Printf("[SessionSync] Warning: failed to scan BIRD peer configs: %v", err)
+		return nil
+	}
+
+	var migrations []legacyMigration
+	for _, name := range names {
+		if !legacyPeerNamePattern.MatchString(name) {
+			continue
+		}
+		file, err := s.birdConfig.ReadSession(name)
+		if err != nil {
+			log.Printf("[SessionSync] Warning: failed to read legacy config %s: %v", name, err)
+			continue
+		}
+
+		session := matchLegacyConfig(file.Name, file.Interface, sessions)
+		if session == nil {
+			// Without a live session of the ASN the file is an orphan;
+			// otherwise it may still run one of them, so it stays
+			if hasLiveLegacyPeer(name, sessions) {
+				log.Printf("[SessionSync] Warning: legacy config %s matches several sessions, left in place", name)
+			}
+			continue
+		}
+		if newName := sessionPeerName(session); newName != name {
+			migrations = append(migrations, legacyMigration{
+				from:     name,
+				to:       newName,
+				protocol: file.Protocol,
+				iface:    file.Interface,
+				session:  session,
+				rename:   legacyProtocolConflict(file.Protocols, session, sessions),
+			})
+		}
+	}
+	return migrations
+}
+
+// legacyProtocolConflict reports whether another live session of the same
+// ASN declares one of the protocols a legacy peer file would keep. Sessions
+// with a UUID always get a suffix, so in practice only the legacy IPv4
+// protocol dn42_<asn>_v4 collides, with the main protocol of a session whose
+// suffix is "v4".
+func legacyProtocolConflict(protocols []string, owner *BgpSession, sessions []BgpSession) bool {
+	for i := range sessions {
+		other := &sessions[i]
+		if other == owner || other.ASN != owner.ASN {
+			continue
+		}
+		if !isLiveSession(other) {
+			continue
+		}
+		name := sessionPeerName(other)
+		if slices.Contains(protocols, name) || slices.Contains(protocols, name+bird.IPv4ProtocolSuffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// legacyPeerName returns the peer file and protocol name used for an ASN
+// before per-session naming
+func legacyPeerName(asn uint32) string {
+	return fmt.Sprintf("dn42_%d", asn)
+}
+
+// isLiveSession reports whether a session is neither deleted nor about to be
+func isLiveSession(session *BgpSession) bool {
+	return session.Status != StatusDeleted && session.Status != StatusQueuedForDelete
+}
+
+// hasLiveLegacyPeer reports whether a live session has the ASN of a legacy
+// dn42_<asn> peer file. Such files are never handed to orphan cleanup.
+func hasLiveLegacyPeer(name string, sessions []BgpSession) bool {
+	for i := range sessions {
+		if isLiveSession(&sessions[i]) && legacyPeerName(sessions[i].ASN) == name {
+			return true
+		}
+	}
+	return false
+}
+
+// matchLegacyConfig finds the session a legacy dn42_<asn> peer file belongs
+// to: the session of that ASN using the same interface, or the only session
+// of that ASN if the interface does not decide
+func matchLegacyConfig(name, iface string, sessions []BgpSession) *BgpSession {
+	var candidates []*BgpSession
+	for i := range sessions {
+		session := &sessions[i]
+		if legacyPeerName(session.ASN) != name || !isLiveSession(session) {
+			continue
+		}
+		if iface != "" && session.Interface == iface {
+			return session
+		}
+		candidates = append(candidates, session)
+	}
+	if len(candidates) == 1 {
+		return candidates[0]
+	}
+	return nil
+}
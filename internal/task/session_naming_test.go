@@ -0,0 +1,171 @@
+package task
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/moenet/moenet-agent/internal/bird"
+	"github.com/moenet/moenet-agent/internal/config"
+	"github.com/moenet/moenet-agent/internal/wireguard"
+)
+
+func TestSessionPeerName(t *testing.T) {
+	tests := []struct {
+		name     string
+		session  BgpSession
+		expected string
+	}{
+		{
+			name:     "uuid suffix",
+			session:  BgpSession{ASN: 4242421080, UUID: "1A2B3C4D-0000-4000-8000-000000000000"},
+			expected: "dn42_4242421080_1a2b3c4d",
+		},
+		{
+			name:     "cp suffix",
+			session:  BgpSession{ASN: 4242421080, UUID: "1a2b3c4d-0000", Suffix: "v4"},
+			expected: "dn42_4242421080_v4",
+		},
+		{
+			name:     "cp suffix sanitized",
+			session:  BgpSession{ASN: 4242421080, Suffix: "HK-site.2"},
+			expected: "dn42_4242421080_hk_site_2",
+		},
+		{
+			name:     "no uuid",
+			session:  BgpSession{ASN: 4242421080},
+			expected: "dn42_4242421080",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := sessionPeerName(&tt.session); got != tt.expected {
+				t.Errorf("Expected %s, got %s", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestMatchLegacyConfig(t *testing.T) {
+	sessions := []BgpSession{
+		{UUID: "a", ASN: 4242421080, Interface: "dn42_1080", Status: StatusEnabled},
+		{UUID: "b", ASN: 4242421080, Interface: "dn42_1080_v4", Status: StatusEnabled},
+		{UUID: "c", ASN: 4242420919, Interface: "dn42_0919", Status: StatusEnabled},
+		{UUID: "d", ASN: 4242420207, Interface: "dn42_0207", Status: StatusQueuedForDelete},
+	}
+
+	tests := []struct {
+		name     string
+		file     string
+		iface    string
+		expected string
+	}{
+		{"interface match", "dn42_4242421080", "dn42_1080_v4", "b"},
+		{"ambiguous asn", "dn42_4242421080", "wg_old", ""},
+		{"single session", "dn42_4242420919", "wg_old", "c"},
+		{"deleted session", "dn42_4242420207", "dn42_0207", ""},
+		{"unknown asn", "dn42_4242429999", "", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := matchLegacyConfig(tt.file, tt.iface, sessions)
+			switch {
+			case tt.expected == "" && got != nil:
+				t.Errorf("Expected no match, got %s", got.UUID)
+			case tt.expected != "" && (got == nil || got.UUID != tt.expected):
+				t.Errorf("Expected session %s, got %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestMigrateLegacyConfigs(t *testing.T) {
+	legacy := &bird.SessionConfig{Name: "dn42_4242421080", Interface: "dn42_1080", ASN: 4242421080, IPv4: "172.20.0.1", IPv6LinkLocal: "fe80::1080"}
+	owner := BgpSession{UUID: "1a2b3c4d-0000", ASN: 4242421080, Interface: "dn42_1080", IPv4: "172.20.0.1", IPv6LinkLocal: "fe80::1080", Status: StatusEnabled}
+	// Declares dn42_4242421080_v4, the legacy IPv4 protocol
+	other := BgpSession{UUID: "5e6f7a8b-0000", ASN: 4242421080, Suffix: "v4", Status: StatusQueuedForSetup}
+	deleted := other
+	deleted.Status = StatusQueuedForDelete
+
+	tests := []struct {
+		name     string
+		sessions []BgpSession
+		expected []string
+	}{
+		{"protocols kept", []BgpSession{owner}, []string{"dn42_4242421080", "dn42_4242421080_v4"}},
+		{"deleted session ignored", []BgpSession{owner, deleted}, []string{"dn42_4242421080", "dn42_4242421080_v4"}},
+		{"collision renames protocols", []BgpSession{owner, other}, []string{"dn42_4242421080_1a2b3c4d", "dn42_4242421080_1a2b3c4d_v4"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g, err := bird.NewConfigGenerator(t.TempDir(), testRenderer(t))
+			if err != nil {
+				t.Fatalf("Failed to create generator: %v", err)
+			}
+			if err := g.GenerateSession(legacy); err != nil {
+				t.Fatalf("Failed to write legacy config: %v", err)
+			}
+			s := &SessionSync{config: &config.Config{}, birdConfig: g}
+
+			s.migrateLegacyConfigs(tt.sessions)
+
+			file, err := g.ReadSession("dn42_4242421080_1a2b3c4d")
+			if err != nil {
+				t.Fatalf("Expected migrated config, got %v", err)
+			}
+			if !slices.Equal(file.Protocols, tt.expected) {
+				t.Errorf("Expected protocols %v, got %v", tt.expected, file.Protocols)
+			}
+			if _, err := g.ReadSession("dn42_4242421080"); err == nil {
+				t.Error("Expected legacy config to be gone")
+			}
+		})
+	}
+}
+
+func TestAmbiguousLegacyConfigKept(t *testing.T) {
+	legacy := &bird.SessionConfig{Name: "dn42_4242421080", Interface: "wg_old", ASN: 4242421080, IPv6LinkLocal: "fe80::1080"}
+
+	tests := []struct {
+		name     string
+		sessions []BgpSession
+		orphan   bool
+	}{
+		{"ambiguous live sessions", []BgpSession{
+			{UUID: "1a2b3c4d-0000", ASN: 4242421080, Interface: "dn42_1080", Status: StatusEnabled},
+			{UUID: "5e6f7a8b-0000", ASN: 4242421080, Interface: "dn42_1080_b", Status: StatusEnabled},
+		}, false},
+		{"no live session", []BgpSession{
+			{UUID: "1a2b3c4d-0000", ASN: 4242421080, Interface: "dn42_1080", Status: StatusQueuedForDelete},
+		}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g, err := bird.NewConfigGenerator(t.TempDir(), testRenderer(t))
+			if err != nil {
+				t.Fatalf("Failed to create generator: %v", err)
+			}
+			if err := g.GenerateSession(legacy); err != nil {
+				t.Fatalf("Failed to write legacy config: %v", err)
+			}
+			s := &SessionSync{config: &config.Config{}, birdConfig: g, wgExecutor: &wireguard.Executor{}}
+
+			s.migrateLegacyConfigs(tt.sessions)
+			if _, err := g.ReadSession("dn42_4242421080"); err != nil {
+				t.Fatalf("Expected legacy config to stay in place, got %v", err)
+			}
+
+			remoteMap := make(map[string]*BgpSession)
+			for i := range tt.sessions {
+				remoteMap[tt.sessions[i].UUID] = &tt.sessions[i]
+			}
+			peers, _, _ := s.findOrphans(remoteMap)
+			if got := slices.Contains(peers, "dn42_4242421080"); got != tt.orphan {
+				t.Errorf("Expected orphan %v, got peers %v", tt.orphan, peers)
+			}
+		})
+	}
+}
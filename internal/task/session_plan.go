@@ -0,0 +1,263 @@
+package task
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/moenet/moenet-agent/internal/plan"
+	"github.com/moenet/moenet-agent/internal/tunnel"
+	"github.com/moenet/moenet-agent/internal/wireguard"
+)
+
+// sessionPlanTask is the task name used in plan actions
+const sessionPlanTask = "SessionSync"
+
+// Plan records the actions the next Sync would take, without executing them
+func (s *SessionSync) Plan(ctx context.Context, p *plan.Plan) error {
+	sessions, err := s.fetchSessions(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to fetch sessions: %w", err)
+	}
+
+	remoteMap := make(map[string]*BgpSession)
+	for i := range sessions {
+		remoteMap[sessions[i].UUID] = &sessions[i]
+	}
+
+	migrated := make(map[string]bool)
+	for _, m := range s.legacyMigrations(sessions) {
+		detail := fmt.Sprintf("to %s, protocol %s kept", s.birdConfig.SessionPath(m.to), m.protocol)
+		if m.rename {
+			detail = fmt.Sprintf("to %s, protocol %s renamed", s.birdConfig.SessionPath(m.to), m.protocol)
+		}
+		p.Add(sessionPlanTask, plan.KindRenameFile, s.birdConfig.SessionPath(m.from), detail)
+		migrated[m.from] = true
+	}
+
+	nameErrs := s.assignInterfaceNames(sessions)
+
+	reconfigure := false
+	for i := range sessions {
+		session := &sessions[i]
+		if err, invalid := nameErrs[session.UUID]; invalid {
+			if needsInterface(session) {
+				p.Errors = append(p.Errors, fmt.Sprintf("%s: AS%d: %v", sessionPlanTask, session.ASN, err))
+				continue
+			}
+			session.Interface = ""
+		}
+		switch session.Status {
+		case StatusQueuedForSetup:
+			s.planTunnel(ctx, p, session)
+			content, err := s.birdConfig.RenderSession(s.birdSessionConfig(session))
+			if err != nil {
+				p.Errors = append(p.Errors, fmt.Sprintf("%s: AS%d: %v", sessionPlanTask, session.ASN, err))
+				continue
+			}
+			if p.WriteFile(sessionPlanTask, s.birdConfig.SessionPath(sessionPeerName(session)), content) {
+				reconfigure = true
+			}
+			p.Add(sessionPlanTask, plan.KindReportStatus, sessionTarget(session), "enabled")
+		case StatusEnabled:
+			s.planDrift(ctx, p, session)
+		case StatusQueuedForDelete, StatusDisabled:
+			if p.DeleteFile(sessionPlanTask, s.birdConfig.SessionPath(sessionPeerName(session))) {
+				reconfigure = true
+			}
+			s.planDeleteTunnel(p, session)
+			if session.Status == StatusQueuedForDelete {
+				p.Add(sessionPlanTask, plan.KindReportStatus, sessionTarget(session), "deleted")
+			}
+		case StatusTeardown:
+			if s.planTeardown(p, session) {
+				reconfigure = true
+			}
+		case StatusProblem:
+			step := remediationLadder[0]
+			s.remediationMu.Lock()
+			if state := s.remediation[session.UUID]; state != nil {
+				step = state.NextStep
+			}
+			s.remediationMu.Unlock()
+			p.Add(sessionPlanTask, plan.KindRemediate, sessionTarget(session), "next step "+step)
+		}
+	}
+
+	// Orphans, except legacy files that are renamed instead
+	peers, links, ports := s.findOrphans(remoteMap)
+	for _, name := range peers {
+		if !migrated[name] && p.DeleteFile(sessionPlanTask, s.birdConfig.SessionPath(name)) {
+			reconfigure = true
+		}
+	}
+	for _, link := range links {
+		p.Add(sessionPlanTask, plan.KindDeleteInterface, link, "orphaned")
+	}
+
+	if s.fwExecutor != nil {
+		s.planPorts(p, sessions, ports)
+	}
+
+	if reconfigure {
+		p.Add(sessionPlanTask, plan.KindReconfigure, "bird", "")
+	}
+	return nil
+}
+
+// planTeardown records the GRACEFUL_SHUTDOWN config of a session that starts
+// draining, or disabling it once the drain period is over. It reports
+// whether BIRD would be reconfigured.
+func (s *SessionSync) planTeardown(p *plan.Plan, session *BgpSession) bool {
+	s.teardownMu.Lock()
+	state := s.teardown[session.UUID]
+	s.teardownMu.Unlock()
+
+	if state == nil {
+		cfg := s.birdSessionConfig(session)
+		cfg.Teardown = true
+		content, err := s.birdConfig.RenderSession(cfg)
+		if err != nil {
+			p.Errors = append(p.Errors, fmt.Sprintf("%s: AS%d: %v", sessionPlanTask, session.ASN, err))
+			return false
+		}
+		p.WriteFile(sessionPlanTask, s.birdConfig.SessionPath(sessionPeerName(session)), content)
+		return true
+	}
+
+	s.teardownMu.Lock()
+	rate := state.rate
+	s.teardownMu.Unlock()
+
+	drain := time.Duration(s.config.Session.TeardownDrainPeriod) * time.Second
+	threshold := float64(s.config.Session.TeardownDrainThreshold)
+	if result := drainStatus(time.Since(state.started), drain, rate, threshold); result != drainPending {
+		detail := "drained"
+		if result == drainExpired {
+			detail = fmt.Sprintf("drain period over, %.0f B/s left", rate)
+		}
+		for _, protocol := range s.sessionProtocols(session) {
+			p.Add(sessionPlanTask, plan.KindDisableProtocol, protocol, detail)
+		}
+		p.Add(sessionPlanTask, plan.KindReportStatus, sessionTarget(session), "queued-for-delete")
+	}
+	return false
+}
+
+// planTunnel records creating or updating the tunnel of a session
+func (s *SessionSync) planTunnel(ctx context.Context, p *plan.Plan, session *BgpSession) {
+	switch session.Type {
+	case SessionTypeWireGuard:
+		if _, err := s.desiredWireGuard(session); err != nil {
+			p.Errors = append(p.Errors, fmt.Sprintf("%s: AS%d: %v", sessionPlanTask, session.ASN, err))
+			return
+		}
+		if !s.wgExecutor.InterfaceExists(session.Interface) {
+			p.Add(sessionPlanTask, plan.KindCreateInterface, session.Interface, session.Type)
+			return
+		}
+		s.planDrift(ctx, p, session)
+	case SessionTypeGRE, SessionTypeIP6GRE:
+		if !s.tnExecutor.TunnelExists(session.Interface) {
+			p.Add(sessionPlanTask, plan.KindCreateInterface, session.Interface, session.Type)
+			return
+		}
+		remote, err := tunnel.ResolveRemote(ctx, session.Endpoint, session.Type)
+		live, liveErr := s.tnExecutor.GetTunnel(session.Interface)
+		if err != nil || liveErr != nil || live.Mode != session.Type || live.Remote != remote {
+			p.Add(sessionPlanTask, plan.KindUpdateInterface, session.Interface, session.Type+" endpoints")
+		}
+	default:
+		p.Errors = append(p.Errors, fmt.Sprintf("%s: AS%d: unsupported session type %q",
+			sessionPlanTask, session.ASN, session.Type))
+	}
+}
+
+// planDrift records the WireGuard fields repairDrift would reset
+func (s *SessionSync) planDrift(ctx context.Context, p *plan.Plan, session *BgpSession) {
+	if session.Type != SessionTypeWireGuard || session.Interface == "" {
+		return
+	}
+	desired, err := s.desiredWireGuard(session)
+	if err != nil {
+		p.Errors = append(p.Errors, fmt.Sprintf("%s: AS%d: %v", sessionPlanTask, session.ASN, err))
+		return
+	}
+	if desired == nil {
+		return
+	}
+
+	live, err := s.wgExecutor.GetInterfaceState(session.Interface)
+	if err != nil {
+		p.Add(sessionPlanTask, plan.KindCreateInterface, session.Interface, "wireguard, interface unreadable")
+		return
+	}
+	if drifts := s.wgExecutor.Drift(ctx, desired, live); len(drifts) > 0 {
+		p.Add(sessionPlanTask, plan.KindUpdateInterface, session.Interface, driftFields(drifts))
+	}
+}
+
+// planDeleteTunnel records removing the tunnel of a session if it exists
+func (s *SessionSync) planDeleteTunnel(p *plan.Plan, session *BgpSession) {
+	if session.Interface == "" {
+		return
+	}
+	switch session.Type {
+	case SessionTypeWireGuard:
+		if !s.wgExecutor.InterfaceExists(session.Interface) {
+			return
+		}
+	case SessionTypeGRE, SessionTypeIP6GRE:
+		if !s.tnExecutor.TunnelExists(session.Interface) {
+			return
+		}
+	default:
+		return
+	}
+	p.Add(sessionPlanTask, plan.KindDeleteInterface, session.Interface, session.Type)
+}
+
+// planPorts records the firewall changes of the port sync and orphan cleanup
+func (s *SessionSync) planPorts(p *plan.Plan, sessions []BgpSession, orphanPorts []int) {
+	open, err := s.fwExecutor.GetOpenPorts()
+	if err != nil {
+		p.Errors = append(p.Errors, fmt.Sprintf("%s: failed to read firewall ports: %v", sessionPlanTask, err))
+		return
+	}
+
+	isOpen := make(map[int]bool)
+	for _, port := range open {
+		isOpen[port] = true
+	}
+	expected := make(map[int]bool)
+	for _, port := range expectedPorts(sessions) {
+		if !expected[port] && !isOpen[port] {
+			p.Add(sessionPlanTask, plan.KindOpenPort, strconv.Itoa(port), "")
+		}
+		expected[port] = true
+	}
+
+	closed := make(map[int]bool)
+	for _, port := range append(open, orphanPorts...) {
+		if !expected[port] && !closed[port] {
+			p.Add(sessionPlanTask, plan.KindClosePort, strconv.Itoa(port), "")
+			closed[port] = true
+		}
+	}
+}
+
+// sessionTarget formats a session for plan output
+func sessionTarget(session *BgpSession) string {
+	return fmt.Sprintf("AS%d (%s)", session.ASN, session.UUID)
+}
+
+// driftFields joins the field names of drifts
+func driftFields(drifts []wireguard.Drift) string {
+	fields := make([]string, len(drifts))
+	for i, drift := range drifts {
+		fields[i] = drift.Field
+	}
+	return strings.Join(fields, ", ")
+}
@@ -0,0 +1,244 @@
+package task
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+)
+
+// Remediation steps, in escalation order
+const (
+	RemediationReapplyTunnel = "reapply-tunnel"
+	RemediationRestartBGP    = "restart-bgp"
+	RemediationRecreate      = "recreate"
+)
+
+// remediationLadder is the order in which repair steps are attempted
+var remediationLadder = []string{
+	RemediationReapplyTunnel,
+	RemediationRestartBGP,
+	RemediationRecreate,
+}
+
+// maxRemediationHistory bounds the number of events kept per session
+const maxRemediationHistory = 10
+
+// RemediationEvent records a single repair attempt
+type RemediationEvent struct {
+	Time    time.Time `json:"time"`
+	Attempt int       `json:"attempt"`
+	Step    string    `json:"step"`
+	Problem string    `json:"problem"`         // Health problem that triggered the attempt
+	Error   string    `json:"error,omitempty"` // Error of the step itself
+}
+
+// RemediationState tracks the repair progress of a StatusProblem session
+type RemediationState struct {
+	UUID        string             `json:"uuid"`
+	ASN         uint32             `json:"asn"`
+	Attempts    int                `json:"attempts"`
+	NextStep    string             `json:"nextStep"`
+	NextAttempt time.Time          `json:"nextAttempt"`
+	History     []RemediationEvent `json:"history"`
+}
+
+// handleProblemSession attempts to fix a problematic session. Each call
+// checks whether the session recovered and otherwise runs the next step of
+// the remediation ladder, backing off exponentially between attempts.
+func (s *SessionSync) handleProblemSession(ctx context.Context, session *BgpSession) error {
+	s.remediationMu.Lock()
+	state := s.remediation[session.UUID]
+	if state == nil {
+		state = &RemediationState{UUID: session.UUID, ASN: session.ASN, NextStep: remediationLadder[0]}
+		s.remediation[session.UUID] = state
+	}
+	if time.Now().Before(state.NextAttempt) {
+		s.remediationMu.Unlock()
+		return nil
+	}
+	attempt := state.Attempts
+	s.remediationMu.Unlock()
+
+	// Recovered, either on its own or by the previous step
+	problem := s.checkSessionHealth(session)
+	if problem == "" {
+		log.Printf("[SessionSync] Problem session AS%d recovered after %d remediation attempts", session.ASN, attempt)
+		if err := s.reportStatus(ctx, session.UUID, StatusEnabled, ""); err != nil {
+			return fmt.Errorf("failed to report status: %w", err)
+		}
+		s.remediationMu.Lock()
+		delete(s.remediation, session.UUID)
+		s.remediationMu.Unlock()
+		return nil
+	}
+
+	step := remediationLadder[attempt%len(remediationLadder)]
+	log.Printf("[SessionSync] Remediating session AS%d (attempt %d, step %s): %s",
+		session.ASN, attempt+1, step, problem)
+
+	event := RemediationEvent{Time: time.Now(), Attempt: attempt + 1, Step: step, Problem: problem}
+	if err := s.runRemediationStep(ctx, step, session); err != nil {
+		log.Printf("[SessionSync] Remediation step %s for AS%d failed: %v", step, session.ASN, err)
+		event.Error = err.Error()
+	}
+
+	s.remediationMu.Lock()
+	state.Attempts++
+	state.NextStep = remediationLadder[state.Attempts%len(remediationLadder)]
+	state.NextAttempt = time.Now().Add(s.remediationBackoff(state.Attempts))
+	state.History = append(state.History, event)
+	if len(state.History) > maxRemediationHistory {
+		state.History = state.History[len(state.History)-maxRemediationHistory:]
+	}
+	summary := formatRemediationHistory(state)
+	finalStep := step == remediationLadder[len(remediationLadder)-1]
+	s.remediationMu.Unlock()
+
+	// The whole ladder ran: keep StatusProblem but tell CP what was tried
+	if finalStep {
+		if err := s.reportStatus(ctx, session.UUID, StatusProblem, summary); err != nil {
+			return fmt.Errorf("failed to report status: %w", err)
+		}
+	}
+	return nil
+}
+
+// runRemediationStep executes a single step of the remediation ladder
+func (s *SessionSync) runRemediationStep(ctx context.Context, step string, session *BgpSession) error {
+	switch step {
+	case RemediationReapplyTunnel:
+		return s.applyTunnel(session)
+	case RemediationRestartBGP:
+		return s.protocolsCommand("restart", s.sessionProtocols(session))
+	case RemediationRecreate:
+		return s.recreateTransaction(ctx, session).run()
+	default:
+		return fmt.Errorf("unknown remediation step %q", step)
+	}
+}
+
+// recreateTransaction deletes the tunnel interface and BIRD config of a
+// session and sets them up again. The deletions are steps of the setup
+// transaction, so a failed setup brings the old interface and config back.
+func (s *SessionSync) recreateTransaction(ctx context.Context, session *BgpSession) *transaction {
+	tx := &transaction{name: fmt.Sprintf("recreate of AS%d", session.ASN)}
+	name := sessionPeerName(session)
+
+	tx.add("delete-interface", func() error {
+		if err := s.deleteTunnel(session); err != nil {
+			return fmt.Errorf("failed to delete tunnel interface: %w", err)
+		}
+		return nil
+	}, func() error {
+		return s.applyTunnel(session)
+	})
+
+	var previous []byte
+	unloaded := false
+	tx.add("remove-bird-config", func() error {
+		content, err := s.birdConfig.LoadSession(name)
+		if err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to back up BIRD config: %w", err)
+		}
+		previous = content
+		if err := s.birdConfig.RemoveSession(name); err != nil {
+			return fmt.Errorf("failed to remove BIRD config: %w", err)
+		}
+		return nil
+	}, func() error {
+		if err := s.birdConfig.RestoreSession(name, previous); err != nil {
+			return err
+		}
+		if unloaded {
+			return s.birdPool.Reconfigure(ctx)
+		}
+		return nil
+	})
+
+	// Reload BIRD without the peer config, so the protocols are torn down
+	// instead of being carried over to the rewritten config
+	tx.add("unload-bird-config", func() error {
+		if err := s.birdPool.Reconfigure(ctx); err != nil {
+			return err
+		}
+		unloaded = true
+		return nil
+	}, nil)
+
+	tx.steps = append(tx.steps, s.setupTransaction(ctx, session).steps...)
+	return tx
+}
+
+// protocolCommand runs a BIRD protocol command such as restart or disable
+func (s *SessionSync) protocolCommand(command, name string) error {
+	if _, err := s.birdPool.Command(command + " " + name); err != nil {
+		return fmt.Errorf("%s %s failed: %w", command, name, err)
+	}
+	return nil
+}
+
+// protocolsCommand runs a BIRD protocol command on all protocols of a session.
+// Every protocol is tried; the first error is returned.
+func (s *SessionSync) protocolsCommand(command string, names []string) error {
+	var firstErr error
+	for _, name := range names {
+		if err := s.protocolCommand(command, name); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// remediationBackoff returns the delay before the next attempt
+func (s *SessionSync) remediationBackoff(attempts int) time.Duration {
+	base := time.Duration(s.config.Session.RemediationBackoff) * time.Second
+	maxDelay := time.Duration(s.config.Session.RemediationMaxBackoff) * time.Second
+	return remediationDelay(base, maxDelay, attempts)
+}
+
+// remediationDelay doubles base for every attempt after the first, capped at maxDelay
+func remediationDelay(base, maxDelay time.Duration, attempts int) time.Duration {
+	delay := base
+	for i := 1; i < attempts; i++ {
+		delay *= 2
+		if delay >= maxDelay {
+			return maxDelay
+		}
+	}
+	if delay > maxDelay {
+		return maxDelay
+	}
+	return delay
+}
+
+// formatRemediationHistory renders the attempt history for the CP lastError field
+func formatRemediationHistory(state *RemediationState) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "remediation failed after %d attempts", state.Attempts)
+	for _, event := range state.History {
+		fmt.Fprintf(&b, "; [%s] #%d %s: ", event.Time.UTC().Format(time.RFC3339), event.Attempt, event.Step)
+		if event.Error != "" {
+			b.WriteString("error: " + event.Error)
+		} else {
+			b.WriteString("applied, problem was: " + event.Problem)
+		}
+	}
+	return b.String()
+}
+
+// GetRemediationStates returns a snapshot of all sessions under remediation
+func (s *SessionSync) GetRemediationStates() []RemediationState {
+	s.remediationMu.Lock()
+	defer s.remediationMu.Unlock()
+
+	result := make([]RemediationState, 0, len(s.remediation))
+	for _, state := range s.remediation {
+		snapshot := *state
+		snapshot.History = append([]RemediationEvent(nil), state.History...)
+		result = append(result, snapshot)
+	}
+	return result
+}
@@ -0,0 +1,148 @@
+package task
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"net"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/moenet/moenet-agent/internal/bird"
+	"github.com/moenet/moenet-agent/internal/config"
+)
+
+func TestRemediationDelay(t *testing.T) {
+	base := time.Minute
+	maxDelay := 10 * time.Minute
+
+	tests := []struct {
+		attempts int
+		expected time.Duration
+	}{
+		{1, time.Minute},
+		{2, 2 * time.Minute},
+		{3, 4 * time.Minute},
+		{4, 8 * time.Minute},
+		{5, 10 * time.Minute},
+		{50, 10 * time.Minute},
+	}
+
+	for _, tt := range tests {
+		if got := remediationDelay(base, maxDelay, tt.attempts); got != tt.expected {
+			t.Errorf("remediationDelay(%d) = %v, want %v", tt.attempts, got, tt.expected)
+		}
+	}
+}
+
+func TestFormatRemediationHistory(t *testing.T) {
+	state := &RemediationState{
+		Attempts: 2,
+		History: []RemediationEvent{
+			{Time: time.Unix(1700000000, 0), Attempt: 1, Step: RemediationReapplyTunnel, Problem: "no WireGuard handshake"},
+			{Time: time.Unix(1700000060, 0), Attempt: 2, Step: RemediationRestartBGP, Error: "restart failed"},
+		},
+	}
+
+	got := formatRemediationHistory(state)
+	for _, want := range []string{
+		"remediation failed after 2 attempts",
+		"#1 reapply-tunnel: applied, problem was: no WireGuard handshake",
+		"#2 restart-bgp: error: restart failed",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("Expected history to contain %q, got %q", want, got)
+		}
+	}
+}
+
+// startTestBird serves the BIRD control protocol on a unix socket and calls
+// onConfigure for every configure command before answering it
+func startTestBird(t *testing.T, onConfigure func()) *bird.Pool {
+	t.Helper()
+	socket := filepath.Join(t.TempDir(), "bird.ctl")
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatalf("Failed to listen on %s: %v", socket, err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				conn.Write([]byte("0001 BIRD 3.0.0 ready.\n"))
+				reader := bufio.NewReader(conn)
+				for {
+					line, err := reader.ReadString('\n')
+					if err != nil {
+						return
+					}
+					if strings.TrimSpace(line) != "configure" {
+						conn.Write([]byte("9001 syntax error\n"))
+						continue
+					}
+					onConfigure()
+					conn.Write([]byte("0003 Reconfigured\n"))
+				}
+			}()
+		}
+	}()
+
+	pool, err := bird.NewPool(socket, 0, 1)
+	if err != nil {
+		t.Fatalf("Failed to create pool: %v", err)
+	}
+	t.Cleanup(pool.Close)
+	pool.SetReconfigureDebounce(0)
+	return pool
+}
+
+func TestRecreateRollback(t *testing.T) {
+	g, err := bird.NewConfigGenerator(t.TempDir(), testRenderer(t))
+	if err != nil {
+		t.Fatalf("Failed to create generator: %v", err)
+	}
+
+	// The unsupported type makes the setup fail after the deletions
+	session := &BgpSession{UUID: "1a2b3c4d-0000", ASN: 4242420919, Type: "bogus"}
+	name := sessionPeerName(session)
+
+	// Whether the peer config was on disk at each BIRD reconfigure
+	var mu sync.Mutex
+	var loaded []bool
+	pool := startTestBird(t, func() {
+		_, err := g.LoadSession(name)
+		mu.Lock()
+		loaded = append(loaded, err == nil)
+		mu.Unlock()
+	})
+	s := &SessionSync{config: &config.Config{}, birdPool: pool, birdConfig: g}
+
+	if err := g.RestoreSession(name, []byte("old config")); err != nil {
+		t.Fatalf("Failed to write session config: %v", err)
+	}
+
+	var stepErr *txError
+	if err := s.recreateTransaction(context.Background(), session).run(); !errors.As(err, &stepErr) || stepErr.step != "interface" {
+		t.Fatalf("Expected interface step error, got %v", err)
+	}
+	if content, err := g.LoadSession(name); err != nil || string(content) != "old config" {
+		t.Errorf("Expected the BIRD config to be restored, got %q (%v)", content, err)
+	}
+
+	// BIRD is reloaded without the peer config before the setup, and with
+	// the restored config after the rollback
+	mu.Lock()
+	defer mu.Unlock()
+	if len(loaded) != 2 || loaded[0] || !loaded[1] {
+		t.Errorf("Expected reconfigures without and then with the peer config, got %v", loaded)
+	}
+}
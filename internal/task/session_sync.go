@@ -4,16 +4,22 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
+	"net"
 	"net/http"
+	"os"
+	"sort"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/moenet/moenet-agent/internal/bird"
 	"github.com/moenet/moenet-agent/internal/config"
 	"github.com/moenet/moenet-agent/internal/firewall"
+	"github.com/moenet/moenet-agent/internal/tunnel"
 	"github.com/moenet/moenet-agent/internal/wireguard"
 )
 
@@ -24,25 +30,65 @@ type SessionSync struct {
 	birdPool   *bird.Pool
 	birdConfig *bird.ConfigGenerator
 	wgExecutor *wireguard.Executor
+	tnExecutor *tunnel.Executor
 	fwExecutor *firewall.Executor
 
 	// Local session state
 	mu       sync.RWMutex
 	sessions map[string]*BgpSession // key: UUID
+
+	// Health tracking for enabled sessions
+	healthMu sync.Mutex
+	health   map[string]*sessionHealth // key: UUID
+
+	// Remediation state for StatusProblem sessions
+	remediationMu sync.Mutex
+	remediation   map[string]*RemediationState // key: UUID
+
+	// Persisted state, nil if not configured
+	stateStore *StateStore
+
+	// Drain state for StatusTeardown sessions
+	teardownMu sync.Mutex
+	teardown   map[string]*teardownState // key: UUID
+
+	// Serializes the operations of each session across sync workers
+	sessionLocks keyLocks // key: UUID
 }
 
 // NewSessionSync creates a new session sync handler
-func NewSessionSync(cfg *config.Config, birdPool *bird.Pool, birdConfig *bird.ConfigGenerator, wgExecutor *wireguard.Executor, fwExecutor *firewall.Executor) *SessionSync {
+func NewSessionSync(cfg *config.Config, birdPool *bird.Pool, birdConfig *bird.ConfigGenerator, wgExecutor *wireguard.Executor, tnExecutor *tunnel.Executor, fwExecutor *firewall.Executor) *SessionSync {
 	return &SessionSync{
 		config: cfg,
 		httpClient: &http.Client{
 			Timeout: time.Duration(cfg.ControlPlane.RequestTimeout) * time.Second,
 		},
-		birdPool:   birdPool,
-		birdConfig: birdConfig,
-		wgExecutor: wgExecutor,
-		fwExecutor: fwExecutor,
-		sessions:   make(map[string]*BgpSession),
+		birdPool:    birdPool,
+		birdConfig:  birdConfig,
+		wgExecutor:  wgExecutor,
+		tnExecutor:  tnExecutor,
+		fwExecutor:  fwExecutor,
+		sessions:    make(map[string]*BgpSession),
+		health:      make(map[string]*sessionHealth),
+		remediation: make(map[string]*RemediationState),
+		teardown:    make(map[string]*teardownState),
+	}
+}
+
+// SetStateStore sets the store the applied sessions are persisted to. The
+// sessions of the previous run become the working state until CP answers,
+// so their leftovers are found by orphan reconciliation.
+func (s *SessionSync) SetStateStore(store *StateStore) {
+	s.stateStore = store
+
+	saved := store.Get().Sessions
+	s.mu.Lock()
+	for i := range saved {
+		s.sessions[saved[i].UUID] = &saved[i]
+	}
+	s.mu.Unlock()
+	if len(saved) > 0 {
+		log.Printf("[SessionSync] Restored %d sessions from state file", len(saved))
 	}
 }
 
@@ -87,46 +133,212 @@ func (s *SessionSync) Sync(ctx context.Context) error {
 		remoteMap[sessions[i].UUID] = &sessions[i]
 	}
 
-	// Process sessions
-	for _, session := range sessions {
-		if err := s.processSession(ctx, &session); err != nil {
-			log.Printf("[SessionSync] Failed to process session %s (AS%d): %v",
-				session.UUID, session.ASN, err)
+	// Move peer files from before per-session naming to their new names
+	s.migrateLegacyConfigs(sessions)
+
+	// Validate interface names and name the sessions CP sent without one
+	process := s.rejectInvalidInterfaces(ctx, sessions, s.assignInterfaceNames(sessions))
+
+	// Process sessions in parallel (through the map entries, so status changes are kept)
+	s.processSessions(ctx, process)
+
+	// Tear down sessions that disappeared from CP
+	s.reconcileOrphans(ctx, remoteMap)
+
+	// Drop health and remediation tracking of sessions that changed status
+	s.pruneTracking(remoteMap)
+
+	// Update local session map
+	s.mu.Lock()
+	s.sessions = remoteMap
+	s.mu.Unlock()
+
+	if s.stateStore != nil {
+		if err := s.stateStore.SetSessions(sessions); err != nil {
+			log.Printf("[SessionSync] Warning: failed to persist state: %v", err)
+		}
+	}
+
+	// Sync firewall ports
+	if s.fwExecutor != nil {
+		if added, removed, err := s.fwExecutor.SyncPorts(expectedPorts(sessions)); err != nil {
+			log.Printf("[SessionSync] Firewall sync error: %v", err)
+		} else if added > 0 || removed > 0 {
+			log.Printf("[SessionSync] Firewall synced: %d added, %d removed", added, removed)
 		}
 	}
 
-	// Find deleted sessions (in local but not in remote)
+	return nil
+}
+
+// reconcileOrphans removes the BIRD config, WireGuard interface and firewall
+// port of sessions that are no longer present in the CP response
+func (s *SessionSync) reconcileOrphans(ctx context.Context, remoteMap map[string]*BgpSession) {
 	s.mu.RLock()
 	for uuid, localSession := range s.sessions {
 		if _, exists := remoteMap[uuid]; !exists {
 			log.Printf("[SessionSync] Session %s (AS%d) removed from CP, cleaning up",
 				uuid, localSession.ASN)
-			// TODO: Remove WireGuard interface and BIRD config
 		}
 	}
 	s.mu.RUnlock()
 
-	// Update local session map
-	s.mu.Lock()
-	s.sessions = remoteMap
-	s.mu.Unlock()
+	orphanPeers, orphanLinks, orphanPorts := s.findOrphans(remoteMap)
+	if len(orphanPeers) == 0 && len(orphanLinks) == 0 && len(orphanPorts) == 0 {
+		return
+	}
+
+	// Remove BIRD configs first and reload once, then tear down the tunnels
+	if err := s.removeSessionConfigs(ctx, orphanPeers); err != nil {
+		log.Printf("[SessionSync] Warning: BIRD reconfigure failed: %v", err)
+		if errors.Is(err, bird.ErrConfigReverted) {
+			// BIRD still runs the orphans; keep their tunnels until the next sync
+			return
+		}
+	}
+
+	for _, link := range orphanLinks {
+		if err := s.wgExecutor.DeleteInterface(link); err != nil {
+			log.Printf("[SessionSync] Warning: failed to delete orphaned interface %s: %v", link, err)
+			continue
+		}
+		log.Printf("[SessionSync] Removed orphaned interface %s", link)
+	}
 
-	// Sync firewall ports
 	if s.fwExecutor != nil {
-		var expectedPorts []int
-		for _, session := range sessions {
-			if session.Port > 0 && (session.Status == StatusEnabled || session.Status == StatusQueuedForSetup) {
-				expectedPorts = append(expectedPorts, session.Port)
+		for _, port := range orphanPorts {
+			if err := s.fwExecutor.RemovePort(port); err != nil {
+				log.Printf("[SessionSync] Warning: failed to close orphaned port %d: %v", port, err)
 			}
 		}
-		if added, removed, err := s.fwExecutor.SyncPorts(expectedPorts); err != nil {
-			log.Printf("[SessionSync] Firewall sync error: %v", err)
-		} else if added > 0 || removed > 0 {
-			log.Printf("[SessionSync] Firewall synced: %d added, %d removed", added, removed)
+	}
+}
+
+// findOrphans returns the peer configs, links and ports not referenced by any
+// session known to CP. Besides the locally tracked sessions it scans the BIRD
+// peer directory and existing dn42* links, so orphans left from before an
+// agent restart are found too.
+func (s *SessionSync) findOrphans(remoteMap map[string]*BgpSession) (peers, links []string, ports []int) {
+	// Everything still referenced by a session known to CP must be kept
+	keepPeers := make(map[string]bool)
+	keepLinks := make(map[string]bool)
+	keepPorts := make(map[int]bool)
+	for _, session := range remoteMap {
+		keepPeers[sessionPeerName(session)] = true
+		if isLiveSession(session) {
+			// A legacy file not migrated yet may still run this session
+			keepPeers[legacyPeerName(session.ASN)] = true
+		}
+		if session.Interface != "" {
+			keepLinks[session.Interface] = true
+		}
+		if session.Port > 0 {
+			keepPorts[session.Port] = true
 		}
 	}
 
-	return nil
+	orphanPeers := make(map[string]bool)
+	orphanLinks := make(map[string]bool)
+	orphanPorts := make(map[int]bool)
+
+	// 1. Sessions we configured, in this run or (from the state file) before a restart
+	s.mu.RLock()
+	for uuid, localSession := range s.sessions {
+		if _, exists := remoteMap[uuid]; exists {
+			continue
+		}
+		if name := sessionPeerName(localSession); !keepPeers[name] {
+			orphanPeers[name] = true
+		}
+		if localSession.Interface != "" && !keepLinks[localSession.Interface] {
+			orphanLinks[localSession.Interface] = true
+		}
+		if localSession.Port > 0 && !keepPorts[localSession.Port] {
+			orphanPorts[localSession.Port] = true
+		}
+	}
+	s.mu.RUnlock()
+
+	// 2. Peer files left on disk
+	if names, err := s.birdConfig.ListSessions(); err != nil {
+		log.Printf("[SessionSync] Warning: failed to scan BIRD peer configs: %v", err)
+	} else {
+		for _, name := range names {
+			if !keepPeers[name] {
+				orphanPeers[name] = true
+			}
+		}
+	}
+
+	// 3. dn42* links left on the system (mesh tunnels are owned by MeshSync)
+	if names, err := s.wgExecutor.ListInterfaces("dn42"); err != nil {
+		log.Printf("[SessionSync] Warning: failed to scan interfaces: %v", err)
+	} else {
+		for _, link := range names {
+			if !strings.HasPrefix(link, meshInterfacePrefix) && !keepLinks[link] {
+				orphanLinks[link] = true
+			}
+		}
+	}
+
+	for name := range orphanPeers {
+		peers = append(peers, name)
+	}
+	for link := range orphanLinks {
+		links = append(links, link)
+	}
+	for port := range orphanPorts {
+		ports = append(ports, port)
+	}
+	sort.Strings(peers)
+	sort.Strings(links)
+	sort.Ints(ports)
+	return peers, links, ports
+}
+
+// pruneTracking forgets health, remediation and drain state of sessions that
+// are no longer enabled, in problem state or tearing down
+func (s *SessionSync) pruneTracking(remoteMap map[string]*BgpSession) {
+	s.healthMu.Lock()
+	for uuid := range s.health {
+		if session, ok := remoteMap[uuid]; !ok || session.Status != StatusEnabled {
+			delete(s.health, uuid)
+		}
+	}
+	s.healthMu.Unlock()
+
+	s.remediationMu.Lock()
+	for uuid := range s.remediation {
+		if session, ok := remoteMap[uuid]; !ok || session.Status != StatusProblem {
+			delete(s.remediation, uuid)
+		}
+	}
+	s.remediationMu.Unlock()
+
+	s.teardownMu.Lock()
+	for uuid := range s.teardown {
+		if session, ok := remoteMap[uuid]; !ok || session.Status != StatusTeardown {
+			delete(s.teardown, uuid)
+		}
+	}
+	s.teardownMu.Unlock()
+}
+
+// expectedPorts returns the firewall ports of all active sessions
+func expectedPorts(sessions []BgpSession) []int {
+	var ports []int
+	for _, session := range sessions {
+		if session.Port <= 0 {
+			continue
+		}
+		// Draining sessions still carry traffic until the protocol is
+		// disabled, and sessions in remediation need theirs to recover
+		switch session.Status {
+		case StatusEnabled, StatusQueuedForSetup, StatusProblem, StatusTeardown:
+			ports = append(ports, session.Port)
+		}
+	}
+	return ports
 }
 
 // fetchSessions retrieves sessions from Control Plane
@@ -178,6 +390,8 @@ func (s *SessionSync) processSession(ctx context.Context, session *BgpSession) e
 		return s.deleteSession(ctx, session)
 	case StatusProblem:
 		return s.handleProblemSession(ctx, session)
+	case StatusTeardown:
+		return s.teardownSession(ctx, session)
 	case StatusDisabled:
 		// Disabled sessions: ensure config is removed, don't report error
 		return s.cleanupDisabledSession(ctx, session)
@@ -190,73 +404,136 @@ func (s *SessionSync) processSession(ctx context.Context, session *BgpSession) e
 	}
 }
 
-// setupSession configures a new peering session
+// setupSession configures a new peering session. If any step fails, all
+// changes are rolled back and CP is told the session has a problem.
 func (s *SessionSync) setupSession(ctx context.Context, session *BgpSession) error {
-	log.Printf("[SessionSync] Setting up session AS%d (%s)", session.ASN, session.Name)
-
-	// 1. Create WireGuard interface
-	if session.Type == "wireguard" && session.Credential != "" {
-		// Parse credential JSON to extract WireGuard parameters
-		var cred struct {
-			PublicKey    string `json:"public_key"`
-			PresharedKey string `json:"preshared_key"`
-			ListenPort   *int   `json:"listen_port"`
-			Endpoint     string `json:"endpoint"`
-			MTU          int    `json:"mtu"`
-		}
-		peerKey := session.Credential // fallback: treat as raw key
-		if err := json.Unmarshal([]byte(session.Credential), &cred); err == nil && cred.PublicKey != "" {
-			peerKey = cred.PublicKey
-		}
-
-		// Determine listen port from credential
-		listenPort := 0
-		if cred.ListenPort != nil {
-			listenPort = *cred.ListenPort
+	log.Printf("[SessionSync] Setting up session AS%d (%s) on %s", session.ASN, session.Name, session.Interface)
+
+	// Reject bad CP data before touching anything
+	if session.Type == SessionTypeWireGuard {
+		if _, err := s.desiredWireGuard(session); err != nil {
+			session.Status = StatusProblem
+			if reportErr := s.reportStatus(ctx, session.UUID, StatusProblem, err.Error()); reportErr != nil {
+				log.Printf("[SessionSync] Warning: failed to report problem for AS%d: %v", session.ASN, reportErr)
+			}
+			return fmt.Errorf("setup failed: %w", err)
 		}
+	}
 
-		// Standard DN42 allowed IPs (matching existing working sessions)
-		allowedIPs := []string{"0.0.0.0/0", "fd00::/8", "fe80::/64"}
+	tx := s.setupTransaction(ctx, session)
+	tx.add("report", func() error {
+		return s.reportEnabled(ctx, session)
+	}, nil)
 
-		// Use endpoint from credential if session endpoint is empty
-		endpoint := session.Endpoint
-		if endpoint == "" && cred.Endpoint != "" {
-			endpoint = cred.Endpoint
+	if err := tx.run(); err != nil {
+		session.Status = StatusProblem
+		if reportErr := s.reportStatus(ctx, session.UUID, StatusProblem, err.Error()); reportErr != nil {
+			log.Printf("[SessionSync] Warning: failed to report problem for AS%d: %v", session.ASN, reportErr)
 		}
+		return fmt.Errorf("setup failed: %w", err)
+	}
 
-		if err := s.wgExecutor.CreateInterface(
-			session.Interface,
-			listenPort,        // Listen port from credential
-			peerKey,           // Peer public key extracted from credential
-			cred.PresharedKey, // Preshared key from credential
-			endpoint,
-			allowedIPs,
-			25, // Keepalive
-		); err != nil {
-			return fmt.Errorf("failed to create WireGuard interface: %w", err)
-		}
+	session.Status = StatusEnabled
+	log.Printf("[SessionSync] Session AS%d setup complete", session.ASN)
+	return nil
+}
 
-		// Set MTU
-		mtu := session.MTU
-		if mtu == 0 {
-			mtu = 1420
+// setupTransaction builds the steps that bring a session up. Every step
+// records the state it replaces, so its undo restores exactly that.
+func (s *SessionSync) setupTransaction(ctx context.Context, session *BgpSession) *transaction {
+	tx := &transaction{name: fmt.Sprintf("setup of AS%d", session.ASN)}
+	name := sessionPeerName(session)
+
+	// 1. Tunnel interface
+	var restoreTunnel func() error
+	tx.add("interface", func() error {
+		var err error
+		if restoreTunnel, err = s.snapshotTunnel(session); err != nil {
+			return err
 		}
-		if err := s.wgExecutor.SetMTU(session.Interface, mtu); err != nil {
-			log.Printf("[SessionSync] Warning: failed to set MTU: %v", err)
+		return s.createTunnel(session)
+	}, func() error {
+		if restoreTunnel == nil {
+			return nil
 		}
-
-		// Assign local link-local address for BGP neighbor communication
-		linkLocalAddr := deriveLLAFromLoopback(s.config.WireGuard.DN42IPv6)
-		if linkLocalAddr != "" {
-			if err := s.wgExecutor.AddAddress(session.Interface, linkLocalAddr); err != nil {
-				log.Printf("[SessionSync] Warning: failed to add link-local address to %s: %v", session.Interface, err)
+		return restoreTunnel()
+	})
+
+	// 2. Link-local addresses (only the ones added here are removed)
+	var added []string
+	tx.add("addresses", func() error {
+		for _, addr := range s.tunnelAddresses() {
+			if linkHasAddress(session.Interface, addr) {
+				continue
+			}
+			if err := s.addTunnelAddress(session, addr); err != nil {
+				return err
+			}
+			added = append(added, addr)
+		}
+		return nil
+	}, func() error {
+		for _, addr := range added {
+			if err := s.delTunnelAddress(session, addr); err != nil {
+				return err
 			}
 		}
+		return nil
+	})
+
+	// 3. BIRD peer config
+	var previous []byte
+	reconfigured := false
+	tx.add("bird-config", func() error {
+		content, err := s.birdConfig.LoadSession(name)
+		if err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to back up BIRD config: %w", err)
+		}
+		previous = content
+		if err := s.birdConfig.GenerateSession(s.birdSessionConfig(session)); err != nil {
+			return fmt.Errorf("failed to generate BIRD config: %w", err)
+		}
+		return nil
+	}, func() error {
+		if err := s.birdConfig.RestoreSession(name, previous); err != nil {
+			return err
+		}
+		if reconfigured {
+			return s.birdPool.Reconfigure(ctx)
+		}
+		return nil
+	})
+
+	// 4. Firewall port
+	if s.fwExecutor != nil && session.Port > 0 {
+		wasOpen := false
+		tx.add("firewall", func() error {
+			wasOpen = s.fwExecutor.HasPort(session.Port)
+			return s.fwExecutor.AllowPort(session.Port)
+		}, func() error {
+			if wasOpen {
+				return nil
+			}
+			return s.fwExecutor.RemovePort(session.Port)
+		})
 	}
 
-	// 2. Generate BIRD configuration
+	// 5. Reload BIRD (undone by the bird-config step)
+	tx.add("bird-reconfigure", func() error {
+		if err := s.birdPool.Reconfigure(ctx); err != nil {
+			return err
+		}
+		reconfigured = true
+		return nil
+	}, nil)
+
+	return tx
+}
+
+// birdSessionConfig builds the BIRD peer config of a session
+func (s *SessionSync) birdSessionConfig(session *BgpSession) *bird.SessionConfig {
 	cfg := &bird.SessionConfig{
-		Name:          fmt.Sprintf("dn42_%d", session.ASN),
+		Name:          sessionPeerName(session),
 		Description:   session.Name,
 		Interface:     session.Interface,
 		ASN:           session.ASN,
@@ -266,57 +543,327 @@ func (s *SessionSync) setupSession(ctx context.Context, session *BgpSession) err
 		Extensions:    session.Extensions,
 		Policy:        session.Policy,
 	}
+	applyTransportOptions(cfg, session)
+	return cfg
+}
 
-	if err := s.birdConfig.GenerateSession(cfg); err != nil {
-		return fmt.Errorf("failed to generate BIRD config: %w", err)
+// applyTransportOptions sets the password, TTL security and multihop options
+// of a session. Fields of the session payload take precedence over the same
+// options in the Credential JSON.
+func applyTransportOptions(cfg *bird.SessionConfig, session *BgpSession) {
+	var cred struct {
+		Password       string `json:"password"`
+		Authentication string `json:"authentication"`
+		TTLSecurity    bool   `json:"ttl_security"`
+		Multihop       int    `json:"multihop"`
+		SourceAddress  string `json:"source_address"`
+	}
+	if session.Credential != "" {
+		_ = json.Unmarshal([]byte(session.Credential), &cred) // Raw keys are not JSON
+	}
+
+	cfg.Password = firstNonEmpty(session.Password, cred.Password)
+	cfg.Authentication = firstNonEmpty(session.Authentication, cred.Authentication)
+	cfg.TTLSecurity = session.TTLSecurity || cred.TTLSecurity
+	cfg.Multihop = session.Multihop
+	if cfg.Multihop == 0 {
+		cfg.Multihop = cred.Multihop
+	}
+	cfg.SourceAddress = firstNonEmpty(session.SourceAddress, cred.SourceAddress)
+}
+
+// firstNonEmpty returns the first non-empty string
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
 	}
+	return ""
+}
 
-	// 3. Reload BIRD
-	if err := s.birdPool.Configure(); err != nil {
-		log.Printf("[SessionSync] Warning: BIRD reconfigure failed: %v", err)
+// applyTunnel creates or updates the tunnel interface of a session,
+// including its link-local addresses
+func (s *SessionSync) applyTunnel(session *BgpSession) error {
+	if err := s.createTunnel(session); err != nil {
+		return err
 	}
 
-	// 4. Report success to CP
-	if err := s.reportStatus(ctx, session.UUID, StatusEnabled, ""); err != nil {
-		return fmt.Errorf("failed to report status: %w", err)
+	// Assign local link-local address for BGP neighbor communication
+	for _, addr := range s.tunnelAddresses() {
+		if err := s.addTunnelAddress(session, addr); err != nil {
+			log.Printf("[SessionSync] Warning: failed to add link-local address to %s: %v", session.Interface, err)
+		}
+	}
+	return nil
+}
+
+// createTunnel creates or updates the tunnel interface of a session
+func (s *SessionSync) createTunnel(session *BgpSession) error {
+	switch session.Type {
+	case SessionTypeWireGuard:
+		return s.applyWireGuard(session)
+	case SessionTypeGRE, SessionTypeIP6GRE:
+		return s.applyGRE(session)
+	default:
+		return fmt.Errorf("unsupported session type %q", session.Type)
+	}
+}
+
+// snapshotTunnel captures the current tunnel interface of a session and
+// returns a function restoring it: deleting the interface if it did not exist,
+// or resetting its previous configuration
+func (s *SessionSync) snapshotTunnel(session *BgpSession) (func() error, error) {
+	if session.Interface == "" {
+		return nil, nil
+	}
+
+	switch session.Type {
+	case SessionTypeWireGuard:
+		if !s.wgExecutor.InterfaceExists(session.Interface) {
+			return func() error { return s.wgExecutor.DeleteInterface(session.Interface) }, nil
+		}
+		state, err := s.wgExecutor.GetInterfaceState(session.Interface)
+		if err != nil {
+			return nil, fmt.Errorf("failed to snapshot %s: %w", session.Interface, err)
+		}
+		return func() error { return s.wgExecutor.Restore(session.Interface, state) }, nil
+	case SessionTypeGRE, SessionTypeIP6GRE:
+		if !s.tnExecutor.TunnelExists(session.Interface) {
+			return func() error { return s.tnExecutor.DeleteTunnel(session.Interface) }, nil
+		}
+		state, err := s.tnExecutor.GetTunnel(session.Interface)
+		if err != nil {
+			return nil, fmt.Errorf("failed to snapshot %s: %w", session.Interface, err)
+		}
+		return func() error {
+			if err := s.tnExecutor.CreateTunnel(session.Interface, state.Mode, state.Local, state.Remote); err != nil {
+				return err
+			}
+			if state.MTU > 0 {
+				return s.tnExecutor.SetMTU(session.Interface, state.MTU)
+			}
+			return nil
+		}, nil
+	default:
+		return nil, nil
+	}
+}
+
+// tunnelAddresses returns the local addresses assigned to session tunnels
+func (s *SessionSync) tunnelAddresses() []string {
+	if linkLocalAddr := deriveLLAFromLoopback(s.config.WireGuard.DN42IPv6); linkLocalAddr != "" {
+		return []string{linkLocalAddr}
+	}
+	return nil
+}
+
+// addTunnelAddress adds an address to the tunnel interface of a session
+func (s *SessionSync) addTunnelAddress(session *BgpSession, addr string) error {
+	if session.Type == SessionTypeWireGuard {
+		return s.wgExecutor.AddAddress(session.Interface, addr)
+	}
+	return s.tnExecutor.AddAddress(session.Interface, addr)
+}
+
+// delTunnelAddress removes an address from the tunnel interface of a session
+func (s *SessionSync) delTunnelAddress(session *BgpSession, addr string) error {
+	if session.Type == SessionTypeWireGuard {
+		return s.wgExecutor.DelAddress(session.Interface, addr)
+	}
+	return s.tnExecutor.DelAddress(session.Interface, addr)
+}
+
+// linkHasAddress reports whether an interface already carries addr (CIDR notation)
+func linkHasAddress(name, addr string) bool {
+	want, _, err := net.ParseCIDR(addr)
+	if err != nil {
+		return false
+	}
+	iface, err := net.InterfaceByName(name)
+	if err != nil {
+		return false
+	}
+	addrs, err := iface.Addrs()
+	if err != nil {
+		return false
+	}
+	for _, a := range addrs {
+		if ipNet, ok := a.(*net.IPNet); ok && ipNet.IP.Equal(want) {
+			return true
+		}
+	}
+	return false
+}
+
+// deleteTunnel removes the tunnel interface of a session
+func (s *SessionSync) deleteTunnel(session *BgpSession) error {
+	if session.Interface == "" {
+		return nil
+	}
+	switch session.Type {
+	case SessionTypeWireGuard:
+		return s.wgExecutor.DeleteInterface(session.Interface)
+	case SessionTypeGRE, SessionTypeIP6GRE:
+		return s.tnExecutor.DeleteTunnel(session.Interface)
+	default:
+		return nil
+	}
+}
+
+// applyGRE creates or updates the GRE/ip6gre tunnel of a session
+func (s *SessionSync) applyGRE(session *BgpSession) error {
+	if session.Interface == "" {
+		return fmt.Errorf("%s session has no interface name", session.Type)
+	}
+
+	remote, err := tunnel.ResolveRemote(context.Background(), session.Endpoint, session.Type)
+	if err != nil {
+		return fmt.Errorf("invalid tunnel endpoint: %w", err)
+	}
+
+	// Prefer the configured public address, fall back to the kernel's choice
+	local := s.config.Node.PublicIPv4
+	mtu := tunnel.DefaultMTUGRE
+	if session.Type == SessionTypeIP6GRE {
+		local = s.config.Node.PublicIPv6
+		mtu = tunnel.DefaultMTUIP6GRE
+	}
+	if local == "" {
+		if local, err = tunnel.LocalAddress(remote); err != nil {
+			return fmt.Errorf("failed to determine local tunnel address: %w", err)
+		}
+	}
+
+	if err := s.tnExecutor.CreateTunnel(session.Interface, session.Type, local, remote); err != nil {
+		return fmt.Errorf("failed to create %s tunnel: %w", session.Type, err)
+	}
+
+	if session.MTU > 0 {
+		mtu = session.MTU
+	}
+	if err := s.tnExecutor.SetMTU(session.Interface, mtu); err != nil {
+		log.Printf("[SessionSync] Warning: failed to set MTU: %v", err)
 	}
 
-	log.Printf("[SessionSync] Session AS%d setup complete", session.ASN)
 	return nil
 }
 
-// verifySession checks if an existing session is working
-//
-//nolint:unparam // ctx and session reserved for future implementation
-func (s *SessionSync) verifySession(_ context.Context, _ *BgpSession) error {
-	// TODO: Check WireGuard handshake
-	// TODO: Check BIRD protocol state
+// applyWireGuard creates or updates the WireGuard interface of a session
+func (s *SessionSync) applyWireGuard(session *BgpSession) error {
+	desired, err := s.desiredWireGuard(session)
+	if err != nil {
+		return err
+	}
+	if desired == nil {
+		return nil
+	}
+
+	if err := s.wgExecutor.CreateInterface(
+		session.Interface,
+		desired.ListenPort,
+		desired.Peer.PublicKey,
+		desired.Peer.PresharedKey,
+		desired.Peer.Endpoint,
+		desired.Peer.AllowedIPs,
+		desired.Peer.Keepalive,
+	); err != nil {
+		return fmt.Errorf("failed to create WireGuard interface: %w", err)
+	}
+
+	if err := s.wgExecutor.SetMTU(session.Interface, desired.MTU); err != nil {
+		log.Printf("[SessionSync] Warning: failed to set MTU: %v", err)
+	}
+
 	return nil
 }
 
+// desiredWireGuard builds the desired WireGuard state of a session from its
+// CP data. It returns nil if the session carries no credential, and an error
+// if the credential, endpoint or MTU is invalid.
+func (s *SessionSync) desiredWireGuard(session *BgpSession) (*wireguard.InterfaceConfig, error) {
+	if session.Credential == "" {
+		return nil, nil
+	}
+
+	cred, err := ParseWireGuardCredential(session.Credential)
+	if err != nil {
+		return nil, fmt.Errorf("invalid WireGuard credential: %w", err)
+	}
+
+	// Determine listen port from credential
+	listenPort := 0
+	if cred.ListenPort != nil {
+		listenPort = *cred.ListenPort
+	}
+
+	// Use endpoint from credential if session endpoint is empty
+	endpoint := session.Endpoint
+	if endpoint != "" {
+		if err := validateEndpoint(endpoint); err != nil {
+			return nil, fmt.Errorf("invalid endpoint: %w", err)
+		}
+	} else {
+		endpoint = cred.Endpoint
+	}
+	if !wireguard.ValidFamily(session.EndpointFamily) {
+		return nil, fmt.Errorf("invalid endpoint family %q", session.EndpointFamily)
+	}
+
+	mtu := session.MTU
+	if mtu == 0 {
+		mtu = cred.MTU
+	}
+	if mtu == 0 {
+		mtu = defaultMTU
+	}
+	if err := validateMTU(mtu); err != nil {
+		return nil, fmt.Errorf("invalid MTU: %w", err)
+	}
+
+	// Standard DN42 allowed IPs (matching existing working sessions)
+	allowedIPs := defaultAllowedIPs
+	if len(cred.AllowedIPs) > 0 {
+		allowedIPs = cred.AllowedIPs
+	}
+	keepalive := defaultKeepalive
+	if cred.Keepalive != nil {
+		keepalive = *cred.Keepalive
+	}
+
+	return &wireguard.InterfaceConfig{
+		ListenPort: listenPort,
+		MTU:        mtu,
+		Addresses:  s.tunnelAddresses(),
+		Peer: wireguard.PeerConfig{
+			PublicKey:    cred.PublicKey,
+			PresharedKey: cred.PresharedKey,
+			Endpoint:     endpoint,
+			AllowedIPs:   allowedIPs,
+			Keepalive:    keepalive,
+		},
+		EndpointFamily: session.EndpointFamily,
+	}, nil
+}
+
 // deleteSession removes a peering session
 func (s *SessionSync) deleteSession(ctx context.Context, session *BgpSession) error {
 	log.Printf("[SessionSync] Deleting session AS%d (%s)", session.ASN, session.Name)
 
-	// 1. Remove BIRD configuration
-	peerName := fmt.Sprintf("dn42_%d", session.ASN)
-	if err := s.birdConfig.RemoveSession(peerName); err != nil {
-		log.Printf("[SessionSync] Warning: failed to remove BIRD config: %v", err)
-	}
-
-	// 2. Reload BIRD
-	if err := s.birdPool.Configure(); err != nil {
+	// 1. Remove BIRD configuration and reload BIRD
+	if err := s.removeSessionConfigs(ctx, []string{sessionPeerName(session)}); err != nil {
+		if errors.Is(err, bird.ErrConfigReverted) {
+			return fmt.Errorf("BIRD reconfigure reverted, session kept: %w", err)
+		}
 		log.Printf("[SessionSync] Warning: BIRD reconfigure failed: %v", err)
 	}
 
-	// 3. Remove WireGuard interface
-	if session.Type == "wireguard" && session.Interface != "" {
-		if err := s.wgExecutor.DeleteInterface(session.Interface); err != nil {
-			log.Printf("[SessionSync] Warning: failed to delete WireGuard interface: %v", err)
-		}
+	// 2. Remove tunnel interface
+	if err := s.deleteTunnel(session); err != nil {
+		log.Printf("[SessionSync] Warning: failed to delete tunnel interface: %v", err)
 	}
 
-	// 4. Report deletion to CP
+	// 3. Report deletion to CP
 	if err := s.reportStatus(ctx, session.UUID, StatusDeleted, ""); err != nil {
 		return fmt.Errorf("failed to report status: %w", err)
 	}
@@ -325,36 +872,57 @@ func (s *SessionSync) deleteSession(ctx context.Context, session *BgpSession) er
 	return nil
 }
 
-// handleProblemSession attempts to fix a problematic session
-//
-//nolint:unparam // ctx reserved for future implementation
-func (s *SessionSync) handleProblemSession(_ context.Context, session *BgpSession) error {
-	log.Printf("[SessionSync] Handling problem session AS%d", session.ASN)
-	// TODO: Attempt to reconfigure
-	return nil
+// removeSessionConfigs removes BIRD peer configs and reloads BIRD once. If
+// safe-apply reverts the reconfigure, the configs are put back so the files
+// match the config BIRD runs again; the error then wraps ErrConfigReverted.
+func (s *SessionSync) removeSessionConfigs(ctx context.Context, names []string) error {
+	backups := make(map[string][]byte, len(names))
+	for _, name := range names {
+		content, err := s.birdConfig.LoadSession(name)
+		if err != nil && !os.IsNotExist(err) {
+			log.Printf("[SessionSync] Warning: failed to back up BIRD config %s: %v", name, err)
+			continue
+		}
+		if err := s.birdConfig.RemoveSession(name); err != nil {
+			log.Printf("[SessionSync] Warning: failed to remove BIRD config %s: %v", name, err)
+			continue
+		}
+		if content != nil {
+			log.Printf("[SessionSync] Removed BIRD config %s", name)
+		}
+		backups[name] = content
+	}
+	if len(backups) == 0 {
+		return nil
+	}
+
+	err := s.birdPool.Reconfigure(ctx)
+	if errors.Is(err, bird.ErrConfigReverted) {
+		for name, content := range backups {
+			if restoreErr := s.birdConfig.RestoreSession(name, content); restoreErr != nil {
+				log.Printf("[SessionSync] Warning: failed to restore BIRD config %s: %v", name, restoreErr)
+			}
+		}
+	}
+	return err
 }
 
 // cleanupDisabledSession removes config for a disabled session
 // Unlike deleteSession, it doesn't report back to CP (session stays disabled in DB)
-func (s *SessionSync) cleanupDisabledSession(_ context.Context, session *BgpSession) error {
+func (s *SessionSync) cleanupDisabledSession(ctx context.Context, session *BgpSession) error {
 	log.Printf("[SessionSync] Cleaning up disabled session AS%d", session.ASN)
 
-	// 1. Remove BIRD configuration
-	peerName := fmt.Sprintf("dn42_%d", session.ASN)
-	if err := s.birdConfig.RemoveSession(peerName); err != nil {
-		log.Printf("[SessionSync] Warning: failed to remove BIRD config for disabled session: %v", err)
-	}
-
-	// 2. Reload BIRD
-	if err := s.birdPool.Configure(); err != nil {
+	// 1. Remove BIRD configuration and reload BIRD
+	if err := s.removeSessionConfigs(ctx, []string{sessionPeerName(session)}); err != nil {
+		if errors.Is(err, bird.ErrConfigReverted) {
+			return fmt.Errorf("BIRD reconfigure reverted, session kept: %w", err)
+		}
 		log.Printf("[SessionSync] Warning: BIRD reconfigure failed: %v", err)
 	}
 
-	// 3. Remove WireGuard interface if exists
-	if session.Type == "wireguard" && session.Interface != "" {
-		if err := s.wgExecutor.DeleteInterface(session.Interface); err != nil {
-			log.Printf("[SessionSync] Warning: failed to delete WireGuard interface: %v", err)
-		}
+	// 2. Remove tunnel interface if exists
+	if err := s.deleteTunnel(session); err != nil {
+		log.Printf("[SessionSync] Warning: failed to delete tunnel interface: %v", err)
 	}
 
 	// Note: Don't report to CP - session remains disabled until admin action
@@ -363,8 +931,6 @@ func (s *SessionSync) cleanupDisabledSession(_ context.Context, session *BgpSess
 
 // reportStatus reports session status change to Control Plane
 func (s *SessionSync) reportStatus(ctx context.Context, sessionUUID string, status int, lastError string) error {
-	url := fmt.Sprintf("%s/api/v1/agent/%s/modify", s.config.ControlPlane.URL, s.config.Node.Name)
-
 	payload := map[string]interface{}{
 		"uuid":   sessionUUID,
 		"status": status,
@@ -372,6 +938,22 @@ func (s *SessionSync) reportStatus(ctx context.Context, sessionUUID string, stat
 	if lastError != "" {
 		payload["lastError"] = lastError
 	}
+	return s.postModify(ctx, payload)
+}
+
+// reportEnabled reports a session that was set up, along with the interface
+// it uses, so CP learns names the agent generated
+func (s *SessionSync) reportEnabled(ctx context.Context, session *BgpSession) error {
+	return s.postModify(ctx, map[string]interface{}{
+		"uuid":      session.UUID,
+		"status":    StatusEnabled,
+		"interface": session.Interface,
+	})
+}
+
+// postModify sends a session update to the CP modify endpoint
+func (s *SessionSync) postModify(ctx context.Context, payload map[string]interface{}) error {
+	url := fmt.Sprintf("%s/api/v1/agent/%s/modify", s.config.ControlPlane.URL, s.config.Node.Name)
 
 	body, err := json.Marshal(payload)
 	if err != nil {
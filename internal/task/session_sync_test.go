@@ -0,0 +1,68 @@
+package task
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/moenet/moenet-agent/internal/bird"
+)
+
+func TestApplyTransportOptions(t *testing.T) {
+	tests := []struct {
+		name     string
+		session  BgpSession
+		expected bird.SessionConfig
+	}{
+		{
+			name:     "raw key credential",
+			session:  BgpSession{Credential: "abc123="},
+			expected: bird.SessionConfig{},
+		},
+		{
+			name: "from credential JSON",
+			session: BgpSession{
+				Credential: `{"public_key":"k","password":"p","ttl_security":true,"multihop":2,"source_address":"fd00::1"}`,
+			},
+			expected: bird.SessionConfig{Password: "p", TTLSecurity: true, Multihop: 2, SourceAddress: "fd00::1"},
+		},
+		{
+			name: "payload overrides credential",
+			session: BgpSession{
+				Credential:     `{"password":"p","authentication":"md5","multihop":2}`,
+				Password:       "q",
+				Authentication: "ao",
+				Multihop:       3,
+			},
+			expected: bird.SessionConfig{Password: "q", Authentication: "ao", Multihop: 3},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var cfg bird.SessionConfig
+			applyTransportOptions(&cfg, &tt.session)
+			if cfg.Password != tt.expected.Password || cfg.Authentication != tt.expected.Authentication ||
+				cfg.TTLSecurity != tt.expected.TTLSecurity || cfg.Multihop != tt.expected.Multihop ||
+				cfg.SourceAddress != tt.expected.SourceAddress {
+				t.Errorf("Expected %+v, got %+v", tt.expected, cfg)
+			}
+		})
+	}
+}
+
+func TestExpectedPorts(t *testing.T) {
+	sessions := []BgpSession{
+		{Port: 24001, Status: StatusEnabled},
+		{Port: 24002, Status: StatusQueuedForSetup},
+		{Port: 24003, Status: StatusProblem},
+		{Port: 24004, Status: StatusTeardown},
+		{Port: 24005, Status: StatusDisabled},
+		{Port: 24006, Status: StatusQueuedForDelete},
+		{Port: 0, Status: StatusEnabled},
+	}
+
+	expected := []int{24001, 24002, 24003, 24004}
+	if got := expectedPorts(sessions); !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected %v, got %v", expected, got)
+	}
+}
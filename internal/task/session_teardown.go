@@ -0,0 +1,171 @@
+package task
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// teardownMinDrain is how long GRACEFUL_SHUTDOWN is announced at least, so
+// the peer has time to move its traffic away before a low rate ends the drain
+const teardownMinDrain = time.Minute
+
+// teardownState tracks the drain of a StatusTeardown session
+type teardownState struct {
+	started   time.Time
+	lastCheck time.Time
+	lastBytes uint64
+	rate      float64 // Bytes per second at the last check, -1 if unknown
+}
+
+// Drain outcomes of a StatusTeardown session
+type drainResult int
+
+const (
+	drainPending drainResult = iota // Traffic still flowing, deadline not reached
+	drainDone                       // Traffic fell below the threshold
+	drainExpired                    // Deadline reached with traffic still flowing
+)
+
+// drainStatus decides whether a drain is over. It ends early once the
+// measured rate falls below the threshold, but not before teardownMinDrain
+// (or the whole drain period, if shorter). At the deadline it ends anyway;
+// drainExpired tells that the traffic never dropped.
+func drainStatus(elapsed, drain time.Duration, rate, threshold float64) drainResult {
+	minDrain := min(teardownMinDrain, drain)
+	quiet := rate >= 0 && rate < threshold
+	switch {
+	case quiet && elapsed >= minDrain:
+		return drainDone
+	case elapsed < drain:
+		return drainPending
+	case rate < 0:
+		return drainDone // No interface left to carry traffic
+	default:
+		return drainExpired
+	}
+}
+
+// teardownSession gracefully shuts a session down before it is deleted.
+// The first sync re-announces all routes with GRACEFUL_SHUTDOWN so the peer
+// moves its traffic away. Later syncs measure the traffic on the interface:
+// once it falls below teardownDrainThreshold, or the drain period is over,
+// the protocol is disabled and CP is told the session can be queued for
+// deletion. A drain that ends at the deadline is reported with the rate left.
+func (s *SessionSync) teardownSession(ctx context.Context, session *BgpSession) error {
+	s.teardownMu.Lock()
+	state := s.teardown[session.UUID]
+	s.teardownMu.Unlock()
+
+	if state == nil {
+		return s.startTeardown(ctx, session)
+	}
+
+	drain := time.Duration(s.config.Session.TeardownDrainPeriod) * time.Second
+	elapsed := time.Since(state.started)
+
+	rate := float64(-1)
+	bytes, err := interfaceBytes(session.Interface)
+	if err == nil {
+		rate = 0
+		if interval := time.Since(state.lastCheck).Seconds(); interval > 0 && bytes >= state.lastBytes {
+			rate = float64(bytes-state.lastBytes) / interval
+		}
+		log.Printf("[SessionSync] Draining AS%d: %s of %s, %.0f B/s on %s",
+			session.ASN, elapsed.Round(time.Second), drain, rate, session.Interface)
+	}
+	s.teardownMu.Lock()
+	state.rate = rate
+	if err == nil {
+		state.lastCheck = time.Now()
+		state.lastBytes = bytes
+	}
+	s.teardownMu.Unlock()
+
+	result := drainStatus(elapsed, drain, rate, float64(s.config.Session.TeardownDrainThreshold))
+	if result == drainPending {
+		return nil
+	}
+
+	protocols := s.sessionProtocols(session)
+	if err := s.protocolsCommand("disable", protocols); err != nil {
+		return fmt.Errorf("failed to disable %s: %w", strings.Join(protocols, ", "), err)
+	}
+
+	message := ""
+	if result == drainExpired {
+		message = fmt.Sprintf("drain period of %s over with %.0f B/s still on %s", drain, rate, session.Interface)
+		log.Printf("[SessionSync] Warning: session AS%d did not drain: %s, protocol %s disabled",
+			session.ASN, message, strings.Join(protocols, ", "))
+	} else {
+		log.Printf("[SessionSync] Session AS%d drained after %s, protocol %s disabled",
+			session.ASN, elapsed.Round(time.Second), strings.Join(protocols, ", "))
+	}
+
+	if err := s.reportStatus(ctx, session.UUID, StatusQueuedForDelete, message); err != nil {
+		return fmt.Errorf("failed to report status: %w", err)
+	}
+
+	s.teardownMu.Lock()
+	delete(s.teardown, session.UUID)
+	s.teardownMu.Unlock()
+	return nil
+}
+
+// startTeardown rewrites the peer config with GRACEFUL_SHUTDOWN exports and
+// reloads BIRD. The drain period starts once BIRD has the new config.
+func (s *SessionSync) startTeardown(ctx context.Context, session *BgpSession) error {
+	name := sessionPeerName(session)
+	backup, err := s.birdConfig.LoadSession(name)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to read BIRD config: %w", err)
+	}
+
+	cfg := s.birdSessionConfig(session)
+	cfg.Teardown = true
+	if err := s.birdConfig.GenerateSession(cfg); err != nil {
+		return fmt.Errorf("failed to generate BIRD config: %w", err)
+	}
+	if err := s.birdPool.Reconfigure(ctx); err != nil {
+		if restoreErr := s.birdConfig.RestoreSession(name, backup); restoreErr != nil {
+			log.Printf("[SessionSync] Warning: failed to restore BIRD config %s: %v", name, restoreErr)
+		}
+		return fmt.Errorf("BIRD reconfigure failed: %w", err)
+	}
+
+	state := &teardownState{started: time.Now(), lastCheck: time.Now(), rate: -1}
+	state.lastBytes, _ = interfaceBytes(session.Interface)
+
+	s.teardownMu.Lock()
+	s.teardown[session.UUID] = state
+	s.teardownMu.Unlock()
+
+	log.Printf("[SessionSync] Tearing down session AS%d: announcing GRACEFUL_SHUTDOWN for %ds",
+		session.ASN, s.config.Session.TeardownDrainPeriod)
+	return nil
+}
+
+// interfaceBytes returns the received plus transmitted bytes of an interface
+func interfaceBytes(name string) (uint64, error) {
+	if name == "" {
+		return 0, fmt.Errorf("no interface")
+	}
+	var total uint64
+	for _, counter := range []string{"rx_bytes", "tx_bytes"} {
+		data, err := os.ReadFile(filepath.Join("/sys/class/net", name, "statistics", counter))
+		if err != nil {
+			return 0, err
+		}
+		n, err := strconv.ParseUint(strings.TrimSpace(string(data)), 10, 64)
+		if err != nil {
+			return 0, err
+		}
+		total += n
+	}
+	return total, nil
+}
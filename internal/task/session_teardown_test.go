@@ -0,0 +1,74 @@
+package task
+
+import (
+	"testing"
+	"time"
+
+	"github.com/moenet/moenet-agent/internal/bird"
+	"github.com/moenet/moenet-agent/internal/config"
+	"github.com/moenet/moenet-agent/internal/plan"
+)
+
+func TestDrainStatus(t *testing.T) {
+	drain := 5 * time.Minute
+
+	tests := []struct {
+		name     string
+		elapsed  time.Duration
+		drain    time.Duration
+		rate     float64
+		expected drainResult
+	}{
+		{"traffic flowing", 2 * time.Minute, drain, 50000, drainPending},
+		{"quiet before minimum", 30 * time.Second, drain, 100, drainPending},
+		{"quiet ends early", 2 * time.Minute, drain, 100, drainDone},
+		{"rate unknown", 2 * time.Minute, drain, -1, drainPending},
+		{"quiet at deadline", drain, drain, 100, drainDone},
+		{"never dropped", drain, drain, 50000, drainExpired},
+		{"interface gone at deadline", drain, drain, -1, drainDone},
+		{"short drain period", 30 * time.Second, 20 * time.Second, 100, drainDone},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := drainStatus(tt.elapsed, tt.drain, tt.rate, 1024); got != tt.expected {
+				t.Errorf("Expected %d, got %d", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestPlanTeardown(t *testing.T) {
+	g, err := bird.NewConfigGenerator(t.TempDir(), testRenderer(t))
+	if err != nil {
+		t.Fatalf("Failed to create generator: %v", err)
+	}
+	cfg := &config.Config{Session: config.SessionConfig{TeardownDrainPeriod: 300, TeardownDrainThreshold: 1024}}
+	session := &BgpSession{UUID: "1a2b3c4d-0000", ASN: 4242420919, Status: StatusTeardown}
+
+	tests := []struct {
+		name    string
+		state   teardownState
+		actions int
+		detail  string
+	}{
+		{"draining", teardownState{started: time.Now().Add(-2 * time.Minute), rate: 50000}, 0, ""},
+		{"drained early", teardownState{started: time.Now().Add(-2 * time.Minute), rate: 100}, 2, "drained"},
+		{"never dropped", teardownState{started: time.Now().Add(-6 * time.Minute), rate: 50000}, 2, "drain period over, 50000 B/s left"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &SessionSync{config: cfg, birdConfig: g, teardown: map[string]*teardownState{session.UUID: &tt.state}}
+			var p plan.Plan
+			s.planTeardown(&p, session)
+
+			if len(p.Actions) != tt.actions {
+				t.Fatalf("Expected %d actions, got %+v", tt.actions, p.Actions)
+			}
+			if tt.actions > 0 && (p.Actions[0].Kind != plan.KindDisableProtocol || p.Actions[0].Detail != tt.detail) {
+				t.Errorf("Expected protocol disabled with %q, got %+v", tt.detail, p.Actions[0])
+			}
+		})
+	}
+}
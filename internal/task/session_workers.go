@@ -0,0 +1,87 @@
+package task
+
+import (
+	"context"
+	"log"
+	"sync"
+)
+
+// processSessions runs processSession for all sessions on a bounded number
+// of workers (Session.SyncConcurrency). Each session is handled by a single
+// worker while holding its lock, so its operations stay serialized.
+func (s *SessionSync) processSessions(ctx context.Context, sessions []*BgpSession) {
+	workers := s.config.Session.SyncConcurrency
+	if workers < 1 {
+		workers = 1
+	}
+	if workers > len(sessions) {
+		workers = len(sessions)
+	}
+
+	work := make(chan *BgpSession)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for session := range work {
+				unlock := s.sessionLocks.lock(session.UUID)
+				if err := s.processSession(ctx, session); err != nil {
+					log.Printf("[SessionSync] Failed to process session %s (AS%d): %v",
+						session.UUID, session.ASN, err)
+				}
+				unlock()
+			}
+		}()
+	}
+
+feed:
+	for _, session := range sessions {
+		select {
+		case work <- session:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(work)
+	wg.Wait()
+}
+
+// keyLocks hands out one mutex per key. Unused mutexes are dropped, so the
+// map does not grow with every session ever seen.
+type keyLocks struct {
+	mu    sync.Mutex
+	locks map[string]*keyLock
+}
+
+// keyLock is a mutex with the number of holders and waiters
+type keyLock struct {
+	sync.Mutex
+	refs int
+}
+
+// lock locks the mutex of key and returns the function that unlocks it
+func (k *keyLocks) lock(key string) func() {
+	k.mu.Lock()
+	if k.locks == nil {
+		k.locks = make(map[string]*keyLock)
+	}
+	l := k.locks[key]
+	if l == nil {
+		l = &keyLock{}
+		k.locks[key] = l
+	}
+	l.refs++
+	k.mu.Unlock()
+
+	l.Lock()
+	return func() {
+		l.Unlock()
+		k.mu.Lock()
+		l.refs--
+		if l.refs == 0 {
+			delete(k.locks, key)
+		}
+		k.mu.Unlock()
+	}
+}
@@ -0,0 +1,52 @@
+package task
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/moenet/moenet-agent/internal/config"
+)
+
+func TestKeyLocks(t *testing.T) {
+	var locks keyLocks
+	var inside atomic.Int32
+	var wg sync.WaitGroup
+
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			unlock := locks.lock("a1b2c3d4")
+			if inside.Add(1) > 1 {
+				t.Error("Expected operations on one key to be serialized")
+			}
+			inside.Add(-1)
+			unlock()
+		}()
+	}
+	wg.Wait()
+
+	if len(locks.locks) != 0 {
+		t.Errorf("Expected unused locks to be dropped, got %d", len(locks.locks))
+	}
+}
+
+func TestProcessSessionsCanceled(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Session.SyncConcurrency = 4
+	s := &SessionSync{config: cfg}
+
+	sessions := make([]*BgpSession, 10)
+	for i := range sessions {
+		sessions[i] = &BgpSession{UUID: string(rune('a' + i)), Status: StatusPendingApproval}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	// Must return without blocking
+	s.processSessions(ctx, sessions)
+	s.processSessions(context.Background(), sessions)
+	s.processSessions(context.Background(), nil)
+}
@@ -0,0 +1,178 @@
+package task
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// AgentState is the desired state the agent last applied. It is persisted so
+// that a restarted agent knows what it created before the CP answers.
+type AgentState struct {
+	UpdatedAt      time.Time    `json:"updatedAt"`
+	Sessions       []BgpSession `json:"sessions"`
+	MeshPeers      []MeshPeer   `json:"meshPeers"`
+	IBGPPeers      []MeshPeer   `json:"ibgpPeers"`
+	BirdConfigHash string       `json:"birdConfigHash"`
+}
+
+// Redacted returns a copy of the state without session credentials and
+// passwords, which may carry preshared keys
+func (s AgentState) Redacted() AgentState {
+	sessions := make([]BgpSession, len(s.Sessions))
+	copy(sessions, s.Sessions)
+	for i := range sessions {
+		sessions[i].Credential = ""
+		sessions[i].Password = ""
+	}
+	s.Sessions = sessions
+	return s
+}
+
+// StateStore keeps the agent state in memory and in a JSON file that is
+// replaced atomically on every update
+type StateStore struct {
+	path string
+
+	mu    sync.RWMutex
+	state AgentState
+}
+
+// NewStateStore creates a state store backed by path and loads the state of
+// the previous run. A missing file is not an error; an unreadable one is
+// logged and ignored, so a corrupt file never blocks startup.
+func NewStateStore(path string) (*StateStore, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, fmt.Errorf("failed to create state dir: %w", err)
+	}
+	return OpenStateStore(path), nil
+}
+
+// OpenStateStore loads the state file without creating its directory. The
+// store is meant for reading (dry runs); saving fails if the directory is
+// missing.
+func OpenStateStore(path string) *StateStore {
+	store := &StateStore{path: path}
+	data, err := os.ReadFile(path)
+	switch {
+	case os.IsNotExist(err):
+	case err != nil:
+		log.Printf("[State] Warning: failed to read %s: %v", path, err)
+	default:
+		if err := json.Unmarshal(data, &store.state); err != nil {
+			log.Printf("[State] Warning: ignoring corrupt state file %s: %v", path, err)
+			store.state = AgentState{}
+		} else {
+			log.Printf("[State] Loaded state from %s (%d sessions, %d mesh peers, %d iBGP peers, saved %s)",
+				path, len(store.state.Sessions), len(store.state.MeshPeers), len(store.state.IBGPPeers),
+				store.state.UpdatedAt.Format(time.RFC3339))
+		}
+	}
+	return store
+}
+
+// Get returns a copy of the current state
+func (s *StateStore) Get() AgentState {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	state := s.state
+	state.Sessions = append([]BgpSession(nil), s.state.Sessions...)
+	state.MeshPeers = append([]MeshPeer(nil), s.state.MeshPeers...)
+	state.IBGPPeers = append([]MeshPeer(nil), s.state.IBGPPeers...)
+	return state
+}
+
+// SetSessions records the sessions applied by SessionSync
+func (s *StateStore) SetSessions(sessions []BgpSession) error {
+	return s.update(func(state *AgentState) {
+		state.Sessions = append([]BgpSession(nil), sessions...)
+	})
+}
+
+// SetMeshPeers records the mesh peers applied by MeshSync
+func (s *StateStore) SetMeshPeers(peers map[int]*MeshPeer) error {
+	return s.update(func(state *AgentState) {
+		state.MeshPeers = peerList(peers)
+	})
+}
+
+// SetIBGPPeers records the iBGP peers received from CP
+func (s *StateStore) SetIBGPPeers(peers map[int]*MeshPeer) error {
+	return s.update(func(state *AgentState) {
+		state.IBGPPeers = peerList(peers)
+	})
+}
+
+// SetBirdConfigHash records the hash of the last rendered BIRD policy config
+func (s *StateStore) SetBirdConfigHash(hash string) error {
+	return s.update(func(state *AgentState) {
+		state.BirdConfigHash = hash
+	})
+}
+
+// update applies fn to the state and writes the result to disk
+func (s *StateStore) update(fn func(*AgentState)) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	fn(&s.state)
+	s.state.UpdatedAt = time.Now()
+	return s.save()
+}
+
+// save writes the state to a temporary file and renames it over the old one,
+// so a crash never leaves a partially written state file behind
+func (s *StateStore) save() error {
+	data, err := json.MarshalIndent(s.state, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode state: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), ".state-*.json")
+	if err != nil {
+		return fmt.Errorf("failed to create temp file: %w", err)
+	}
+	defer os.Remove(tmp.Name()) // No-op after a successful rename
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write state: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to sync state: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to close state: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), s.path); err != nil {
+		return fmt.Errorf("failed to replace state file: %w", err)
+	}
+	return nil
+}
+
+// peerList converts a peer map to a list sorted by node ID
+func peerList(peers map[int]*MeshPeer) []MeshPeer {
+	list := make([]MeshPeer, 0, len(peers))
+	for _, peer := range peers {
+		list = append(list, *peer)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].NodeID < list[j].NodeID })
+	return list
+}
+
+// peerMap converts a persisted peer list back to a map keyed by node ID
+func peerMap(peers []MeshPeer) map[int]*MeshPeer {
+	m := make(map[int]*MeshPeer, len(peers))
+	for i := range peers {
+		peer := peers[i]
+		m[peer.NodeID] = &peer
+	}
+	return m
+}
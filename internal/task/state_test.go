@@ -0,0 +1,71 @@
+package task
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestStateStoreRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state", "state.json")
+
+	store, err := NewStateStore(path)
+	if err != nil {
+		t.Fatalf("NewStateStore failed: %v", err)
+	}
+	if err := store.SetSessions([]BgpSession{{UUID: "a", ASN: 4242421080, Credential: "secret"}}); err != nil {
+		t.Fatalf("SetSessions failed: %v", err)
+	}
+	if err := store.SetMeshPeers(map[int]*MeshPeer{3: {NodeID: 3}, 1: {NodeID: 1}}); err != nil {
+		t.Fatalf("SetMeshPeers failed: %v", err)
+	}
+	if err := store.SetBirdConfigHash("abc"); err != nil {
+		t.Fatalf("SetBirdConfigHash failed: %v", err)
+	}
+
+	// Only the state file may be left in the directory
+	entries, err := os.ReadDir(filepath.Dir(path))
+	if err != nil {
+		t.Fatalf("ReadDir failed: %v", err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("Expected only the state file, got %d entries", len(entries))
+	}
+
+	loaded, err := NewStateStore(path)
+	if err != nil {
+		t.Fatalf("NewStateStore failed: %v", err)
+	}
+	state := loaded.Get()
+	if len(state.Sessions) != 1 || state.Sessions[0].UUID != "a" {
+		t.Errorf("Expected session a, got %v", state.Sessions)
+	}
+	if len(state.MeshPeers) != 2 || state.MeshPeers[0].NodeID != 1 {
+		t.Errorf("Expected mesh peers sorted by node ID, got %v", state.MeshPeers)
+	}
+	if state.BirdConfigHash != "abc" {
+		t.Errorf("Expected hash abc, got %s", state.BirdConfigHash)
+	}
+
+	if redacted := state.Redacted(); redacted.Sessions[0].Credential != "" {
+		t.Errorf("Expected credential to be redacted, got %q", redacted.Sessions[0].Credential)
+	}
+	if state.Sessions[0].Credential != "secret" {
+		t.Errorf("Redacted must not modify the original state")
+	}
+}
+
+func TestStateStoreCorruptFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	if err := os.WriteFile(path, []byte("{not json"), 0600); err != nil {
+		t.Fatalf("Failed to write state file: %v", err)
+	}
+
+	store, err := NewStateStore(path)
+	if err != nil {
+		t.Fatalf("Corrupt state file should not fail startup: %v", err)
+	}
+	if state := store.Get(); len(state.Sessions) != 0 || state.BirdConfigHash != "" {
+		t.Errorf("Expected empty state, got %+v", state)
+	}
+}
@@ -0,0 +1,66 @@
+package task
+
+import (
+	"fmt"
+	"log"
+)
+
+// txStep is a single step of a transaction with its compensating action
+type txStep struct {
+	name string
+	do   func() error
+	undo func() error // nil if the step has nothing to undo
+}
+
+// txError reports the step a transaction failed in
+type txError struct {
+	step string
+	err  error
+}
+
+func (e *txError) Error() string {
+	return fmt.Sprintf("%s: %v", e.step, e.err)
+}
+
+func (e *txError) Unwrap() error {
+	return e.err
+}
+
+// transaction runs steps in order. If a step fails, the undo actions of
+// that step and of all steps before it run in reverse order, so the system
+// ends up as it was before the transaction started.
+type transaction struct {
+	name  string
+	steps []txStep
+}
+
+// add appends a step to the transaction
+func (t *transaction) add(name string, do, undo func() error) {
+	t.steps = append(t.steps, txStep{name: name, do: do, undo: undo})
+}
+
+// run executes all steps, rolling back on the first failure
+func (t *transaction) run() error {
+	for i, step := range t.steps {
+		if err := step.do(); err != nil {
+			log.Printf("[SessionSync] %s: step %s failed, rolling back: %v", t.name, step.name, err)
+			t.rollback(i)
+			return &txError{step: step.name, err: err}
+		}
+	}
+	return nil
+}
+
+// rollback undoes steps[0..last] in reverse order. Undo errors are logged
+// and do not stop the rollback.
+func (t *transaction) rollback(last int) {
+	for i := last; i >= 0; i-- {
+		step := t.steps[i]
+		if step.undo == nil {
+			continue
+		}
+		if err := step.undo(); err != nil {
+			log.Printf("[SessionSync] Warning: %s: undo of %s failed: %v", t.name, step.name, err)
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package task
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestTransactionRollback(t *testing.T) {
+	var calls []string
+	step := func(name string, fail bool) (func() error, func() error) {
+		do := func() error {
+			calls = append(calls, "do "+name)
+			if fail {
+				return errors.New("boom")
+			}
+			return nil
+		}
+		undo := func() error {
+			calls = append(calls, "undo "+name)
+			return nil
+		}
+		return do, undo
+	}
+
+	tx := &transaction{name: "test"}
+	do, undo := step("interface", false)
+	tx.add("interface", do, undo)
+	do, _ = step("addresses", false)
+	tx.add("addresses", do, nil)
+	do, undo = step("bird-config", true)
+	tx.add("bird-config", do, undo)
+	do, undo = step("firewall", false)
+	tx.add("firewall", do, undo)
+
+	err := tx.run()
+	var stepErr *txError
+	if !errors.As(err, &stepErr) || stepErr.step != "bird-config" {
+		t.Fatalf("Expected bird-config step error, got %v", err)
+	}
+	if err.Error() != "bird-config: boom" {
+		t.Errorf("Expected error %q, got %q", "bird-config: boom", err.Error())
+	}
+
+	expected := []string{
+		"do interface", "do addresses", "do bird-config",
+		"undo bird-config", "undo interface",
+	}
+	if !reflect.DeepEqual(calls, expected) {
+		t.Errorf("Expected calls %v, got %v", expected, calls)
+	}
+}
+
+func TestTransactionSuccess(t *testing.T) {
+	undone := false
+	tx := &transaction{name: "test"}
+	tx.add("a", func() error { return nil }, func() error { undone = true; return nil })
+	tx.add("b", func() error { return nil }, nil)
+
+	if err := tx.run(); err != nil {
+		t.Fatalf("Expected success, got %v", err)
+	}
+	if undone {
+		t.Error("Expected no undo on success")
+	}
+}
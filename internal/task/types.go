@@ -5,12 +5,13 @@ type BgpSession struct {
 	UUID          string   `json:"uuid"`
 	ASN           uint32   `json:"asn"`
 	Name          string   `json:"name"`
+	Suffix        string   `json:"suffix"` // Optional CP-supplied protocol name suffix
 	Description   string   `json:"description"`
 	Status        int      `json:"status"`
 	Type          string   `json:"type"` // wireguard, gre, ip6gre
 	Interface     string   `json:"interface"`
 	Endpoint      string   `json:"endpoint"`
-	Credential    string   `json:"credential"` // WireGuard public key
+	Credential    string   `json:"credential"` // WireGuardCredential JSON or a bare public key
 	IPv4          string   `json:"ipv4"`
 	IPv6          string   `json:"ipv6"`
 	IPv6LinkLocal string   `json:"ipv6LinkLocal"`
@@ -21,8 +22,25 @@ type BgpSession struct {
 	Policy        string   `json:"policy"`
 	LastError     string   `json:"lastError"`
 	Data          any      `json:"data"` // Additional data
+
+	// BGP transport security, may also be supplied in the Credential JSON
+	Password       string `json:"password"`
+	Authentication string `json:"authentication"` // md5 (default) or ao
+	TTLSecurity    bool   `json:"ttlSecurity"`
+	Multihop       int    `json:"multihop"`
+	SourceAddress  string `json:"sourceAddress"`
+
+	// Preferred address family of a hostname endpoint: ipv4 (default) or ipv6
+	EndpointFamily string `json:"endpointFamily"`
 }
 
+// Session tunnel types
+const (
+	SessionTypeWireGuard = "wireguard"
+	SessionTypeGRE       = "gre"
+	SessionTypeIP6GRE    = "ip6gre"
+)
+
 // Session status constants (matching iedon's implementation)
 const (
 	StatusDeleted = iota
@@ -111,6 +129,9 @@ type MeshPeer struct {
 	Endpoint     string `json:"endpoint"`
 	MTU          int    `json:"mtu"`
 	IsRR         bool   `json:"isRr"`
+
+	// Preferred address family of a hostname endpoint: ipv4 (default) or ipv6
+	EndpointFamily string `json:"endpointFamily"`
 }
 
 // MeshConfig represents the mesh network configuration
@@ -162,24 +183,40 @@ type BirdNodeConfig struct {
 
 // BirdPolicy contains BIRD routing policy parameters
 type BirdPolicy struct {
-	DN42As           string                 `json:"dn42As"`
-	DN42Ipv4Prefix   string                 `json:"dn42Ipv4Prefix"`
-	DN42Ipv6Prefix   string                 `json:"dn42Ipv6Prefix"`
-	RPKIServers      []RPKIServer           `json:"rpkiServers"`
-	EBGPImportLimit  int                    `json:"ebgpImportLimit"`
-	EBGPExportLimit  int                    `json:"ebgpExportLimit"`
-	IBGPImportLimit  int                    `json:"ibgpImportLimit"`
-	IBGPExportLimit  int                    `json:"ibgpExportLimit"`
-	ASPathMaxLen     int                    `json:"asPathMaxLen"`
-	Communities      map[string]interface{} `json:"communities"`
-	LargeCommunities map[string]interface{} `json:"largeCommunities"`
+	DN42As         string         `json:"dn42As"`
+	DN42Ipv4Prefix string         `json:"dn42Ipv4Prefix"`
+	DN42Ipv6Prefix string         `json:"dn42Ipv6Prefix"`
+	RPKIServers    []RPKIServer   `json:"rpkiServers"`
+	RouteCollector RouteCollector `json:"routeCollector"`
+	// Route limits, nil if unset (an explicit 0 is rejected)
+	EBGPImportLimit     *int                   `json:"ebgpImportLimit"`
+	EBGPExportLimit     *int                   `json:"ebgpExportLimit"`
+	IBGPImportLimit     *int                   `json:"ibgpImportLimit"`     // Default of both families below
+	IBGPImportLimitIPv4 *int                   `json:"ibgpImportLimitIpv4"` // iBGP IPv4 import limit
+	IBGPImportLimitIPv6 *int                   `json:"ibgpImportLimitIpv6"` // iBGP IPv6 import limit
+	IBGPExportLimit     *int                   `json:"ibgpExportLimit"`
+	ASPathMaxLen        int                    `json:"asPathMaxLen"`
+	Communities         map[string]interface{} `json:"communities"`
+	LargeCommunities    map[string]interface{} `json:"largeCommunities"`
+}
+
+// RouteCollector is the BGP session to a route collector. The DN42 Global
+// Route Collector is used unless another one is set.
+type RouteCollector struct {
+	Disabled bool   `json:"disabled"`
+	Neighbor string `json:"neighbor"`
+	ASN      uint32 `json:"asn"`
 }
 
 // RPKIServer represents an RPKI server configuration
 type RPKIServer struct {
 	Name string `json:"name"`
 	Host string `json:"host"`
-	Port int    `json:"port"`
+	Port int    `json:"port"` // 0 for the BIRD default (323)
+	// RPKI-RTR timers in seconds
+	Refresh int `json:"refresh"`
+	Retry   int `json:"retry"`
+	Expire  int `json:"expire"`
 }
 
 // BirdIBGPPeer represents an iBGP peer for mesh configuration
@@ -0,0 +1,252 @@
+// Package tunnel manages GRE and ip6gre tunnel interfaces for eBGP sessions.
+package tunnel
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// Supported tunnel modes
+const (
+	ModeGRE    = "gre"
+	ModeIP6GRE = "ip6gre"
+)
+
+// Default MTUs leave room for the outer IP and GRE headers on a 1500 byte link
+const (
+	DefaultMTUGRE    = 1476
+	DefaultMTUIP6GRE = 1448
+)
+
+// Executor manages GRE tunnel interfaces
+type Executor struct{}
+
+// NewExecutor creates a new tunnel executor
+func NewExecutor() *Executor {
+	return &Executor{}
+}
+
+// CreateTunnel creates a GRE or ip6gre tunnel between local and remote,
+// or updates the endpoints of an existing one
+func (e *Executor) CreateTunnel(name, mode, local, remote string) error {
+	family, err := modeFamily(mode)
+	if err != nil {
+		return err
+	}
+
+	if !e.interfaceExists(name) {
+		if err := run("ip", "link", "add", "dev", name, "type", mode,
+			"local", local, "remote", remote, "ttl", "255"); err != nil {
+			return fmt.Errorf("failed to create tunnel: %w", err)
+		}
+	} else {
+		if err := run("ip", family, "tunnel", "change", name, "mode", mode,
+			"local", local, "remote", remote, "ttl", "255"); err != nil {
+			return fmt.Errorf("failed to update tunnel: %w", err)
+		}
+	}
+
+	if err := run("ip", "link", "set", name, "up"); err != nil {
+		return fmt.Errorf("failed to bring tunnel up: %w", err)
+	}
+
+	log.Printf("[Tunnel] %s tunnel %s configured (%s -> %s)", mode, name, local, remote)
+	return nil
+}
+
+// AddAddress adds an IP address to a tunnel interface
+func (e *Executor) AddAddress(name, addr string) error {
+	out, _ := exec.Command("ip", "addr", "show", name).Output()
+	if strings.Contains(string(out), addr) {
+		return nil // Already exists
+	}
+
+	if err := run("ip", "addr", "add", addr, "dev", name); err != nil {
+		return fmt.Errorf("failed to add address %s: %w", addr, err)
+	}
+	return nil
+}
+
+// SetMTU sets the MTU of a tunnel interface
+func (e *Executor) SetMTU(name string, mtu int) error {
+	return run("ip", "link", "set", name, "mtu", fmt.Sprintf("%d", mtu))
+}
+
+// DelAddress removes an IP address from a tunnel interface
+func (e *Executor) DelAddress(name, addr string) error {
+	if err := run("ip", "addr", "del", addr, "dev", name); err != nil {
+		return fmt.Errorf("failed to remove address %s: %w", addr, err)
+	}
+	return nil
+}
+
+// TunnelState is the live configuration of a tunnel interface
+type TunnelState struct {
+	Mode   string
+	Local  string
+	Remote string
+	MTU    int
+}
+
+// GetTunnel reads the live configuration of a tunnel interface
+func (e *Executor) GetTunnel(name string) (*TunnelState, error) {
+	out, err := exec.Command("ip", "-d", "-o", "link", "show", "dev", name).Output()
+	if err != nil {
+		return nil, fmt.Errorf("ip link show failed: %w", err)
+	}
+	return parseLinkDetails(string(out)), nil
+}
+
+// TunnelExists reports whether a tunnel interface exists
+func (e *Executor) TunnelExists(name string) bool {
+	return e.interfaceExists(name)
+}
+
+// DeleteTunnel removes a tunnel interface
+func (e *Executor) DeleteTunnel(name string) error {
+	if !e.interfaceExists(name) {
+		return nil
+	}
+
+	if err := run("ip", "link", "del", name); err != nil {
+		return fmt.Errorf("failed to delete tunnel: %w", err)
+	}
+
+	log.Printf("[Tunnel] Tunnel %s deleted", name)
+	return nil
+}
+
+// resolveTimeout bounds a single endpoint lookup
+const resolveTimeout = 5 * time.Second
+
+// ResolveRemote resolves a session endpoint to the tunnel remote address.
+// The endpoint may be an IP or hostname, optionally with a port which is
+// ignored since GRE has no ports.
+func ResolveRemote(ctx context.Context, endpoint, mode string) (string, error) {
+	host := endpoint
+	if h, _, err := net.SplitHostPort(endpoint); err == nil {
+		host = h
+	}
+	host = strings.Trim(host, "[]")
+	if host == "" {
+		return "", fmt.Errorf("empty tunnel endpoint")
+	}
+
+	wantV6 := mode == ModeIP6GRE
+	if ip := net.ParseIP(host); ip != nil {
+		if (ip.To4() == nil) != wantV6 {
+			return "", fmt.Errorf("endpoint %s does not match tunnel mode %s", host, mode)
+		}
+		return ip.String(), nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, resolveTimeout)
+	defer cancel()
+	ips, err := net.DefaultResolver.LookupIP(ctx, "ip", host)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve %s: %w", host, err)
+	}
+	for _, ip := range ips {
+		if (ip.To4() == nil) == wantV6 {
+			return ip.String(), nil
+		}
+	}
+	return "", fmt.Errorf("%s has no address usable for %s", host, mode)
+}
+
+// LocalAddress returns the source address the kernel would use to reach remote
+func LocalAddress(remote string) (string, error) {
+	out, err := exec.Command("ip", "-o", "route", "get", remote).Output()
+	if err != nil {
+		return "", fmt.Errorf("route lookup for %s failed: %w", remote, err)
+	}
+	src := parseRouteSource(string(out))
+	if src == "" {
+		return "", fmt.Errorf("no source address for %s", remote)
+	}
+	return src, nil
+}
+
+// parseRouteSource extracts the "src" field from "ip -o route get" output
+func parseRouteSource(output string) string {
+	fields := strings.Fields(output)
+	for i := 0; i < len(fields)-1; i++ {
+		if fields[i] == "src" {
+			return fields[i+1]
+		}
+	}
+	return ""
+}
+
+// parseLinkDetails extracts mode, endpoints and MTU from "ip -d -o link show" output
+func parseLinkDetails(output string) *TunnelState {
+	state := &TunnelState{}
+	fields := strings.Fields(output)
+	for i := 0; i < len(fields)-1; i++ {
+		switch fields[i] {
+		case "mtu":
+			fmt.Sscanf(fields[i+1], "%d", &state.MTU)
+		case ModeGRE, ModeIP6GRE:
+			if state.Mode == "" {
+				state.Mode = fields[i]
+			}
+		case "remote":
+			if state.Remote == "" {
+				state.Remote = fields[i+1]
+			}
+		case "local":
+			if state.Local == "" {
+				state.Local = fields[i+1]
+			}
+		}
+	}
+	return state
+}
+
+// modeFamily returns the "ip" address family flag for a tunnel mode
+func modeFamily(mode string) (string, error) {
+	switch mode {
+	case ModeGRE:
+		return "-4", nil
+	case ModeIP6GRE:
+		return "-6", nil
+	default:
+		return "", fmt.Errorf("unsupported tunnel mode %q", mode)
+	}
+}
+
+// interfaceExists checks if a network interface exists
+func (e *Executor) interfaceExists(name string) bool {
+	file, err := os.Open("/proc/net/dev")
+	if err != nil {
+		return false
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if strings.HasPrefix(strings.TrimSpace(scanner.Text()), name+":") {
+			return true
+		}
+	}
+	return false
+}
+
+// run executes a command and includes stderr in the returned error
+func run(name string, args ...string) error {
+	cmd := exec.Command(name, args...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("%w (stderr: %s)", err, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
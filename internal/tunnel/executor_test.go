@@ -0,0 +1,63 @@
+package tunnel
+
+import (
+	"context"
+	"testing"
+)
+
+func TestResolveRemote(t *testing.T) {
+	tests := []struct {
+		endpoint string
+		mode     string
+		expected string
+		wantErr  bool
+	}{
+		{"192.0.2.1", ModeGRE, "192.0.2.1", false},
+		{"192.0.2.1:51820", ModeGRE, "192.0.2.1", false},
+		{"2001:db8::1", ModeIP6GRE, "2001:db8::1", false},
+		{"[2001:db8::1]:51820", ModeIP6GRE, "2001:db8::1", false},
+		{"192.0.2.1", ModeIP6GRE, "", true},
+		{"2001:db8::1", ModeGRE, "", true},
+		{"", ModeGRE, "", true},
+	}
+
+	for _, tt := range tests {
+		got, err := ResolveRemote(context.Background(), tt.endpoint, tt.mode)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ResolveRemote(%q, %s) error = %v, wantErr %v", tt.endpoint, tt.mode, err, tt.wantErr)
+			continue
+		}
+		if got != tt.expected {
+			t.Errorf("ResolveRemote(%q, %s) = %q, want %q", tt.endpoint, tt.mode, got, tt.expected)
+		}
+	}
+}
+
+func TestParseRouteSource(t *testing.T) {
+	tests := []struct {
+		output   string
+		expected string
+	}{
+		{"192.0.2.1 via 198.51.100.1 dev eth0 src 198.51.100.10 uid 0 \\    cache ", "198.51.100.10"},
+		{"2001:db8::1 from :: via fe80::1 dev eth0 proto ra src 2001:db8:1::10 metric 100 pref medium", "2001:db8:1::10"},
+		{"unreachable 192.0.2.1", ""},
+	}
+
+	for _, tt := range tests {
+		if got := parseRouteSource(tt.output); got != tt.expected {
+			t.Errorf("parseRouteSource(%q) = %q, want %q", tt.output, got, tt.expected)
+		}
+	}
+}
+
+func TestModeFamily(t *testing.T) {
+	if f, err := modeFamily(ModeGRE); err != nil || f != "-4" {
+		t.Errorf("Expected -4 for gre, got %q (%v)", f, err)
+	}
+	if f, err := modeFamily(ModeIP6GRE); err != nil || f != "-6" {
+		t.Errorf("Expected -6 for ip6gre, got %q (%v)", f, err)
+	}
+	if _, err := modeFamily("vxlan"); err == nil {
+		t.Error("Expected error for unsupported mode")
+	}
+}
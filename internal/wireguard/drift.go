@@ -0,0 +1,351 @@
+package wireguard
+
+import (
+	"context"
+	"fmt"
+	"net/netip"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Drift fields, also used as metric labels
+const (
+	DriftPrivateKey   = "private-key"
+	DriftListenPort   = "listen-port"
+	DriftPeerKey      = "peer-key"
+	DriftPresharedKey = "preshared-key"
+	DriftEndpoint     = "endpoint"
+	DriftAllowedIPs   = "allowed-ips"
+	DriftKeepalive    = "keepalive"
+	DriftMTU          = "mtu"
+	DriftAddresses    = "addresses"
+)
+
+// PeerConfig is the configuration of a single WireGuard peer
+type PeerConfig struct {
+	PublicKey    string
+	PresharedKey string
+	Endpoint     string
+	AllowedIPs   []string
+	Keepalive    int
+}
+
+// InterfaceConfig is the desired state of a single-peer WireGuard interface
+type InterfaceConfig struct {
+	ListenPort int // 0 leaves the port to the kernel
+	MTU        int // 0 leaves the MTU alone
+	Addresses  []string
+	Peer       PeerConfig
+	// Preferred address family when Peer.Endpoint is a hostname
+	EndpointFamily string
+}
+
+// endpointRoamWindow is how long after a handshake a live endpoint that
+// differs from the configured one is taken as the peer roaming, not drift
+const endpointRoamWindow = 3 * time.Minute
+
+// InterfaceState is the live state of a WireGuard interface
+type InterfaceState struct {
+	PrivateKey string
+	ListenPort int
+	MTU        int
+	Addresses  []string
+	Peers      []PeerConfig
+	Handshakes map[string]time.Time // Latest handshake by peer key, zero if none
+}
+
+// Roaming reports whether a peer had a handshake within endpointRoamWindow.
+// WireGuard moves the endpoint of such a peer to the address its packets come
+// from, so a live endpoint differing from the configured one is the peer
+// roaming or behind NAT, not drift.
+func (s *InterfaceState) Roaming(publicKey string) bool {
+	return time.Since(s.Handshakes[publicKey]) < endpointRoamWindow
+}
+
+// Drift describes a field whose live value differs from the desired one.
+// Desired and Live are empty for key material.
+type Drift struct {
+	Field   string
+	Desired string
+	Live    string
+}
+
+// GetInterfaceState reads the live WireGuard, MTU and address state of an interface
+func (e *Executor) GetInterfaceState(name string) (*InterfaceState, error) {
+	out, err := exec.Command("wg", "show", name, "dump").Output()
+	if err != nil {
+		return nil, fmt.Errorf("wg show failed: %w", err)
+	}
+	state, err := parseDump(string(out))
+	if err != nil {
+		return nil, err
+	}
+
+	if data, err := os.ReadFile(filepath.Join("/sys/class/net", name, "mtu")); err == nil {
+		state.MTU, _ = strconv.Atoi(strings.TrimSpace(string(data)))
+	}
+
+	out, err = exec.Command("ip", "-o", "addr", "show", "dev", name).Output()
+	if err != nil {
+		return nil, fmt.Errorf("ip addr show failed: %w", err)
+	}
+	state.Addresses = parseAddresses(string(out))
+
+	return state, nil
+}
+
+// Drift compares the live state of an interface with the desired one. ctx
+// bounds the lookup of a hostname endpoint.
+func (e *Executor) Drift(ctx context.Context, desired *InterfaceConfig, live *InterfaceState) []Drift {
+	var drifts []Drift
+
+	if live.PrivateKey != e.privateKey {
+		drifts = append(drifts, Drift{Field: DriftPrivateKey})
+	}
+	if desired.ListenPort > 0 && live.ListenPort != desired.ListenPort {
+		drifts = append(drifts, Drift{Field: DriftListenPort,
+			Desired: strconv.Itoa(desired.ListenPort), Live: strconv.Itoa(live.ListenPort)})
+	}
+	if desired.MTU > 0 && live.MTU != desired.MTU {
+		drifts = append(drifts, Drift{Field: DriftMTU,
+			Desired: strconv.Itoa(desired.MTU), Live: strconv.Itoa(live.MTU)})
+	}
+	if missing := missingAddresses(desired.Addresses, live.Addresses); len(missing) > 0 {
+		drifts = append(drifts, Drift{Field: DriftAddresses,
+			Desired: strings.Join(desired.Addresses, ","), Live: strings.Join(live.Addresses, ",")})
+	}
+
+	// A missing or extra peer is repaired by reconfiguring the whole peer
+	var peer *PeerConfig
+	for i := range live.Peers {
+		if live.Peers[i].PublicKey == desired.Peer.PublicKey {
+			peer = &live.Peers[i]
+		}
+	}
+	if peer == nil || len(live.Peers) != 1 {
+		return append(drifts, Drift{Field: DriftPeerKey})
+	}
+
+	if peer.PresharedKey != desired.Peer.PresharedKey {
+		drifts = append(drifts, Drift{Field: DriftPresharedKey})
+	}
+	// WireGuard moves the endpoint to wherever authenticated packets come
+	// from, so with a recent handshake a differing endpoint is a peer behind
+	// NAT or roaming. Only a silent tunnel gets the configured endpoint back.
+	if desired.Peer.Endpoint != "" && !live.Roaming(peer.PublicKey) {
+		// Compare resolved addresses, the kernel only knows IP:port
+		want, err := ResolveEndpoint(ctx, desired.Peer.Endpoint, desired.EndpointFamily)
+		if err == nil && want != peer.Endpoint {
+			drifts = append(drifts, Drift{Field: DriftEndpoint, Desired: want, Live: peer.Endpoint})
+		}
+	}
+	if !samePrefixes(desired.Peer.AllowedIPs, peer.AllowedIPs) {
+		drifts = append(drifts, Drift{Field: DriftAllowedIPs,
+			Desired: strings.Join(desired.Peer.AllowedIPs, ","), Live: strings.Join(peer.AllowedIPs, ",")})
+	}
+	if peer.Keepalive != desired.Peer.Keepalive {
+		drifts = append(drifts, Drift{Field: DriftKeepalive,
+			Desired: strconv.Itoa(desired.Peer.Keepalive), Live: strconv.Itoa(peer.Keepalive)})
+	}
+
+	return drifts
+}
+
+// Repair resets a single drifted field of an interface to its desired value
+func (e *Executor) Repair(ctx context.Context, name string, desired *InterfaceConfig, live *InterfaceState, field string) error {
+	peer := desired.Peer
+	switch field {
+	case DriftPrivateKey:
+		cmd := exec.Command("wg", "set", name, "private-key", "/dev/stdin")
+		cmd.Stdin = strings.NewReader(e.privateKey)
+		return runCommand(cmd)
+	case DriftListenPort:
+		return runCommand(exec.Command("wg", "set", name, "listen-port", strconv.Itoa(desired.ListenPort)))
+	case DriftMTU:
+		return e.SetMTU(name, desired.MTU)
+	case DriftAddresses:
+		for _, addr := range missingAddresses(desired.Addresses, live.Addresses) {
+			if err := e.AddAddress(name, addr); err != nil {
+				return err
+			}
+		}
+		return nil
+	case DriftPeerKey:
+		for _, p := range live.Peers {
+			if p.PublicKey == peer.PublicKey {
+				continue
+			}
+			if err := runCommand(exec.Command("wg", "set", name, "peer", p.PublicKey, "remove")); err != nil {
+				return fmt.Errorf("failed to remove stale peer: %w", err)
+			}
+		}
+		return e.setPeer(name, peer)
+	case DriftPresharedKey:
+		return e.setPeer(name, PeerConfig{PublicKey: peer.PublicKey, PresharedKey: peer.PresharedKey})
+	case DriftEndpoint:
+		endpoint, err := ResolveEndpoint(ctx, peer.Endpoint, desired.EndpointFamily)
+		if err != nil {
+			return err
+		}
+		return e.SetEndpoint(name, peer.PublicKey, endpoint)
+	case DriftAllowedIPs:
+		return runCommand(exec.Command("wg", "set", name, "peer", peer.PublicKey,
+			"allowed-ips", strings.Join(peer.AllowedIPs, ",")))
+	case DriftKeepalive:
+		return runCommand(exec.Command("wg", "set", name, "peer", peer.PublicKey,
+			"persistent-keepalive", strconv.Itoa(peer.Keepalive)))
+	default:
+		return fmt.Errorf("unknown drift field %q", field)
+	}
+}
+
+// Restore resets an interface to a state captured by GetInterfaceState
+func (e *Executor) Restore(name string, state *InterfaceState) error {
+	if state.ListenPort > 0 {
+		if err := runCommand(exec.Command("wg", "set", name, "listen-port", strconv.Itoa(state.ListenPort))); err != nil {
+			return fmt.Errorf("failed to restore listen port: %w", err)
+		}
+	}
+
+	live, err := e.GetInterfaceState(name)
+	if err != nil {
+		return err
+	}
+	keep := make(map[string]bool)
+	for _, peer := range state.Peers {
+		keep[peer.PublicKey] = true
+	}
+	for _, peer := range live.Peers {
+		if keep[peer.PublicKey] {
+			continue
+		}
+		if err := runCommand(exec.Command("wg", "set", name, "peer", peer.PublicKey, "remove")); err != nil {
+			return fmt.Errorf("failed to remove peer: %w", err)
+		}
+	}
+
+	for _, peer := range state.Peers {
+		if err := e.setPeer(name, peer); err != nil {
+			return err
+		}
+		if peer.Keepalive == 0 {
+			if err := runCommand(exec.Command("wg", "set", name, "peer", peer.PublicKey, "persistent-keepalive", "0")); err != nil {
+				return fmt.Errorf("failed to restore keepalive: %w", err)
+			}
+		}
+	}
+
+	if state.MTU > 0 {
+		if err := e.SetMTU(name, state.MTU); err != nil {
+			return fmt.Errorf("failed to restore MTU: %w", err)
+		}
+	}
+	return nil
+}
+
+// parseDump parses "wg show <if> dump" output. The first line describes the
+// interface, every following line one peer.
+func parseDump(output string) (*InterfaceState, error) {
+	lines := strings.Split(strings.TrimSpace(output), "\n")
+	fields := strings.Split(lines[0], "\t")
+	if len(fields) < 3 {
+		return nil, fmt.Errorf("unexpected wg dump header: %q", lines[0])
+	}
+
+	state := &InterfaceState{PrivateKey: dumpValue(fields[0]), Handshakes: make(map[string]time.Time)}
+	state.ListenPort, _ = strconv.Atoi(fields[2])
+
+	for _, line := range lines[1:] {
+		fields := strings.Split(line, "\t")
+		if len(fields) < 8 {
+			continue
+		}
+		peer := PeerConfig{
+			PublicKey:    fields[0],
+			PresharedKey: dumpValue(fields[1]),
+			Endpoint:     dumpValue(fields[2]),
+		}
+		if ips := dumpValue(fields[3]); ips != "" {
+			peer.AllowedIPs = strings.Split(ips, ",")
+		}
+		peer.Keepalive, _ = strconv.Atoi(fields[7]) // "off" parses as 0
+		if ts, err := strconv.ParseInt(fields[4], 10, 64); err == nil && ts > 0 {
+			state.Handshakes[peer.PublicKey] = time.Unix(ts, 0)
+		}
+		state.Peers = append(state.Peers, peer)
+	}
+	return state, nil
+}
+
+// dumpValue maps the placeholders of "wg show dump" to empty strings
+func dumpValue(v string) string {
+	if v == "(none)" || v == "off" {
+		return ""
+	}
+	return v
+}
+
+// parseAddresses extracts the addresses from "ip -o addr show" output
+func parseAddresses(output string) []string {
+	var addrs []string
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Fields(line)
+		for i := 0; i < len(fields)-1; i++ {
+			if fields[i] == "inet" || fields[i] == "inet6" {
+				addrs = append(addrs, fields[i+1])
+				break
+			}
+		}
+	}
+	return addrs
+}
+
+// missingAddresses returns the desired addresses not configured on the interface
+func missingAddresses(desired, live []string) []string {
+	have := make(map[string]bool)
+	for _, addr := range live {
+		have[normalizePrefix(addr)] = true
+	}
+	var missing []string
+	for _, addr := range desired {
+		if !have[normalizePrefix(addr)] {
+			missing = append(missing, addr)
+		}
+	}
+	return missing
+}
+
+// samePrefixes reports whether two prefix lists contain the same prefixes
+func samePrefixes(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	na := make([]string, len(a))
+	nb := make([]string, len(b))
+	for i := range a {
+		na[i] = normalizePrefix(a[i])
+		nb[i] = normalizePrefix(b[i])
+	}
+	sort.Strings(na)
+	sort.Strings(nb)
+	for i := range na {
+		if na[i] != nb[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// normalizePrefix returns the canonical form of an address with prefix length
+func normalizePrefix(s string) string {
+	s = strings.TrimSpace(s)
+	if p, err := netip.ParsePrefix(s); err == nil {
+		return p.String()
+	}
+	return s
+}
@@ -0,0 +1,121 @@
+package wireguard
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+)
+
+const testDump = "cHJpdmF0ZQ==\tcHVibGlj\t24080\toff\n" +
+	"cGVlcg==\t(none)\t203.0.113.1:24216\t0.0.0.0/0,fd00::/8,fe80::/64\t1700000000\t1024\t2048\t25\n"
+
+func TestParseDump(t *testing.T) {
+	state, err := parseDump(testDump)
+	if err != nil {
+		t.Fatalf("parseDump failed: %v", err)
+	}
+
+	if state.PrivateKey != "cHJpdmF0ZQ==" {
+		t.Errorf("Expected private key cHJpdmF0ZQ==, got %s", state.PrivateKey)
+	}
+	if state.ListenPort != 24080 {
+		t.Errorf("Expected listen port 24080, got %d", state.ListenPort)
+	}
+	if len(state.Peers) != 1 {
+		t.Fatalf("Expected 1 peer, got %d", len(state.Peers))
+	}
+
+	expected := PeerConfig{
+		PublicKey:  "cGVlcg==",
+		Endpoint:   "203.0.113.1:24216",
+		AllowedIPs: []string{"0.0.0.0/0", "fd00::/8", "fe80::/64"},
+		Keepalive:  25,
+	}
+	if !reflect.DeepEqual(state.Peers[0], expected) {
+		t.Errorf("Expected peer %+v, got %+v", expected, state.Peers[0])
+	}
+	if got := state.Handshakes["cGVlcg=="]; !got.Equal(time.Unix(1700000000, 0)) {
+		t.Errorf("Expected latest handshake 1700000000, got %v", got)
+	}
+}
+
+func TestParseAddresses(t *testing.T) {
+	output := "7: dn42_1080    inet6 fe80::216/64 scope link \\       valid_lft forever preferred_lft forever\n" +
+		"7: dn42_1080    inet 172.20.0.1/32 scope global dn42_1080\\       valid_lft forever preferred_lft forever\n"
+
+	got := parseAddresses(output)
+	expected := []string{"fe80::216/64", "172.20.0.1/32"}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected %v, got %v", expected, got)
+	}
+}
+
+func TestDrift(t *testing.T) {
+	e := &Executor{privateKey: "cHJpdmF0ZQ=="}
+
+	desired := func() *InterfaceConfig {
+		return &InterfaceConfig{
+			ListenPort: 24080,
+			MTU:        1420,
+			Addresses:  []string{"fe80::216/64"},
+			Peer: PeerConfig{
+				PublicKey:  "cGVlcg==",
+				Endpoint:   "203.0.113.1:24216",
+				AllowedIPs: []string{"fd00::/8", "0.0.0.0/0", "fe80::/64"},
+				Keepalive:  25,
+			},
+		}
+	}
+	live := func() *InterfaceState {
+		state, _ := parseDump(testDump)
+		state.MTU = 1420
+		state.Addresses = []string{"fe80::216/64"}
+		return state
+	}
+
+	tests := []struct {
+		name     string
+		modify   func(*InterfaceConfig, *InterfaceState)
+		expected []string
+	}{
+		{"in sync", func(*InterfaceConfig, *InterfaceState) {}, nil},
+		{"private key", func(_ *InterfaceConfig, l *InterfaceState) { l.PrivateKey = "b3RoZXI=" }, []string{DriftPrivateKey}},
+		{"listen port", func(d *InterfaceConfig, _ *InterfaceState) { d.ListenPort = 24081 }, []string{DriftListenPort}},
+		{"random port ignored", func(d *InterfaceConfig, _ *InterfaceState) { d.ListenPort = 0 }, nil},
+		{"mtu", func(_ *InterfaceConfig, l *InterfaceState) { l.MTU = 1500 }, []string{DriftMTU}},
+		{"missing address", func(_ *InterfaceConfig, l *InterfaceState) { l.Addresses = nil }, []string{DriftAddresses}},
+		{"peer key", func(d *InterfaceConfig, _ *InterfaceState) { d.Peer.PublicKey = "bmV3" }, []string{DriftPeerKey}},
+		{"extra peer", func(_ *InterfaceConfig, l *InterfaceState) {
+			l.Peers = append(l.Peers, PeerConfig{PublicKey: "c3RhbGU="})
+		}, []string{DriftPeerKey}},
+		{"preshared key", func(d *InterfaceConfig, _ *InterfaceState) { d.Peer.PresharedKey = "cHNr" }, []string{DriftPresharedKey}},
+		{"endpoint", func(d *InterfaceConfig, _ *InterfaceState) { d.Peer.Endpoint = "203.0.113.2:24216" }, []string{DriftEndpoint}},
+		{"roaming endpoint ignored", func(d *InterfaceConfig, _ *InterfaceState) { d.Peer.Endpoint = "" }, nil},
+		{"endpoint moved with recent handshake", func(d *InterfaceConfig, l *InterfaceState) {
+			d.Peer.Endpoint = "203.0.113.2:24216"
+			l.Handshakes["cGVlcg=="] = time.Now().Add(-time.Minute)
+		}, nil},
+		{"endpoint of silent peer", func(d *InterfaceConfig, l *InterfaceState) {
+			d.Peer.Endpoint = "203.0.113.2:24216"
+			l.Handshakes["cGVlcg=="] = time.Now().Add(-10 * time.Minute)
+		}, []string{DriftEndpoint}},
+		{"allowed ips", func(_ *InterfaceConfig, l *InterfaceState) { l.Peers[0].AllowedIPs = []string{"fd00::/8"} }, []string{DriftAllowedIPs}},
+		{"keepalive", func(_ *InterfaceConfig, l *InterfaceState) { l.Peers[0].Keepalive = 0 }, []string{DriftKeepalive}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d, l := desired(), live()
+			tt.modify(d, l)
+
+			var fields []string
+			for _, drift := range e.Drift(context.Background(), d, l) {
+				fields = append(fields, drift.Field)
+			}
+			if !reflect.DeepEqual(fields, tt.expected) {
+				t.Errorf("Expected drift %v, got %v", tt.expected, fields)
+			}
+		})
+	}
+}
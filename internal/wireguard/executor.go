@@ -8,7 +8,9 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"time"
 )
 
 // Executor manages WireGuard interfaces
@@ -32,6 +34,19 @@ func NewExecutor(configDir, privateKeyPath string) (*Executor, error) {
 	return e, nil
 }
 
+// OpenExecutor creates a WireGuard executor for reading the live state only.
+// Unlike NewExecutor it never generates or saves a key: without a private
+// key file the executor has no key, and every interface shows as drifted.
+func OpenExecutor(configDir, privateKeyPath string) *Executor {
+	e := &Executor{
+		configDir: configDir,
+	}
+	if data, err := os.ReadFile(privateKeyPath); err == nil {
+		e.privateKey = strings.TrimSpace(string(data))
+	}
+	return e
+}
+
 // loadOrCreateKeys loads existing keys or generates new ones
 func (e *Executor) loadOrCreateKeys(privateKeyPath string) error {
 	// Try to load existing private key
@@ -95,41 +110,76 @@ func (e *Executor) CreateInterface(name string, listenPort int, peerKey, preshar
 	}
 
 	// Configure peer
-	args := []string{"set", name, "peer", peerKey, "allowed-ips", strings.Join(allowedIPs, ",")}
-	if endpoint != "" {
-		args = append(args, "endpoint", endpoint)
+	if err := e.setPeer(name, PeerConfig{
+		PublicKey:    peerKey,
+		PresharedKey: presharedKey,
+		Endpoint:     endpoint,
+		AllowedIPs:   allowedIPs,
+		Keepalive:    keepalive,
+	}); err != nil {
+		return err
 	}
-	if keepalive > 0 {
-		args = append(args, "persistent-keepalive", fmt.Sprintf("%d", keepalive))
+
+	// Bring interface up
+	if err := exec.Command("ip", "link", "set", name, "up").Run(); err != nil {
+		return fmt.Errorf("failed to bring interface up: %w", err)
 	}
-	if presharedKey != "" {
+
+	log.Printf("[WireGuard] Interface %s configured", name)
+	return nil
+}
+
+// setPeer configures a peer. Empty fields are left untouched, except the
+// preshared key which is cleared when empty.
+func (e *Executor) setPeer(name string, peer PeerConfig) error {
+	args := []string{"set", name, "peer", peer.PublicKey}
+	if len(peer.AllowedIPs) > 0 {
+		args = append(args, "allowed-ips", strings.Join(peer.AllowedIPs, ","))
+	}
+	if peer.Endpoint != "" {
+		args = append(args, "endpoint", peer.Endpoint)
+	}
+	if peer.Keepalive > 0 {
+		args = append(args, "persistent-keepalive", fmt.Sprintf("%d", peer.Keepalive))
+	}
+	if peer.PresharedKey != "" {
 		// Write PSK to temp file (wg requires file path for preshared-key)
 		pskFile, err := os.CreateTemp("", "wg-psk-*")
 		if err != nil {
 			return fmt.Errorf("failed to create PSK temp file: %w", err)
 		}
 		defer os.Remove(pskFile.Name())
-		if _, err := pskFile.WriteString(presharedKey); err != nil {
+		if _, err := pskFile.WriteString(peer.PresharedKey); err != nil {
 			pskFile.Close()
 			return fmt.Errorf("failed to write PSK: %w", err)
 		}
 		pskFile.Close()
 		args = append(args, "preshared-key", pskFile.Name())
+	} else {
+		args = append(args, "preshared-key", "/dev/null")
 	}
 
-	cmd = exec.Command("wg", args...)
-	var stderr bytes.Buffer
-	cmd.Stderr = &stderr
-	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("failed to configure peer: %w (stderr: %s)", err, stderr.String())
+	if err := runCommand(exec.Command("wg", args...)); err != nil {
+		return fmt.Errorf("failed to configure peer: %w", err)
 	}
+	return nil
+}
 
-	// Bring interface up
-	if err := exec.Command("ip", "link", "set", name, "up").Run(); err != nil {
-		return fmt.Errorf("failed to bring interface up: %w", err)
+// SetEndpoint changes only the endpoint of a peer
+func (e *Executor) SetEndpoint(name, peerKey, endpoint string) error {
+	if err := runCommand(exec.Command("wg", "set", name, "peer", peerKey, "endpoint", endpoint)); err != nil {
+		return fmt.Errorf("failed to set endpoint: %w", err)
 	}
+	return nil
+}
 
-	log.Printf("[WireGuard] Interface %s configured", name)
+// runCommand runs cmd and includes stderr in the returned error
+func runCommand(cmd *exec.Cmd) error {
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("%w (stderr: %s)", err, strings.TrimSpace(stderr.String()))
+	}
 	return nil
 }
 
@@ -147,11 +197,24 @@ func (e *Executor) AddAddress(ifname, addr string) error {
 	return nil
 }
 
+// DelAddress removes an IP address from an interface
+func (e *Executor) DelAddress(ifname, addr string) error {
+	if err := runCommand(exec.Command("ip", "addr", "del", addr, "dev", ifname)); err != nil {
+		return fmt.Errorf("failed to remove address %s: %w", addr, err)
+	}
+	return nil
+}
+
 // SetMTU sets the MTU for an interface
 func (e *Executor) SetMTU(ifname string, mtu int) error {
 	return exec.Command("ip", "link", "set", ifname, "mtu", fmt.Sprintf("%d", mtu)).Run()
 }
 
+// InterfaceExists reports whether a network interface exists
+func (e *Executor) InterfaceExists(name string) bool {
+	return e.interfaceExists(name)
+}
+
 // DeleteInterface removes a WireGuard interface
 func (e *Executor) DeleteInterface(name string) error {
 	if !e.interfaceExists(name) {
@@ -187,6 +250,60 @@ func (e *Executor) interfaceExists(name string) bool {
 	return false
 }
 
+// ListInterfaces returns the names of all network interfaces starting with prefix
+func (e *Executor) ListInterfaces(prefix string) ([]string, error) {
+	file, err := os.Open("/proc/net/dev")
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var names []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		idx := strings.Index(line, ":")
+		if idx <= 0 {
+			continue
+		}
+		name := line[:idx]
+		if strings.HasPrefix(name, prefix) {
+			names = append(names, name)
+		}
+	}
+	return names, scanner.Err()
+}
+
+// LatestHandshake returns the most recent handshake time across all peers of
+// an interface. A zero time means no handshake has happened yet.
+func (e *Executor) LatestHandshake(name string) (time.Time, error) {
+	out, err := exec.Command("wg", "show", name, "latest-handshakes").Output()
+	if err != nil {
+		return time.Time{}, fmt.Errorf("wg show failed: %w", err)
+	}
+	return parseLatestHandshakes(string(out)), nil
+}
+
+// parseLatestHandshakes parses "wg show <if> latest-handshakes" output
+// (one "<public key>\t<unix timestamp>" line per peer)
+func parseLatestHandshakes(output string) time.Time {
+	var latest int64
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			continue
+		}
+		ts, err := strconv.ParseInt(fields[1], 10, 64)
+		if err == nil && ts > latest {
+			latest = ts
+		}
+	}
+	if latest == 0 {
+		return time.Time{}
+	}
+	return time.Unix(latest, 0)
+}
+
 // GetStatus returns the status of a WireGuard interface
 func (e *Executor) GetStatus(name string) (string, error) {
 	out, err := exec.Command("wg", "show", name).Output()
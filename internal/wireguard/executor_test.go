@@ -0,0 +1,28 @@
+package wireguard
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseLatestHandshakes(t *testing.T) {
+	tests := []struct {
+		name     string
+		output   string
+		expected time.Time
+	}{
+		{"single peer", "abc=\t1700000000\n", time.Unix(1700000000, 0)},
+		{"latest of many", "abc=\t1700000000\ndef=\t1700000100\n", time.Unix(1700000100, 0)},
+		{"never", "abc=\t0\n", time.Time{}},
+		{"empty", "", time.Time{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := parseLatestHandshakes(tt.output)
+			if !got.Equal(tt.expected) {
+				t.Errorf("parseLatestHandshakes() = %v, want %v", got, tt.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,76 @@
+package wireguard
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/netip"
+	"time"
+)
+
+// resolveTimeout bounds a single endpoint lookup, so a slow resolver cannot
+// stall the task holding the session
+const resolveTimeout = 5 * time.Second
+
+// Endpoint address families. An empty family prefers IPv4.
+const (
+	FamilyIPv4 = "ipv4"
+	FamilyIPv6 = "ipv6"
+)
+
+// ValidFamily reports whether family is empty or a known address family
+func ValidFamily(family string) bool {
+	return family == "" || family == FamilyIPv4 || family == FamilyIPv6
+}
+
+// IsHostnameEndpoint reports whether a host:port endpoint names a host
+// rather than an IP address
+func IsHostnameEndpoint(endpoint string) bool {
+	host, _, err := net.SplitHostPort(endpoint)
+	if err != nil || host == "" {
+		return false
+	}
+	_, err = netip.ParseAddr(host)
+	return err != nil
+}
+
+// ResolveEndpoint resolves a host:port endpoint to the IP:port form the
+// kernel reports. An address of the preferred family is used if the host has
+// one, otherwise the first address returned.
+func ResolveEndpoint(ctx context.Context, endpoint, family string) (string, error) {
+	host, port, err := net.SplitHostPort(endpoint)
+	if err != nil {
+		return "", fmt.Errorf("invalid endpoint %q: %w", endpoint, err)
+	}
+	if addr, err := netip.ParseAddr(host); err == nil {
+		return net.JoinHostPort(addr.Unmap().String(), port), nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, resolveTimeout)
+	defer cancel()
+	addrs, err := net.DefaultResolver.LookupNetIP(ctx, "ip", host)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve %s: %w", host, err)
+	}
+	addr, ok := pickAddress(addrs, family)
+	if !ok {
+		return "", fmt.Errorf("%s has no addresses", host)
+	}
+	return net.JoinHostPort(addr.String(), port), nil
+}
+
+// pickAddress returns the first address of the preferred family, or the
+// first address if there is none
+func pickAddress(addrs []netip.Addr, family string) (netip.Addr, bool) {
+	if len(addrs) == 0 {
+		return netip.Addr{}, false
+	}
+	wantV6 := family == FamilyIPv6
+	for _, addr := range addrs {
+		addr = addr.Unmap()
+		if addr.Is6() == wantV6 {
+			return addr, true
+		}
+	}
+	return addrs[0].Unmap(), true
+}
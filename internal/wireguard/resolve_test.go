@@ -0,0 +1,83 @@
+package wireguard
+
+import (
+	"context"
+	"net/netip"
+	"testing"
+)
+
+func TestIsHostnameEndpoint(t *testing.T) {
+	tests := []struct {
+		endpoint string
+		want     bool
+	}{
+		{"peer.example.com:51820", true},
+		{"1.2.3.4:51820", false},
+		{"[fd00::1]:51820", false},
+		{"peer.example.com", false}, // No port
+		{"", false},
+	}
+
+	for _, tt := range tests {
+		if got := IsHostnameEndpoint(tt.endpoint); got != tt.want {
+			t.Errorf("IsHostnameEndpoint(%q): expected %v, got %v", tt.endpoint, tt.want, got)
+		}
+	}
+}
+
+func TestResolveEndpointLiteral(t *testing.T) {
+	tests := []struct {
+		endpoint string
+		want     string
+	}{
+		{"1.2.3.4:51820", "1.2.3.4:51820"},
+		{"[fd00::1]:51820", "[fd00::1]:51820"},
+		{"[::ffff:1.2.3.4]:51820", "1.2.3.4:51820"},
+	}
+
+	for _, tt := range tests {
+		got, err := ResolveEndpoint(context.Background(), tt.endpoint, FamilyIPv6)
+		if err != nil {
+			t.Errorf("ResolveEndpoint(%q) failed: %v", tt.endpoint, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ResolveEndpoint(%q): expected %s, got %s", tt.endpoint, tt.want, got)
+		}
+	}
+
+	if _, err := ResolveEndpoint(context.Background(), "1.2.3.4", ""); err == nil {
+		t.Error("Expected error for endpoint without port")
+	}
+}
+
+func TestPickAddress(t *testing.T) {
+	v4 := netip.MustParseAddr("1.2.3.4")
+	v6 := netip.MustParseAddr("fd00::1")
+
+	tests := []struct {
+		name   string
+		addrs  []netip.Addr
+		family string
+		want   netip.Addr
+	}{
+		{"default prefers ipv4", []netip.Addr{v6, v4}, "", v4},
+		{"ipv4", []netip.Addr{v6, v4}, FamilyIPv4, v4},
+		{"ipv6", []netip.Addr{v4, v6}, FamilyIPv6, v6},
+		{"fallback to other family", []netip.Addr{v4}, FamilyIPv6, v4},
+		{"mapped ipv4", []netip.Addr{netip.AddrFrom16(v4.As16())}, FamilyIPv4, v4},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := pickAddress(tt.addrs, tt.family)
+			if !ok || got != tt.want {
+				t.Errorf("Expected %s, got %s (ok %v)", tt.want, got, ok)
+			}
+		})
+	}
+
+	if _, ok := pickAddress(nil, ""); ok {
+		t.Error("Expected no address from an empty list")
+	}
+}